@@ -0,0 +1,379 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/service/sync"
+	iynab "github.com/bad33ndj3/bunq2ynab/internal/driven/ynab"
+	"github.com/bad33ndj3/bunq2ynab/internal/fake/fakebunq"
+	"github.com/bad33ndj3/bunq2ynab/internal/fake/fakeynab"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// e2e runs the real command wiring against fake bunq and YNAB servers.
+type e2e struct {
+	bunq *fakebunq.Server
+	ynab *fakeynab.Server
+
+	config    string
+	stateDir  string
+	budgetID  string
+	accountID string
+	bankID    int
+}
+
+var configTemplate = template.Must(template.New("config").Parse(`bunq_token: "bunq-key"
+bunq_base_url: "{{.BunqURL}}"
+ynab_base_url: "{{.YnabURL}}/v1"
+ynab_token: "ynab-token"
+state_dir: "{{.StateDir}}"
+accounts:
+  - bunq_account_name: "Main"
+    ynab_budget_name: "Budget"
+    ynab_account_name: "Checking"
+{{- range .Extra}}
+  - bunq_account_name: "{{.}}"
+    ynab_budget_name: "Budget"
+    ynab_account_name: "{{.}}"
+{{- end}}
+`))
+
+// newE2E starts the fakes with a bunq account "Main" synced to the YNAB account "Checking",
+// and one extra account per name in extra, synced to the YNAB account with the same name.
+func newE2E(t *testing.T, extra ...string) *e2e {
+	t.Helper()
+
+	// the bunq client is rate limited to one request per second, which adds up
+	if testing.Short() {
+		t.Skip("skipping end-to-end test in short mode")
+	}
+
+	e := &e2e{bunq: fakebunq.New(), ynab: fakeynab.New()}
+	t.Cleanup(e.bunq.Close)
+	t.Cleanup(e.ynab.Close)
+
+	e.bankID = e.bunq.AddAccount(fakebunq.KindBank, "Main", "NL00BUNQ0000000001")
+	e.budgetID = e.ynab.AddBudget("Budget")
+	e.accountID = e.ynab.AddAccount(e.budgetID, "Checking")
+
+	dir := t.TempDir()
+	e.config = filepath.Join(dir, "config.yaml")
+	e.stateDir = filepath.Join(dir, "state")
+	f, err := os.Create(e.config)
+	if err != nil {
+		t.Fatalf("creating config: %v", err)
+	}
+	defer f.Close()
+
+	err = configTemplate.Execute(f, map[string]any{
+		"BunqURL":  e.bunq.URL,
+		"YnabURL":  e.ynab.URL,
+		"StateDir": e.stateDir,
+		"Extra":    extra,
+	})
+	if err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	return e
+}
+
+func (e *e2e) run(t *testing.T, args ...string) {
+	t.Helper()
+
+	err := run(append([]string{"bunq2ynab", "--config", e.config}, args...))
+	if err != nil {
+		t.Fatalf("running %v: %v", args, err)
+	}
+}
+
+func (e *e2e) pay(accountID int, amount string, payee string, daysAgo int) int {
+	return e.bunq.AddPayment(accountID, fakebunq.Payment{
+		Created:          time.Now().AddDate(0, 0, -daysAgo),
+		Amount:           decimal.RequireFromString(amount),
+		Description:      "payment to " + payee,
+		CounterpartyName: payee,
+		CounterpartyIBAN: "NL00TEST0000000000",
+	})
+}
+
+func TestE2ESyncFollowsPagesAndCursor(t *testing.T) {
+	e := newE2E(t)
+	e.bunq.PageSize = 2
+	e.pay(e.bankID, "-12.50", "Albert Heijn", 3)
+	e.pay(e.bankID, "-3.20", "NS", 2)
+	last := e.pay(e.bankID, "1500.00", "Employer", 1)
+
+	e.run(t, "sync", "30")
+
+	ts := e.ynab.Transactions(e.budgetID, e.accountID)
+	if len(ts) != 3 {
+		t.Fatalf("Expected 3 transactions in YNAB, got %d", len(ts))
+	}
+
+	var found bool
+	for _, tx := range ts {
+		if *tx.ImportID == "BUNQ:"+strconv.Itoa(last)+":1" {
+			found = tx.Amount == 1500000 && *tx.PayeeName == "Employer"
+		}
+	}
+	if !found {
+		t.Errorf("Expected the salary with its bunq import ID, got %+v", ts)
+	}
+
+	if calls := e.bunq.Calls("/v1/user/1/monetary-account/" + strconv.Itoa(e.bankID) + "/payment"); calls != 2 {
+		t.Errorf("Expected 2 pages of payments, got %d", calls)
+	}
+
+	e.pay(e.bankID, "-9.99", "Spotify", 0)
+	e.run(t, "sync", "30")
+
+	if got := len(e.ynab.Transactions(e.budgetID, e.accountID)); got != 4 {
+		t.Errorf("Expected 4 transactions after the second sync, got %d", got)
+	}
+
+	if got := e.bunq.Calls("/v1/installation"); got != 1 {
+		t.Errorf("Expected the bunq installation to be reused, got %d installations", got)
+	}
+}
+
+func TestE2EFullSyncSkipsDuplicates(t *testing.T) {
+	e := newE2E(t)
+	e.pay(e.bankID, "-12.50", "Albert Heijn", 3)
+	e.pay(e.bankID, "-3.20", "NS", 2)
+
+	e.run(t, "sync", "30")
+	e.run(t, "sync", "--full", "30")
+
+	if got := len(e.ynab.Transactions(e.budgetID, e.accountID)); got != 2 {
+		t.Errorf("Expected no duplicates, got %d transactions", got)
+	}
+
+	// the full sync finds the transactions by import ID and has nothing left to push
+	if got := e.ynab.Calls(http.MethodPost, "/v1/budgets/"+e.budgetID+"/transactions"); got != 1 {
+		t.Errorf("Expected only the first sync to push, got %d pushes", got)
+	}
+
+	// with updates disabled YNAB skips the duplicates itself
+	cfg, err := os.ReadFile(e.config)
+	if err != nil {
+		t.Fatalf("reading config: %v", err)
+	}
+	err = os.WriteFile(e.config, append(cfg, "update:\n  disabled: true\n"...), 0o600)
+	if err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+
+	e.run(t, "sync", "--full", "30")
+
+	if got := len(e.ynab.Transactions(e.budgetID, e.accountID)); got != 2 {
+		t.Errorf("Expected YNAB to skip the duplicates, got %d transactions", got)
+	}
+
+	if got := e.ynab.Calls(http.MethodPost, "/v1/budgets/"+e.budgetID+"/transactions"); got != 2 {
+		t.Errorf("Expected the sync without updates to push, got %d pushes", got)
+	}
+}
+
+func TestE2EPartialFailure(t *testing.T) {
+	e := newE2E(t, "Closed")
+	e.pay(e.bankID, "-12.50", "Albert Heijn", 3)
+
+	err := run([]string{"bunq2ynab", "--config", e.config, "sync", "30"})
+	se, ok := errors.Cause(err).(*sync.SyncError)
+	if !ok || !se.Partial() {
+		t.Fatalf("Expected a partial failure, got %v", err)
+	}
+
+	if got := len(e.ynab.Transactions(e.budgetID, e.accountID)); got != 1 {
+		t.Errorf("Expected the healthy account to sync, got %d transactions", got)
+	}
+}
+
+func TestE2EDryRunDoesNotPush(t *testing.T) {
+	e := newE2E(t)
+	e.pay(e.bankID, "-12.50", "Albert Heijn", 3)
+
+	e.run(t, "sync", "--dry-run", "--output", "json", "30")
+
+	if got := e.ynab.Calls(http.MethodPost, "/v1/budgets/"+e.budgetID+"/transactions"); got != 0 {
+		t.Errorf("Expected no pushes, got %d", got)
+	}
+}
+
+func TestE2EExpiredSessionIsRenewed(t *testing.T) {
+	e := newE2E(t)
+	e.pay(e.bankID, "-12.50", "Albert Heijn", 3)
+	e.run(t, "sync", "30")
+
+	e.bunq.ExpireSessions()
+	e.pay(e.bankID, "-3.20", "NS", 0)
+	e.run(t, "sync", "30")
+
+	if got := len(e.ynab.Transactions(e.budgetID, e.accountID)); got != 2 {
+		t.Errorf("Expected 2 transactions, got %d", got)
+	}
+
+	if e.bunq.Calls("/v1/installation") != 1 || e.bunq.Calls("/v1/session-server") != 2 {
+		t.Errorf("Expected a new session on the same installation, got %d installations and %d sessions",
+			e.bunq.Calls("/v1/installation"), e.bunq.Calls("/v1/session-server"))
+	}
+}
+
+func TestE2ETransferCreatedOnce(t *testing.T) {
+	e := newE2E(t, "Savings")
+	savings := e.bunq.AddAccount(fakebunq.KindSavings, "Savings", "NL00BUNQ0000000002")
+	savingsID := e.ynab.AddAccount(e.budgetID, "Savings")
+
+	e.bunq.AddPayment(e.bankID, fakebunq.Payment{
+		Amount:           decimal.RequireFromString("-100.00"),
+		CounterpartyIBAN: "NL00BUNQ0000000002",
+		CounterpartyName: "Savings",
+	})
+	e.bunq.AddPayment(savings, fakebunq.Payment{
+		Amount:           decimal.RequireFromString("100.00"),
+		CounterpartyIBAN: "NL00BUNQ0000000001",
+		CounterpartyName: "Main",
+	})
+
+	e.run(t, "sync", "30")
+
+	checking := e.ynab.Transactions(e.budgetID, e.accountID)
+	saved := e.ynab.Transactions(e.budgetID, savingsID)
+	if len(checking) != 1 || len(saved) != 1 {
+		t.Fatalf("Expected one transaction on each side, got %d and %d", len(checking), len(saved))
+	}
+
+	if checking[0].TransferAccountID == nil || *checking[0].TransferAccountID != savingsID {
+		t.Errorf("Expected a transfer to savings, got %+v", checking[0])
+	}
+}
+
+func TestE2EQuotaIsTrackedBetweenRuns(t *testing.T) {
+	e := newE2E(t)
+	e.pay(e.bankID, "-12.50", "Albert Heijn", 1)
+
+	e.run(t, "sync", "30")
+	// nothing new to sync, so YNAB isn't asked for anything
+	e.run(t, "sync", "30")
+	e.run(t, "status")
+
+	tr, err := iynab.NewTracker(e.stateDir)
+	if err != nil {
+		t.Fatalf("loading tracker: %v", err)
+	}
+
+	// looking up the budget, account and imported transactions and pushing the payment
+	if q := tr.Quota(); q.Used != 4 || q.Remaining() != 196 {
+		t.Errorf("Expected 4 YNAB requests to be tracked, got %+v", q)
+	}
+}
+
+func TestE2EChangedPaymentIsUpdated(t *testing.T) {
+	e := newE2E(t)
+	id := e.pay(e.bankID, "-10.00", "Albert Heijn", 1)
+
+	e.run(t, "sync", "30")
+
+	importID := "BUNQ:" + strconv.Itoa(id) + ":1"
+	e.ynab.EditTransaction(e.budgetID, importID, "split with Sam")
+	e.bunq.UpdatePayment(id, func(p *fakebunq.Payment) { p.Amount = decimal.RequireFromString("-12.50") })
+
+	e.run(t, "sync", "--full", "30")
+
+	ts := e.ynab.Transactions(e.budgetID, e.accountID)
+	if len(ts) != 1 {
+		t.Fatalf("Expected 1 transaction in YNAB, got %d", len(ts))
+	}
+
+	if ts[0].Amount != -12500 {
+		t.Errorf("Expected the amount to be updated to -12.50, got %d", ts[0].Amount)
+	}
+
+	if *ts[0].Memo != "split with Sam" {
+		t.Errorf("Expected the memo edited in YNAB to be kept, got %q", *ts[0].Memo)
+	}
+}
+
+func TestE2ECardAuthorisationIsSettled(t *testing.T) {
+	e := newE2E(t)
+	settled := e.bunq.AddCardAction(e.bankID, fakebunq.CardAction{
+		Created:          time.Now().AddDate(0, 0, -2),
+		Amount:           decimal.RequireFromString("10.00"),
+		Description:      "Albert Heijn Amsterdam",
+		CounterpartyName: "Albert Heijn",
+	})
+	reversed := e.bunq.AddCardAction(e.bankID, fakebunq.CardAction{
+		Created:          time.Now().AddDate(0, 0, -1),
+		Amount:           decimal.RequireFromString("50.00"),
+		Description:      "Shell Utrecht",
+		CounterpartyName: "Shell",
+	})
+
+	e.run(t, "sync", "30")
+
+	ts := e.ynab.Transactions(e.budgetID, e.accountID)
+	if len(ts) != 2 || ts[0].Cleared != "uncleared" || ts[1].Cleared != "uncleared" {
+		t.Fatalf("Expected both authorisations to be imported uncleared, got %+v", ts)
+	}
+
+	// the payment settles the authorisation at a different amount, the other authorisation is reversed
+	e.bunq.UpdateCardAction(settled, func(a *fakebunq.CardAction) { a.ClearingStatus = "FIRST_PRESENTMENT_COMPLETE" })
+	e.bunq.UpdateCardAction(reversed, func(a *fakebunq.CardAction) { a.AuthorisationStatus = "REVERSED" })
+	e.bunq.AddPayment(e.bankID, fakebunq.Payment{
+		Amount:           decimal.RequireFromString("-12.50"),
+		Description:      "Albert Heijn Amsterdam",
+		Type:             "MASTERCARD",
+		CounterpartyName: "Albert Heijn",
+	})
+
+	e.run(t, "sync", "30")
+
+	ts = e.ynab.Transactions(e.budgetID, e.accountID)
+	if len(ts) != 1 {
+		t.Fatalf("Expected the settled authorisation only, got %+v", ts)
+	}
+
+	if *ts[0].ImportID != "BUNQ:CARD:"+strconv.Itoa(settled)+":1" || ts[0].Cleared != "cleared" || ts[0].Amount != -12500 {
+		t.Errorf("Expected the authorisation to be cleared at the settled amount, got %+v", ts[0])
+	}
+}
+
+func TestE2EShortSyncSettlesOlderAuthorisation(t *testing.T) {
+	e := newE2E(t)
+	settled := e.bunq.AddCardAction(e.bankID, fakebunq.CardAction{
+		Created:          time.Now().AddDate(0, 0, -5),
+		Amount:           decimal.RequireFromString("10.00"),
+		Description:      "Albert Heijn Amsterdam",
+		CounterpartyName: "Albert Heijn",
+	})
+
+	e.run(t, "sync", "30")
+
+	// the payment arrives within the short sync, its authorisation is older than that
+	e.bunq.UpdateCardAction(settled, func(a *fakebunq.CardAction) { a.ClearingStatus = "FIRST_PRESENTMENT_COMPLETE" })
+	e.bunq.AddPayment(e.bankID, fakebunq.Payment{
+		Amount:           decimal.RequireFromString("-10.00"),
+		Description:      "Albert Heijn Amsterdam",
+		Type:             "MASTERCARD",
+		CounterpartyName: "Albert Heijn",
+	})
+
+	e.run(t, "sync", "3")
+
+	ts := e.ynab.Transactions(e.budgetID, e.accountID)
+	if len(ts) != 1 {
+		t.Fatalf("Expected the settled authorisation only, got %+v", ts)
+	}
+
+	if *ts[0].ImportID != "BUNQ:CARD:"+strconv.Itoa(settled)+":1" || ts[0].Cleared != "cleared" {
+		t.Errorf("Expected the authorisation to be cleared, got %+v", ts[0])
+	}
+}
@@ -2,55 +2,101 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 
 	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
 	"github.com/bad33ndj3/bunq2ynab/internal/core/service/sync"
 	"github.com/bad33ndj3/bunq2ynab/internal/driven/bunq"
-	"github.com/bad33ndj3/bunq2ynab/internal/driven/storage/memory/accountstrg"
+	"github.com/bad33ndj3/bunq2ynab/internal/driven/cache"
+	"github.com/bad33ndj3/bunq2ynab/internal/driven/rates"
+	"github.com/bad33ndj3/bunq2ynab/internal/driven/retry"
+	"github.com/bad33ndj3/bunq2ynab/internal/driven/storage/file/statestrg"
 	iynab "github.com/bad33ndj3/bunq2ynab/internal/driven/ynab"
 	"github.com/bad33ndj3/bunq2ynab/internal/driver/cli"
-	"github.com/brunomvsouza/ynab.go"
 	"github.com/cristalhq/acmd"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 )
 
+// Exit codes, so a scheduler can tell a partial failure from a total one.
+const (
+	exitFailure = 1
+	// exitPartial means some accounts synced and others failed.
+	exitPartial = 2
+)
+
 func main() {
-	err := run()
+	err := run(os.Args)
 	if err != nil {
-		log.Fatalf("error: %v", err)
+		log.Printf("error: %v", err)
+		if se, ok := errors.Cause(err).(*sync.SyncError); ok && se.Partial() {
+			os.Exit(exitPartial)
+		}
+		os.Exit(exitFailure)
 	}
 
 	log.Println("Successfully synced!")
 }
 
-func run() error {
-	ctx := context.Background()
-	cfg, err := setupConfig()
+func run(args []string) error {
+	flags := flag.NewFlagSet("bunq2ynab", flag.ContinueOnError)
+	configPath := flags.String("config", "config.yaml", "path of the config file")
+	env := flags.String("env", "", "bunq environment, production or sandbox, overrides bunq_environment")
+	err := flags.Parse(args[1:])
 	if err != nil {
-		return errors.Wrap(err, "setting up config")
+		return errors.Wrap(err, "parsing flags")
 	}
 
-	sv, err := setupSyncService(ctx, cfg)
+	cfg, err := setupConfig(*configPath)
 	if err != nil {
-		return errors.Wrap(err, "setting up sync service")
+		return errors.Wrap(err, "setting up config")
+	}
+
+	if *env != "" {
+		cfg.BunqEnvironment = *env
+	}
+
+	// the sync service opens a bunq session, so it is only set up for the commands that need it
+	var client *cli.Client
+	withClient := func(exec func(ctx context.Context, c *cli.Client, args []string) error) func(context.Context, []string) error {
+		return func(ctx context.Context, args []string) error {
+			if client == nil {
+				sv, err := setupSyncService(ctx, cfg)
+				if err != nil {
+					return errors.Wrap(err, "setting up sync service")
+				}
+				client = cli.NewClient(sv)
+			}
+
+			return exec(ctx, client, args)
+		}
 	}
-	c := cli.NewClient(sv)
 
 	cmds := []acmd.Command{
 		{
 			Name:        "sync",
 			Description: "syncs all transactions from bunq to YNAB, from the given days ago",
-			ExecFunc: func(ctx context.Context, args []string) error {
-				if len(args) != 1 {
+			ExecFunc: withClient(func(ctx context.Context, c *cli.Client, args []string) error {
+				fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+				full := fs.Bool("full", false, "ignore the stored cursors and sync every transaction")
+				migrate := fs.Bool("migrate-import-ids", false, "skip transactions imported with the legacy import IDs")
+				dryRun := fs.Bool("dry-run", false, "print what would be synced without pushing to YNAB")
+				output := fs.String("output", string(cli.FormatTable), "output format of --dry-run, table or json")
+				err := fs.Parse(args)
+				if err != nil {
+					return errors.Wrap(err, "parsing flags")
+				}
+
+				if fs.NArg() != 1 {
 					return errors.New("invalid number of arguments")
 				}
 
-				daysAgo := args[0]
+				daysAgo := fs.Arg(0)
 				days, err := strconv.Atoi(daysAgo)
 				if err != nil {
 					return errors.Wrap(err, "converting days ago to int")
@@ -58,18 +104,38 @@ func run() error {
 
 				now := time.Now()
 
-				err = c.Sync(ctx, now.AddDate(0, 0, -days))
+				opts := sync.Options{
+					From:             now.AddDate(0, 0, -days),
+					Full:             *full,
+					MigrateImportIDs: *migrate,
+				}
+
+				if *dryRun {
+					format, err := cli.FormatFromString(*output)
+					if err != nil {
+						return errors.Wrap(err, "parsing output format")
+					}
+
+					err = c.Plan(ctx, opts, format)
+					if err != nil {
+						return errors.Wrap(err, "planning")
+					}
+
+					return nil
+				}
+
+				err = c.Sync(ctx, opts)
 				if err != nil {
 					return errors.Wrap(err, "syncing")
 				}
 
 				return nil
-			},
+			}),
 		},
 		{
 			Name:        "categories",
 			Description: "print all categories from YNAB",
-			ExecFunc: func(ctx context.Context, args []string) error {
+			ExecFunc: withClient(func(ctx context.Context, c *cli.Client, args []string) error {
 				if len(args) != 1 {
 					return errors.New("invalid number of arguments")
 				}
@@ -79,15 +145,140 @@ func run() error {
 					return errors.Wrap(err, "getting all categories")
 				}
 
+				return nil
+			}),
+		},
+		{
+			Name:        "serve",
+			Description: "keeps syncing on a schedule, and on bunq callbacks, until interrupted",
+			ExecFunc: withClient(func(ctx context.Context, c *cli.Client, args []string) error {
+				serve := cfg.Serve
+				fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+				fs.DurationVar(&serve.Interval, "interval", serve.Interval, "time between syncs")
+				fs.StringVar(&serve.Cron, "cron", serve.Cron, "cron expression for syncs, overrides --interval")
+				fs.DurationVar(&serve.Jitter, "jitter", serve.Jitter, "maximum random delay added to every sync")
+				fs.IntVar(&serve.Days, "days", serve.Days, "how many days back every sync looks")
+				callback := cfg.Callback
+				fs.StringVar(&callback.Listen, "listen", callback.Listen, "address to receive bunq callbacks on, e.g. :8080")
+				err := fs.Parse(args)
+				if err != nil {
+					return errors.Wrap(err, "parsing flags")
+				}
+
+				err = c.Serve(ctx, serve, callback)
+				if err != nil {
+					return errors.Wrap(err, "serving")
+				}
+
+				return nil
+			}),
+		},
+		{
+			Name:        "reconcile",
+			Description: "compares the bunq and YNAB balance of every account",
+			ExecFunc: withClient(func(ctx context.Context, c *cli.Client, args []string) error {
+				fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+				adjust := fs.Bool("adjust", false, "create a YNAB adjustment transaction for every difference")
+				output := fs.String("output", string(cli.FormatTable), "output format, table or json")
+				err := fs.Parse(args)
+				if err != nil {
+					return errors.Wrap(err, "parsing flags")
+				}
+
+				format, err := cli.FormatFromString(*output)
+				if err != nil {
+					return errors.Wrap(err, "parsing output format")
+				}
+
+				err = c.Reconcile(ctx, *adjust, format)
+				if err != nil {
+					return errors.Wrap(err, "reconciling")
+				}
+
+				return nil
+			}),
+		},
+		{
+			Name:        "status",
+			Description: "prints the YNAB request quota and the sync cursor of every account",
+			ExecFunc: func(ctx context.Context, args []string) error {
+				fs := flag.NewFlagSet("status", flag.ContinueOnError)
+				output := fs.String("output", string(cli.FormatTable), "output format, table or json")
+				err := fs.Parse(args)
+				if err != nil {
+					return errors.Wrap(err, "parsing flags")
+				}
+
+				format, err := cli.FormatFromString(*output)
+				if err != nil {
+					return errors.Wrap(err, "parsing output format")
+				}
+
+				sv, err := setupStatusService(cfg)
+				if err != nil {
+					return errors.Wrap(err, "setting up status service")
+				}
+
+				err = cli.NewClient(sv).Status(ctx, format)
+				if err != nil {
+					return errors.Wrap(err, "printing status")
+				}
+
 				return nil
 			},
 		},
+		{
+			Name:        "payees",
+			Description: "work with payee aliases",
+			Subcommands: []acmd.Command{
+				{
+					Name:        "suggest",
+					Description: "suggests payee aliases for bunq payees from the given days ago",
+					ExecFunc: withClient(func(ctx context.Context, c *cli.Client, args []string) error {
+						if len(args) != 1 {
+							return errors.New("invalid number of arguments")
+						}
+
+						days, err := strconv.Atoi(args[0])
+						if err != nil {
+							return errors.Wrap(err, "converting days ago to int")
+						}
+
+						err = c.SuggestPayees(ctx, time.Now().AddDate(0, 0, -days))
+						if err != nil {
+							return errors.Wrap(err, "suggesting payees")
+						}
+
+						return nil
+					}),
+				},
+			},
+		},
+		{
+			Name:        "sandbox",
+			Description: "work with the bunq sandbox",
+			Subcommands: []acmd.Command{
+				{
+					Name:        "bootstrap",
+					Description: "creates a sandbox user with demo payments and prints its config",
+					ExecFunc: func(ctx context.Context, args []string) error {
+						err := sandboxBootstrap(ctx, cfg, os.Stdout)
+						if err != nil {
+							return errors.Wrap(err, "bootstrapping sandbox")
+						}
+
+						return nil
+					},
+				},
+			},
+		},
 	}
 
 	// all the acmd.Config fields are optional
 	r := acmd.RunnerOf(cmds, acmd.Config{
 		AppName:        "bunq2ynab",
 		AppDescription: "syncs bunq transactions to YNAB",
+		Args:           append([]string{args[0]}, flags.Args()...),
 	})
 
 	err = r.Run()
@@ -99,24 +290,80 @@ func run() error {
 }
 
 func setupSyncService(ctx context.Context, cfg *entity.Config) (*sync.Client, error) {
-	bq, err := bunq.NewClient(ctx, cfg.BunqToken)
+	baseURL, err := bunq.BaseURL(cfg.BunqEnvironment, cfg.BunqBaseURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting bunq base URL")
+	}
+
+	bq, err := bunq.NewClient(ctx, baseURL, cfg.BunqToken, filepath.Join(cfg.GetStateDir(), bunq.ContextFile))
 	if err != nil {
 		return nil, errors.Wrap(err, "creating bunq client")
 	}
 
-	yn := iynab.NewClient(ynab.NewClient(cfg.YnabToken))
+	st, err := statestrg.New(cfg.GetStateDir())
+	if err != nil {
+		return nil, errors.Wrap(err, "creating state storage")
+	}
+
+	tracker, err := iynab.NewTracker(cfg.GetStateDir())
+	if err != nil {
+		return nil, errors.Wrap(err, "creating YNAB quota tracker")
+	}
+
+	snapshots, err := iynab.NewSnapshots(cfg.GetStateDir())
+	if err != nil {
+		return nil, errors.Wrap(err, "creating YNAB snapshots")
+	}
+
+	ynabURL := iynab.DefaultBaseURL
+	if cfg.YnabBaseURL != "" {
+		ynabURL = cfg.YnabBaseURL
+	}
+	yn := iynab.NewClient(ynabURL, cfg.YnabToken, tracker, snapshots)
+
+	// both APIs rate limit and have the occasional outage, retry those instead of failing the sync
+	rbq := retry.NewBunq(bq, retry.DefaultPolicy)
+	ryn := retry.NewYnab(yn, retry.DefaultPolicy)
+
+	// cache hits skip the retries as well
+	cyn, err := cache.NewYnab(ryn, cfg.GetStateDir(), cfg.YnabCache)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating YNAB cache")
+	}
+
+	rs, err := rates.New(cfg.Currency)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating exchange rates")
+	}
+
+	sv := sync.NewClient(rbq, st, st, cyn, cfg)
+	sv.SetQuota(tracker)
+	sv.SetPushedStorage(st)
+	sv.SetRates(rs)
+
+	return sv, nil
+}
+
+// setupStatusService creates a sync service that only reads the local state, without bunq and YNAB clients.
+func setupStatusService(cfg *entity.Config) (*sync.Client, error) {
+	st, err := statestrg.New(cfg.GetStateDir())
+	if err != nil {
+		return nil, errors.Wrap(err, "creating state storage")
+	}
 
-	bqs, err := accountstrg.New()
+	tracker, err := iynab.NewTracker(cfg.GetStateDir())
 	if err != nil {
-		return nil, errors.Wrap(err, "creating account storage")
+		return nil, errors.Wrap(err, "creating YNAB quota tracker")
 	}
-	sv := sync.NewClient(bq, bqs, yn, cfg)
+
+	sv := sync.NewClient(nil, st, st, nil, cfg)
+	sv.SetQuota(tracker)
 
 	return sv, nil
 }
 
-func setupConfig() (*entity.Config, error) {
-	dat, err := os.ReadFile("config.yaml")
+func setupConfig(path string) (*entity.Config, error) {
+	dat, err := os.ReadFile(path)
 	if err != nil {
 		return nil, errors.Wrap(err, "reading config file")
 	}
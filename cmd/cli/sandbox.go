@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/bad33ndj3/bunq2ynab/internal/driven/bunq"
+	"github.com/pkg/errors"
+)
+
+// sandboxBootstrap creates a sandbox user, seeds its first bank account with demo
+// payments and prints the config to sync it.
+func sandboxBootstrap(ctx context.Context, cfg *entity.Config, out io.Writer) error {
+	baseURL, err := bunq.BaseURL("sandbox", cfg.BunqBaseURL)
+	if err != nil {
+		return errors.Wrap(err, "getting bunq base URL")
+	}
+
+	apiKey, err := bunq.CreateSandboxUser(ctx, baseURL)
+	if err != nil {
+		return errors.Wrap(err, "creating sandbox user")
+	}
+
+	// the sandbox keeps its cursors and bunq context apart from the production ones
+	sandbox := *cfg
+	sandbox.BunqEnvironment = "sandbox"
+	bq, err := bunq.NewClient(ctx, baseURL, apiKey, filepath.Join(sandbox.GetStateDir(), bunq.ContextFile))
+	if err != nil {
+		return errors.Wrap(err, "creating bunq client")
+	}
+
+	accounts, err := bq.GetAllAccounts(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting all accounts")
+	}
+
+	var account *entity.Account
+	for _, a := range accounts {
+		if a.AccountType == entity.AccountTypeBank {
+			account = a
+			break
+		}
+	}
+	if account == nil {
+		return errors.New("sandbox user has no bank account")
+	}
+
+	err = bq.SeedSandbox(ctx, account.BankID)
+	if err != nil {
+		return errors.Wrap(err, "seeding sandbox")
+	}
+
+	_, err = fmt.Fprintf(out, `# sandbox user created, use these settings in config.yaml
+bunq_environment: sandbox
+bunq_token: %q
+accounts:
+  - bunq_account_name: %q
+    ynab_budget_name: "Your YNAB test budget name"
+    ynab_account_name: "Your YNAB test account name"
+`, apiKey, account.Description)
+	if err != nil {
+		return errors.Wrap(err, "writing config")
+	}
+
+	return nil
+}
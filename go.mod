@@ -3,10 +3,10 @@ module github.com/bad33ndj3/bunq2ynab
 go 1.21
 
 require (
-	github.com/OGKevin/go-bunq v0.3.0
 	github.com/brunomvsouza/ynab.go v1.4.0
 	github.com/cristalhq/acmd v0.11.2
 	github.com/pkg/errors v0.8.1
+	github.com/robfig/cron/v3 v3.0.1
 	github.com/samber/lo v1.39.0
 	github.com/shopspring/decimal v1.3.1
 	go.uber.org/ratelimit v0.3.0
@@ -16,8 +16,5 @@ require (
 
 require (
 	github.com/benbjohnson/clock v1.3.0 // indirect
-	github.com/satori/go.uuid v1.2.0 // indirect
 	golang.org/x/exp v0.0.0-20220303212507-bbda1eaf7a17 // indirect
 )
-
-replace github.com/OGKevin/go-bunq => github.com/bad33ndj3/go-bunq v0.3.1
@@ -1,6 +1,7 @@
 package entity
 
 import (
+	"strconv"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -15,6 +16,10 @@ type Account struct {
 	Description string
 	AccountType AccountType
 	IBAN        string
+	// Balance is the balance of the account when it was fetched.
+	Balance decimal.Decimal
+	// Currency is the currency of the account, e.g. EUR.
+	Currency string
 
 	Transactions []*Transaction
 }
@@ -28,11 +33,127 @@ type Transaction struct {
 
 	Description string
 	Amount      decimal.Decimal
-	Date        time.Time
-	Payee       string
-	Type        PaymentType
-	SubType     PaymentSubType
-	PayeeIBAN   string
+	// Currency is the ISO code of the currency of Amount.
+	Currency  string
+	Date      time.Time
+	Payee     string
+	Type      PaymentType
+	SubType   PaymentSubType
+	PayeeIBAN string
+
+	// Memo is the YNAB memo, rendered from the account's memo template.
+	Memo string
+	// Cleared marks the transaction as cleared in YNAB.
+	Cleared bool
+	// TransferPayeeID is the YNAB transfer payee of the account this transaction
+	// moves money to, set when the counterparty is one of our own synced accounts.
+	TransferPayeeID string
+	// PayeeID is the existing YNAB payee assigned by a payee alias.
+	PayeeID string
+	// CategoryID is the YNAB category assigned by a rule, Category is its "group: name" label.
+	CategoryID string
+	Category   string
+
+	// AuthorisationID is the ID of the card authorisation a card transaction comes from.
+	AuthorisationID int
+	// Pending marks a card authorisation that hasn't been settled by a payment yet.
+	Pending bool
+	// Reversed marks a card authorisation that was reversed or expired without being settled,
+	// it is removed from YNAB when it was imported while pending.
+	Reversed bool
+	// Card is the card a card transaction was made with: the second line printed on it,
+	// or its ID when that is empty.
+	Card string
+
+	// OriginalAmount is the amount paid in OriginalCurrency, for card payments in a foreign currency.
+	OriginalAmount   decimal.Decimal
+	OriginalCurrency string
+	// ExchangeRate is the rate bunq applied to convert OriginalAmount to the account currency.
+	ExchangeRate decimal.Decimal
+	// Fee is the FX fee bunq charged in the account currency, it is part of Amount.
+	Fee decimal.Decimal
+	// FeeCategoryID is the YNAB category of the FX fee split.
+	FeeCategoryID string
+
+	// RoundUps is the number of savings round-ups aggregated into this transaction,
+	// which has no bank ID. It is imported under its SavingsImportID.
+	RoundUps int
+}
+
+// Notification tells a payment or card authorisation was made as it happens. Only the IDs
+// are taken from it, the payment itself is fetched from the bank.
+type Notification struct {
+	// BankID is the ID of the account in the bank.
+	BankID int
+	// PaymentID is the ID of the payment in the bank, 0 for a card authorisation.
+	PaymentID int
+	// AuthorisationID is the ID of the card authorisation, 0 for a payment.
+	AuthorisationID int
+}
+
+// ImportID returns the import ID used by YNAB to prevent duplicate imports.
+// It is based on the bunq payment ID, so every payment maps to exactly one YNAB transaction.
+// Card authorisations that aren't settled yet have no payment, they use their CardImportID,
+// and daily aggregates of savings round-ups use their SavingsImportID.
+// Other transactions that don't come from a bunq payment have no import ID.
+// If you want to import the same transaction multiple times, you can change the importIteration.
+func (t *Transaction) ImportID() string {
+	const importIteration = "1"
+
+	if t.BankID == 0 && t.RoundUps > 0 {
+		return t.SavingsImportID()
+	}
+
+	if t.BankID == 0 {
+		return t.CardImportID()
+	}
+
+	return "BUNQ:" + strconv.Itoa(t.BankID) + ":" + importIteration
+}
+
+// CardImportID returns the import ID of the card authorisation the transaction comes from.
+// A pending authorisation is imported under it, and keeps it once the payment settles it.
+func (t *Transaction) CardImportID() string {
+	const importIteration = "1"
+
+	if t.AuthorisationID == 0 {
+		return ""
+	}
+
+	return "BUNQ:CARD:" + strconv.Itoa(t.AuthorisationID) + ":" + importIteration
+}
+
+// SavingsImportID returns the import ID of the daily aggregate of savings round-ups, based on its date.
+func (t *Transaction) SavingsImportID() string {
+	const importIteration = "1"
+
+	return "BUNQ:SAVINGS:" + t.Date.Format(time.DateOnly) + ":" + importIteration
+}
+
+// FX describes the foreign currency payment, e.g. "USD 12.00 @ 0.915000 + fee 0.06".
+// It is empty for payments in the account currency.
+func (t *Transaction) FX() string {
+	if t.OriginalCurrency == "" {
+		return ""
+	}
+
+	fx := t.OriginalCurrency + " " + t.OriginalAmount.Abs().StringFixed(2)
+	if !t.ExchangeRate.IsZero() {
+		fx += " @ " + t.ExchangeRate.StringFixed(6)
+	}
+	if !t.Fee.IsZero() {
+		fx += " + fee " + t.Fee.Abs().StringFixed(2)
+	}
+
+	return fx
+}
+
+// LegacyImportID returns the import ID used by earlier versions, based on amount and date.
+// Payments with the same amount on the same day share this ID, so only one of them was imported.
+func (t *Transaction) LegacyImportID() string {
+	const importIteration = "1"
+
+	return "YNAB:" + t.Amount.String() + ":" + t.Date.Format("2006-01-02") + ":" + importIteration
 }
 
 // *************************************************************
@@ -48,51 +169,82 @@ func (p PaymentType) String() string {
 }
 
 // PaymentTypeFromString returns a PaymentType from a string.
+// Types bunq sends that aren't modelled here are kept as they are, see Known.
 func PaymentTypeFromString(src string) PaymentType {
-	switch src {
-	case string(PaymentTypePayment):
-		return PaymentTypePayment
-	case string(PaymentTypeIDEAL):
-		return PaymentTypeIDEAL
-	case string(PaymentTypeBUNQ):
-		return PaymentTypeBUNQ
-	case string(PaymentTypeMASTERCARD):
-		return PaymentTypeMASTERCARD
-	case string(PaymentTypeSWIFT):
-		return PaymentTypeSWIFT
-	case string(PaymentTypeSAVINGS):
-		return PaymentTypeSAVINGS
-	case string(PaymentTypePAYDAY):
-		return PaymentTypePAYDAY
-	case string(PaymentTypeINTEREST):
-		return PaymentTypeINTEREST
-	default:
-		return PaymentTypeUnknown
-	}
+	return PaymentType(src)
+}
+
+// Known reports whether the payment type is one of the types modelled here.
+func (p PaymentType) Known() bool {
+	return knownPaymentTypes[p]
 }
 
 // PaymentType is a type that holds different methods of payments.
 const (
-	// PaymentTypeUnknown is an unknown PaymentType.
+	// PaymentTypeUnknown is a payment without a type.
 	PaymentTypeUnknown PaymentType = ""
 	// PaymentTypePayment represents the general payment type.
 	PaymentTypePayment PaymentType = "PAYMENT"
 	// PaymentTypeIDEAL - payment through IDEAL system.
 	PaymentTypeIDEAL PaymentType = "IDEAL"
+	// PaymentTypeSOFORT - payment through the SOFORT system.
+	PaymentTypeSOFORT PaymentType = "SOFORT"
 	// PaymentTypeBUNQ - payment through BUNQ system.
 	PaymentTypeBUNQ PaymentType = "BUNQ"
+	// PaymentTypeEBASCT - SEPA credit transfer to or from another bank.
+	PaymentTypeEBASCT PaymentType = "EBA_SCT"
+	// PaymentTypeEBASDD - SEPA direct debit collected by another bank.
+	PaymentTypeEBASDD PaymentType = "EBA_SDD"
+	// PaymentTypeSEPADirectDebit - SEPA direct debit, as some direct debits are typed.
+	PaymentTypeSEPADirectDebit PaymentType = "SEPA_DIRECT_DEBIT"
 	// PaymentTypeMASTERCARD - payment with MASTERCARD.
 	PaymentTypeMASTERCARD PaymentType = "MASTERCARD"
+	// PaymentTypeMAESTRO - payment with a Maestro card.
+	PaymentTypeMAESTRO PaymentType = "MAESTRO"
+	// PaymentTypeFIS - card payment processed by FIS.
+	PaymentTypeFIS PaymentType = "FIS"
 	// PaymentTypeSWIFT - payment through SWIFT system.
 	PaymentTypeSWIFT PaymentType = "SWIFT"
+	// PaymentTypeCHECKOUT - online payment through bunq checkout.
+	PaymentTypeCHECKOUT PaymentType = "CHECKOUT"
+	// PaymentTypeCHECKOUTMerchant - payment received as a bunq checkout merchant.
+	PaymentTypeCHECKOUTMerchant PaymentType = "CHECKOUT_MERCHANT"
+	// PaymentTypeREQUEST - payment of a bunq request or bunq.me link.
+	PaymentTypeREQUEST PaymentType = "REQUEST"
+	// PaymentTypeREFUND - money refunded by bunq.
+	PaymentTypeREFUND PaymentType = "REFUND"
+	// PaymentTypeINTERNAL - move between accounts within bunq.
+	PaymentTypeINTERNAL PaymentType = "INTERNAL"
 	// PaymentTypeSAVINGS - savings as a form of 'payment'.
 	PaymentTypeSAVINGS PaymentType = "SAVINGS"
-	// PaymentTypePAYDAY - payday loan payment.
+	// PaymentTypePAYDAY - bunq's payday payout.
 	PaymentTypePAYDAY PaymentType = "PAYDAY"
 	// PaymentTypeINTEREST - interest payment.
 	PaymentTypeINTEREST PaymentType = "INTEREST"
 )
 
+var knownPaymentTypes = map[PaymentType]bool{
+	PaymentTypePayment:          true,
+	PaymentTypeIDEAL:            true,
+	PaymentTypeSOFORT:           true,
+	PaymentTypeBUNQ:             true,
+	PaymentTypeEBASCT:           true,
+	PaymentTypeEBASDD:           true,
+	PaymentTypeSEPADirectDebit:  true,
+	PaymentTypeMASTERCARD:       true,
+	PaymentTypeMAESTRO:          true,
+	PaymentTypeFIS:              true,
+	PaymentTypeSWIFT:            true,
+	PaymentTypeCHECKOUT:         true,
+	PaymentTypeCHECKOUTMerchant: true,
+	PaymentTypeREQUEST:          true,
+	PaymentTypeREFUND:           true,
+	PaymentTypeINTERNAL:         true,
+	PaymentTypeSAVINGS:          true,
+	PaymentTypePAYDAY:           true,
+	PaymentTypeINTEREST:         true,
+}
+
 // PaymentSubType is a subcategory of PaymentType.
 type PaymentSubType string
 
@@ -102,22 +254,47 @@ func (p PaymentSubType) String() string {
 }
 
 // PaymentSubTypeFromString converts a string to a PaymentSubType.
-// If the string doesn't match known sub-types, it returns PaymentSubTypeUnknown.
+// Sub-types bunq sends that aren't modelled here are kept as they are, see Known.
 func PaymentSubTypeFromString(src string) PaymentSubType {
-	switch src {
-	case string(PaymentSubTypePayment):
-		return PaymentSubTypePayment
-	default:
-		return PaymentSubTypeUnknown
-	}
+	return PaymentSubType(src)
+}
+
+// Known reports whether the payment sub-type is one of the sub-types modelled here.
+func (p PaymentSubType) Known() bool {
+	return knownPaymentSubTypes[p]
 }
 
 // These are the known PaymentSubTypes.
 const (
 	PaymentSubTypeUnknown PaymentSubType = ""
 	PaymentSubTypePayment PaymentSubType = "PAYMENT"
+	// PaymentSubTypeWithdrawal is a cash withdrawal.
+	PaymentSubTypeWithdrawal PaymentSubType = "WITHDRAWAL"
+	// PaymentSubTypeReversal undoes an earlier payment.
+	PaymentSubTypeReversal PaymentSubType = "REVERSAL"
+	// PaymentSubTypeRequest pays a request.
+	PaymentSubTypeRequest PaymentSubType = "REQUEST"
+	// PaymentSubTypeBilling is a bunq subscription or fee.
+	PaymentSubTypeBilling PaymentSubType = "BILLING"
+	// PaymentSubTypeSCT is a SEPA credit transfer.
+	PaymentSubTypeSCT PaymentSubType = "SCT"
+	// PaymentSubTypeSDD is a SEPA direct debit.
+	PaymentSubTypeSDD PaymentSubType = "SDD"
+	// PaymentSubTypeNLO is a Dutch local payment order.
+	PaymentSubTypeNLO PaymentSubType = "NLO"
 )
 
+var knownPaymentSubTypes = map[PaymentSubType]bool{
+	PaymentSubTypePayment:    true,
+	PaymentSubTypeWithdrawal: true,
+	PaymentSubTypeReversal:   true,
+	PaymentSubTypeRequest:    true,
+	PaymentSubTypeBilling:    true,
+	PaymentSubTypeSCT:        true,
+	PaymentSubTypeSDD:        true,
+	PaymentSubTypeNLO:        true,
+}
+
 // AccountType represents different account types.
 type AccountType string
 
@@ -11,6 +11,10 @@ type Budget struct {
 	// ID is the ID of the budget in YNAB.
 	ID   string
 	Name string
+	// Currency is the ISO code of the budget currency, empty when YNAB doesn't say.
+	Currency string
+	// Decimals is the number of decimal digits amounts in the budget currency have.
+	Decimals int32
 
 	Accounts []*Account
 }
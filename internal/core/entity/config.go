@@ -1,10 +1,148 @@
 package entity
 
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
 // Config is the configuration for the application.
 type Config struct {
-	BunqToken string          `yaml:"bunq_token"`
-	YnabToken string          `yaml:"ynab_token"`
-	Accounts  []ConfigAccount `yaml:"accounts"`
+	BunqToken string `yaml:"bunq_token"`
+	// BunqEnvironment is either production (the default) or sandbox.
+	BunqEnvironment string `yaml:"bunq_environment"`
+	// BunqBaseURL overrides the base URL of the bunq environment, e.g. for a local fake.
+	BunqBaseURL string `yaml:"bunq_base_url"`
+	YnabToken   string `yaml:"ynab_token"`
+	// YnabBaseURL overrides the base URL of the YNAB API, e.g. for a local fake.
+	YnabBaseURL string `yaml:"ynab_base_url"`
+	// StateDir is the directory where the sync state is kept between runs.
+	StateDir string          `yaml:"state_dir"`
+	Accounts []ConfigAccount `yaml:"accounts"`
+	// Rules categorise transactions, the first matching rule wins.
+	Rules []ConfigRule `yaml:"rules"`
+	// Payees rewrite noisy bunq payee names, the first matching alias wins.
+	Payees []ConfigPayee `yaml:"payees"`
+	// Filters leave the transactions they match out of the sync.
+	Filters []ConfigFilter `yaml:"filters"`
+	// MemoTemplate is the default memo template for accounts without their own.
+	MemoTemplate string `yaml:"memo_template"`
+	// Serve configures the schedule of the serve command.
+	Serve ConfigServe `yaml:"serve"`
+	// Callback configures the listener for bunq notification callbacks.
+	Callback ConfigCallback `yaml:"callback"`
+	// YnabCache configures how long YNAB lookups are cached.
+	YnabCache ConfigCache `yaml:"ynab_cache"`
+	// Update configures how transactions already in YNAB are updated when they change in bunq.
+	Update ConfigUpdate `yaml:"update"`
+	// FX configures how foreign currency card payments are imported.
+	FX ConfigFX `yaml:"fx"`
+	// Currency configures converting accounts in another currency than their budget.
+	Currency ConfigCurrency `yaml:"currency"`
+	// Income configures how interest, payday and other payouts by bunq itself are imported.
+	Income ConfigIncome `yaml:"income"`
+}
+
+// ConfigIncome configures the incoming payments that come from bunq itself, like interest.
+// These get a payee and category of their own, categorisation rules can still override the category.
+type ConfigIncome struct {
+	// CategoryGroup and Category name the YNAB category of bank income, "Inflow: Ready to Assign" by default.
+	CategoryGroup string `yaml:"category_group"`
+	Category      string `yaml:"category"`
+	// Payee is the payee of bank income, "bunq" by default.
+	Payee string `yaml:"payee"`
+	// PaymentTypes are the bunq payment types that are bank income, INTEREST and PAYDAY by default.
+	PaymentTypes []string `yaml:"payment_types"`
+}
+
+// ConfigCurrency configures where exchange rates come from. Transactions of an account in
+// another currency than its budget are converted with the first provider that has a rate.
+type ConfigCurrency struct {
+	// Providers are tried in order, out of bunq, file and fixed. All three by default.
+	Providers []string `yaml:"providers"`
+	// Fixed holds rates by currency pair, e.g. "USD/EUR": 0.92. The inverse pair is used as well.
+	Fixed map[string]decimal.Decimal `yaml:"fixed"`
+	// File is a YAML file with rates by currency pair and date, the latest on or before
+	// the date of a transaction is used.
+	File string `yaml:"file"`
+}
+
+// ConfigFX configures foreign currency card payments. The FX fee bunq charges is split off
+// the payment, into the fee category when one is set and uncategorised otherwise.
+type ConfigFX struct {
+	FeeCategoryGroup string `yaml:"fee_category_group"`
+	FeeCategory      string `yaml:"fee_category"`
+}
+
+// ConfigUpdate configures updating transactions that were imported before.
+type ConfigUpdate struct {
+	// Disabled turns updating off, transactions are then only ever created.
+	Disabled bool `yaml:"disabled"`
+	// Owned are the fields bunq2ynab overwrites even when they were edited in YNAB.
+	Owned ConfigOwned `yaml:"owned"`
+}
+
+// ConfigOwned marks the fields owned by bunq2ynab. A field that isn't owned is only updated
+// as long as it wasn't edited in YNAB, the category only while the transaction is uncategorised.
+type ConfigOwned struct {
+	Amount   bool `yaml:"amount"`
+	Memo     bool `yaml:"memo"`
+	Cleared  bool `yaml:"cleared"`
+	Category bool `yaml:"category"`
+}
+
+// ConfigCache holds how long each kind of YNAB lookup is cached, 0 uses the default.
+type ConfigCache struct {
+	Budgets        time.Duration `yaml:"budgets"`
+	Accounts       time.Duration `yaml:"accounts"`
+	Categories     time.Duration `yaml:"categories"`
+	TransferPayees time.Duration `yaml:"transfer_payees"`
+}
+
+// ConfigCallback configures real-time syncing from bunq callbacks.
+// Callbacks are only used by the serve command when Listen is set.
+type ConfigCallback struct {
+	// Listen is the address the callback server listens on, e.g. ":8080".
+	Listen string `yaml:"listen"`
+	// URL is the public URL bunq calls, without the secret path.
+	URL string `yaml:"url"`
+	// Secret is appended to the callback path so only bunq knows the full URL.
+	Secret string `yaml:"secret"`
+	// AllowedNetworks limits callbacks to these CIDRs, bunq publishes the ranges it calls from.
+	AllowedNetworks []string `yaml:"allowed_networks"`
+}
+
+// ConfigServe configures when the serve command syncs.
+// Either Interval or Cron is used, Cron takes precedence.
+type ConfigServe struct {
+	// Interval is the time between the end of a sync and the start of the next.
+	Interval time.Duration `yaml:"interval"`
+	// Cron is a standard 5 field cron expression, e.g. "*/15 * * * *".
+	Cron string `yaml:"cron"`
+	// Jitter is the maximum random delay added to every scheduled sync.
+	Jitter time.Duration `yaml:"jitter"`
+	// Days is how many days back every sync looks.
+	Days int `yaml:"days"`
+}
+
+// DefaultStateDir is used when no state_dir is configured.
+const DefaultStateDir = ".bunq2ynab"
+
+// GetStateDir returns the configured state directory or DefaultStateDir. Every bunq environment
+// but production gets its own directory next to it, e.g. .bunq2ynab-sandbox, so it never shares
+// the bunq context, cursors, quota or cache with production.
+func (c *Config) GetStateDir() string {
+	dir := c.StateDir
+	if dir == "" {
+		dir = DefaultStateDir
+	}
+
+	if c.BunqEnvironment != "" && c.BunqEnvironment != "production" {
+		dir = filepath.Clean(dir) + "-" + c.BunqEnvironment
+	}
+
+	return dir
 }
 
 // ConfigAccount is the configuration for a single account.
@@ -13,4 +151,87 @@ type ConfigAccount struct {
 	BunqAccountName string `yaml:"bunq_account_name"`
 	YnabBudgetName  string `yaml:"ynab_budget_name"`
 	YnabAccountName string `yaml:"ynab_account_name"`
+	// MemoTemplate is a text/template rendered with the entity.Transaction to build the YNAB memo.
+	MemoTemplate string `yaml:"memo_template"`
+	// Savings configures how the savings round-ups of the account are synced.
+	Savings ConfigSavings `yaml:"savings"`
+}
+
+// These are the ways savings round-ups can be synced.
+const (
+	// SavingsModeAggregate imports the round-ups of a day as one transfer to a YNAB account.
+	SavingsModeAggregate = "aggregate"
+	// SavingsModeTransfer imports every round-up as a transfer to a synced bunq savings account.
+	SavingsModeTransfer = "transfer"
+	// SavingsModeDrop leaves round-ups out altogether.
+	SavingsModeDrop = "drop"
+)
+
+// ConfigSavings configures how the SAVINGS payments of an account, bunq's round-ups and
+// auto-save, are synced. Without a mode every round-up is imported like any other payment.
+type ConfigSavings struct {
+	// Mode is aggregate, transfer or drop.
+	Mode string `yaml:"mode"`
+	// YnabAccountName is the YNAB account the daily aggregate is a transfer to, in aggregate mode.
+	YnabAccountName string `yaml:"ynab_account_name"`
+	// BunqAccountName is the synced bunq account round-ups are transfers with, in transfer mode.
+	BunqAccountName string `yaml:"bunq_account_name"`
+}
+
+// ConfigRule assigns a YNAB category to the transactions it matches.
+// All conditions that are set must match, empty conditions match everything.
+type ConfigRule struct {
+	// Name identifies the rule in the sync log.
+	Name string `yaml:"name"`
+
+	// Payee is a regular expression matched against the payee.
+	Payee string `yaml:"payee"`
+	// PayeeIBAN is matched against the IBAN of the counterparty.
+	PayeeIBAN string `yaml:"payee_iban"`
+	// Description is a regular expression matched against the description.
+	Description string `yaml:"description"`
+	// AmountMin and AmountMax bound the amount, inclusive. Outflows are negative.
+	AmountMin *decimal.Decimal `yaml:"amount_min"`
+	AmountMax *decimal.Decimal `yaml:"amount_max"`
+	// PaymentType is matched against the bunq payment type, e.g. MASTERCARD or IDEAL.
+	PaymentType string `yaml:"payment_type"`
+	// PaymentSubType is matched against the bunq payment sub-type, e.g. BILLING or WITHDRAWAL.
+	PaymentSubType string `yaml:"payment_sub_type"`
+	// Account is the bunq account name the transaction belongs to.
+	Account string `yaml:"account"`
+
+	// CategoryGroup and Category name the YNAB category to assign.
+	CategoryGroup string `yaml:"category_group"`
+	Category      string `yaml:"category"`
+}
+
+// ConfigFilter leaves the transactions it matches out of the sync.
+// All conditions that are set must match, a filter needs at least one.
+type ConfigFilter struct {
+	// Name identifies the filter in the sync log.
+	Name string `yaml:"name"`
+	// PaymentType and PaymentSubType are matched against the bunq payment type and sub-type,
+	// types bunq2ynab doesn't know are matched as bunq sends them.
+	PaymentType    string `yaml:"payment_type"`
+	PaymentSubType string `yaml:"payment_sub_type"`
+	// Account is the bunq account name the transaction belongs to.
+	Account string `yaml:"account"`
+}
+
+// ConfigPayee is an alias that replaces the payee of the transactions it matches.
+type ConfigPayee struct {
+	// Name is the payee name sent to YNAB.
+	Name string `yaml:"name"`
+	// Match holds regular expressions matched against the bunq payee name.
+	Match []string `yaml:"match"`
+	// IBANs holds counterparty IBANs that belong to this payee.
+	IBANs []string `yaml:"ibans,omitempty"`
+	// YnabPayeeID is the ID of an existing YNAB payee to use instead of the name.
+	// Payee IDs belong to a single budget, so only set it when syncing into one budget.
+	YnabPayeeID string `yaml:"ynab_payee_id,omitempty"`
+}
+
+// Key returns a unique key for the account, used to store its sync state.
+func (a ConfigAccount) Key() string {
+	return a.BunqAccountName + "|" + a.YnabBudgetName + "|" + a.YnabAccountName
 }
@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// Quota is the use of a rate limited API within its rolling window.
+type Quota struct {
+	Used  int
+	Limit int
+	// ResetAt is when the oldest counted request drops out of the window, zero when nothing was used.
+	ResetAt time.Time
+}
+
+// Remaining returns the number of requests left in the window.
+func (q Quota) Remaining() int {
+	if q.Used >= q.Limit {
+		return 0
+	}
+
+	return q.Limit - q.Used
+}
@@ -0,0 +1,83 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ImportedTransaction is a transaction in the budget that was imported with an import ID.
+type ImportedTransaction struct {
+	// ID is the ID of the transaction in the budget.
+	ID         string
+	ImportID   string
+	Amount     decimal.Decimal
+	Memo       string
+	Cleared    bool
+	CategoryID string
+	// Reconciled and transfer transactions are never updated, of split transactions
+	// only the memo and cleared state are.
+	Reconciled bool
+	Transfer   bool
+	Split      bool
+}
+
+// TransactionUpdate holds the fields to change of a transaction in the budget, nil fields are left alone.
+type TransactionUpdate struct {
+	// ID is the ID of the transaction in the budget.
+	ID string
+	// ImportID is the import ID of the transaction in the budget, for a settled card
+	// payment that is the import ID of its authorisation.
+	ImportID string
+	// Transaction is the bank transaction the update comes from.
+	Transaction *Transaction
+
+	Amount     *decimal.Decimal
+	Memo       *string
+	Cleared    *bool
+	CategoryID *string
+}
+
+// TransactionDelete is a transaction to remove from the budget.
+type TransactionDelete struct {
+	// ID is the ID of the transaction in the budget.
+	ID string
+	// Transaction is the bank transaction the removal comes from.
+	Transaction *Transaction
+}
+
+// Pushed is what was last written to the budget for a transaction. A field that no longer
+// matches it in the budget was edited there, and is only overwritten when it is owned.
+type Pushed struct {
+	Amount     decimal.Decimal `json:"amount"`
+	Memo       string          `json:"memo"`
+	Cleared    bool            `json:"cleared"`
+	CategoryID string          `json:"category_id"`
+	// Date is the date of the transaction, records of old transactions are dropped after a while.
+	Date time.Time `json:"date"`
+	// Authorisation is the state of a card authorisation that wasn't settled when it was
+	// last synced, nil for other transactions.
+	Authorisation *PushedAuthorisation `json:"authorisation,omitempty"`
+}
+
+// PushedAuthorisation is the state in the bank of a card authorisation that isn't settled.
+// Its amount is the one in the bank, before any currency conversion.
+type PushedAuthorisation struct {
+	Amount   decimal.Decimal `json:"amount"`
+	Reversed bool            `json:"reversed"`
+}
+
+// AuthorisationOf returns the state of the card authorisation, nil when the transaction isn't
+// a pending or reversed authorisation.
+func AuthorisationOf(t *Transaction) *PushedAuthorisation {
+	if !t.Pending && !t.Reversed {
+		return nil
+	}
+
+	return &PushedAuthorisation{Amount: t.Amount, Reversed: t.Reversed}
+}
+
+// PushedFrom returns what is written to the budget for the transaction.
+func PushedFrom(t *Transaction) Pushed {
+	return Pushed{Amount: t.Amount, Memo: t.Memo, Cleared: t.Cleared, CategoryID: t.CategoryID, Date: t.Date}
+}
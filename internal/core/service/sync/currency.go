@@ -0,0 +1,48 @@
+package sync
+
+import (
+	"context"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+)
+
+// SetRates makes Sync convert transactions of accounts in another currency than their
+// budget. Without it such transactions fail to sync instead of landing in the wrong currency.
+func (c *Client) SetRates(r Rates) {
+	c.rates = r
+}
+
+// convert converts the transactions in another currency than the budget to the budget
+// currency. The amount in the account currency is kept as the original amount, so the
+// memo shows it, and replaces the original amount of foreign card payments.
+// It fails when the budget currency is unknown, the transactions might be in another one.
+func (c *Client) convert(ctx context.Context, budget *entity.Budget, transactions []*entity.Transaction) error {
+	for _, t := range transactions {
+		if t.Currency == "" || t.Currency == budget.Currency {
+			continue
+		}
+
+		if budget.Currency == "" {
+			return errors.Errorf("currency of budget '%s' is unknown, %s can't be converted", budget.Name, t.Currency)
+		}
+
+		if c.rates == nil {
+			return errors.Errorf("no exchange rates to convert %s to %s", t.Currency, budget.Currency)
+		}
+
+		rate, err := c.rates.Rate(ctx, t, budget.Currency)
+		if err != nil {
+			return errors.Wrapf(err, "getting %s/%s rate", t.Currency, budget.Currency)
+		}
+
+		t.OriginalAmount = t.Amount
+		t.OriginalCurrency = t.Currency
+		t.ExchangeRate = rate
+		t.Amount = t.Amount.Mul(rate).Round(budget.Decimals)
+		t.Fee = t.Fee.Mul(rate).Round(budget.Decimals)
+		t.Currency = budget.Currency
+	}
+
+	return nil
+}
@@ -2,26 +2,79 @@ package sync
 
 import (
 	"context"
+	"time"
 
 	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/shopspring/decimal"
 )
 
 type Bunq interface {
+	// GetTransactions returns all transactions made on or after from with a
+	// bank ID higher than afterID, following pagination until either is reached.
+	// Card payments are dated like the authorisation they settle, which may be before from.
+	// Card authorisations since from that aren't settled are included as pending transactions,
+	// and reversed ones from before from as well; these have no bank ID.
 	GetTransactions(
 		_ context.Context,
 		bankID int,
+		from time.Time,
+		afterID int,
 	) ([]*entity.Transaction, error)
-	GetAllAccounts() ([]*entity.Account, error)
+	GetAllAccounts(ctx context.Context) ([]*entity.Account, error)
+	// GetTransaction returns a single payment of the given account.
+	GetTransaction(ctx context.Context, bankID int, paymentID int) (*entity.Transaction, error)
+	// GetBalance returns the current balance of the given account.
+	GetBalance(ctx context.Context, bankID int) (decimal.Decimal, error)
+	// RegisterNotificationFilters makes the bank call url for every payment on the account.
+	RegisterNotificationFilters(ctx context.Context, bankID int, url string) error
+	// ParseNotification verifies the signature of a callback body and translates it,
+	// it returns nil for callbacks without a transaction.
+	ParseNotification(body []byte, signature string) (*entity.Notification, error)
 }
 
 type Ynab interface {
-	GetBudgetByName(name string) (*entity.Budget, error)
-	GetAccountByName(budgetID string, name string) (*entity.Account, error)
-	PushTransactions(budgetID string, accountID string, transactions []*entity.Transaction) error
+	GetBudgetByName(ctx context.Context, name string) (*entity.Budget, error)
+	GetAccountByName(ctx context.Context, budgetID string, name string) (*entity.Account, error)
+	PushTransactions(ctx context.Context, budgetID string, accountID string, transactions []*entity.Transaction) error
 	GetAllCategories(ctx context.Context, budgetID string) ([]*entity.GroupWithCategories, error)
+	// GetImportedTransactions returns the transactions with an import ID in the account on or after since.
+	GetImportedTransactions(ctx context.Context, budgetID string, accountID string, since time.Time) ([]*entity.ImportedTransaction, error)
+	// UpdateTransactions changes the given fields of transactions in the budget.
+	UpdateTransactions(ctx context.Context, budgetID string, updates []*entity.TransactionUpdate) error
+	// DeleteTransactions removes transactions from the budget.
+	DeleteTransactions(ctx context.Context, budgetID string, deletes []*entity.TransactionDelete) error
+	// GetAccountBalance returns the cleared plus uncleared balance of the account.
+	GetAccountBalance(ctx context.Context, budgetID string, accountID string) (decimal.Decimal, error)
+	// GetTransferPayeeID returns the ID of the payee used to transfer money to the given account.
+	GetTransferPayeeID(ctx context.Context, budgetID string, accountID string) (string, error)
+}
+
+// PushedStorage remembers what was last pushed to YNAB per import ID.
+type PushedStorage interface {
+	// GetPushed returns what was pushed for the import ID, false if nothing is known.
+	GetPushed(ctx context.Context, importID string) (entity.Pushed, bool, error)
+	SavePushed(ctx context.Context, pushed map[string]entity.Pushed) error
+}
+
+// Quota reports how much of the YNAB rate limit is used.
+type Quota interface {
+	Quota() entity.Quota
+}
+
+// Rates provides exchange rates to convert transactions to the currency of their budget.
+type Rates interface {
+	// Rate returns the rate to multiply the amount of the transaction with to get it in currency to.
+	Rate(ctx context.Context, t *entity.Transaction, to string) (decimal.Decimal, error)
 }
 
 type AccountStorage interface {
 	GetAccountByName(ctx context.Context, name string) (*entity.Account, error)
 	SaveAccount(ctx context.Context, b entity.Account) error
 }
+
+// CursorStorage keeps track of the last synced bunq payment per configured account.
+type CursorStorage interface {
+	// GetCursor returns the last synced bank ID, or 0 if the account was never synced.
+	GetCursor(ctx context.Context, account entity.ConfigAccount) (int, error)
+	SaveCursor(ctx context.Context, account entity.ConfigAccount, bankID int) error
+}
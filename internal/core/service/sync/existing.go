@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"log/slog"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+)
+
+// splitExisting splits the transactions into those that still need to be created and
+// those that are already in YNAB, matched on the given import IDs.
+// A settled card payment also matches the import ID of its authorisation, which was
+// imported while it was pending.
+//
+// With legacy set, transactions imported under their legacy import ID are matched too.
+// A legacy import ID is shared by all payments with the same amount on the same day, but only
+// one of them was accepted by YNAB. Each legacy import ID found therefore accounts for a single
+// transaction, any others sharing it are still created.
+func splitExisting(
+	transactions []*entity.Transaction,
+	importIDs []string,
+	legacy bool,
+) (create, existing []*entity.Transaction) {
+	known := make(map[string]bool, len(importIDs))
+	for _, id := range importIDs {
+		known[id] = true
+	}
+
+	for _, t := range transactions {
+		if known[t.ImportID()] || t.AuthorisationID != 0 && known[t.CardImportID()] {
+			existing = append(existing, t)
+			continue
+		}
+
+		id := t.LegacyImportID()
+		if legacy && t.BankID != 0 && known[id] {
+			delete(known, id)
+			slog.Info("Skipping transaction imported with legacy import ID", slog.String("import_id", id))
+			existing = append(existing, t)
+			continue
+		}
+
+		create = append(create, t)
+	}
+
+	return create, existing
+}
+
+// splitReversed takes the reversed card authorisations out of the plan's creates and
+// existing transactions. Those in YNAB are deleted, unless they were reconciled there,
+// the others are filtered.
+func splitReversed(plan *Plan, imported []*entity.ImportedTransaction) {
+	byImportID := make(map[string]*entity.ImportedTransaction, len(imported))
+	for _, it := range imported {
+		byImportID[it.ImportID] = it
+	}
+
+	create := plan.Create[:0]
+	for _, t := range plan.Create {
+		if t.Reversed {
+			plan.Filtered = append(plan.Filtered, t)
+			continue
+		}
+		create = append(create, t)
+	}
+	plan.Create = create
+
+	existing := plan.Existing[:0]
+	for _, t := range plan.Existing {
+		if !t.Reversed {
+			existing = append(existing, t)
+			continue
+		}
+
+		it := byImportID[t.ImportID()]
+		if it == nil || it.Reconciled {
+			plan.Filtered = append(plan.Filtered, t)
+			continue
+		}
+
+		plan.Delete = append(plan.Delete, &entity.TransactionDelete{ID: it.ID, Transaction: t})
+	}
+	plan.Existing = existing
+}
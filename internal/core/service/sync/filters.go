@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+)
+
+// LoadFilters checks the configured filters.
+// Filters are only applied by Sync and callbacks once they are loaded.
+func (c *Client) LoadFilters() error {
+	for i, cfg := range c.cfg.Filters {
+		if cfg.PaymentType == "" && cfg.PaymentSubType == "" && cfg.Account == "" {
+			return fmt.Errorf("filter %d '%s': needs at least one condition", i+1, cfg.Name)
+		}
+
+		warnUnknownTypes(cfg.Name, cfg.PaymentType, cfg.PaymentSubType)
+	}
+
+	c.filters = c.cfg.Filters
+	slog.Info("Loaded filters", slog.Int("count", len(c.filters)))
+
+	return nil
+}
+
+// filtered reports whether a loaded filter leaves the transaction of the account out.
+func (c *Client) filtered(account entity.ConfigAccount, t *entity.Transaction) bool {
+	for _, f := range c.filters {
+		if f.Account != "" && f.Account != account.BunqAccountName {
+			continue
+		}
+
+		if matchesPaymentType(f.PaymentType, f.PaymentSubType, t) {
+			slog.Debug("Filtered transaction", slog.String("filter", f.Name), slog.Int("bank_id", t.BankID))
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesPaymentType reports whether the transaction has the payment type and sub-type,
+// ignoring case. An empty type or sub-type matches any.
+func matchesPaymentType(paymentType, subType string, t *entity.Transaction) bool {
+	return (paymentType == "" || strings.EqualFold(paymentType, t.Type.String())) &&
+		(subType == "" || strings.EqualFold(subType, t.SubType.String()))
+}
+
+// warnUnknownTypes warns about payment types and sub-types that aren't modelled, which are
+// still matched as bunq sends them but may as well be typos.
+func warnUnknownTypes(name, paymentType, subType string) {
+	if paymentType != "" && !entity.PaymentTypeFromString(strings.ToUpper(paymentType)).Known() {
+		slog.Warn("Unknown payment type, matching it as is", slog.String("name", name), slog.String("type", paymentType))
+	}
+
+	if subType != "" && !entity.PaymentSubTypeFromString(strings.ToUpper(subType)).Known() {
+		slog.Warn("Unknown payment sub-type, matching it as is", slog.String("name", name), slog.String("sub_type", subType))
+	}
+}
@@ -0,0 +1,53 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+)
+
+// LoadFX resolves the configured FX fee category in every budget. Until it is loaded,
+// FX fees are split off uncategorised.
+func (c *Client) LoadFX(ctx context.Context) error {
+	fx := c.cfg.FX
+	if fx.FeeCategory == "" {
+		return nil
+	}
+
+	ids := make(map[string]string)
+	for _, account := range c.cfg.Accounts {
+		if _, ok := ids[account.YnabBudgetName]; ok {
+			continue
+		}
+
+		categories, err := c.GetAllCategories(ctx, account.YnabBudgetName)
+		if err != nil {
+			return errors.Wrapf(err, "getting categories of budget '%s'", account.YnabBudgetName)
+		}
+
+		id, ok := findCategory(categories, fx.FeeCategoryGroup, fx.FeeCategory)
+		if !ok {
+			return fmt.Errorf("FX fee category '%s: %s' not found in budget '%s'",
+				fx.FeeCategoryGroup, fx.FeeCategory, account.YnabBudgetName)
+		}
+
+		ids[account.YnabBudgetName] = id
+	}
+
+	c.feeCategoryIDs = ids
+	slog.Info("Loaded FX fee category", slog.String("category", fx.FeeCategoryGroup+": "+fx.FeeCategory))
+
+	return nil
+}
+
+// categorizeFees assigns the FX fee category to the transactions with an FX fee.
+func (c *Client) categorizeFees(account entity.ConfigAccount, transactions []*entity.Transaction) {
+	for _, t := range transactions {
+		if !t.Fee.IsZero() {
+			t.FeeCategoryID = c.feeCategoryIDs[account.YnabBudgetName]
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// These are used for bank income when the income section of the config leaves them out.
+const (
+	// DefaultIncomeCategory is YNAB's category for money that is yet to be budgeted.
+	DefaultIncomeCategory = "Inflow: Ready to Assign"
+	DefaultIncomePayee    = "bunq"
+)
+
+// DefaultIncomeTypes are the payment types of bank income when none are configured.
+var DefaultIncomeTypes = []entity.PaymentType{entity.PaymentTypeINTEREST, entity.PaymentTypePAYDAY}
+
+// MonthlyInterest is the interest an account received in a month.
+type MonthlyInterest struct {
+	// Month is the first day of the month.
+	Month  time.Time
+	Amount decimal.Decimal
+}
+
+// LoadIncome resolves the configured bank income category in every budget, so a category
+// that doesn't exist fails before a sync. The default category is only looked up once bank
+// income shows up, and where it is missing bank income stays uncategorised.
+func (c *Client) LoadIncome(ctx context.Context) error {
+	income := c.cfg.Income
+	if income.Category == "" {
+		return nil
+	}
+
+	ids := make(map[string]string)
+	for _, account := range c.cfg.Accounts {
+		if _, ok := ids[account.YnabBudgetName]; ok {
+			continue
+		}
+
+		categories, err := c.GetAllCategories(ctx, account.YnabBudgetName)
+		if err != nil {
+			return errors.Wrapf(err, "getting categories of budget '%s'", account.YnabBudgetName)
+		}
+
+		id, ok := findCategory(categories, income.CategoryGroup, income.Category)
+		if !ok {
+			return fmt.Errorf("income category '%s: %s' not found in budget '%s'",
+				income.CategoryGroup, income.Category, account.YnabBudgetName)
+		}
+
+		ids[account.YnabBudgetName] = id
+	}
+
+	c.incomeMu.Lock()
+	c.incomeCategoryIDs = ids
+	c.incomeMu.Unlock()
+	slog.Info("Loaded income category", slog.String("category", incomeCategory(income)))
+
+	return nil
+}
+
+// incomeCategoryID returns the ID of the bank income category in the budget, empty when the
+// default category doesn't exist there.
+func (c *Client) incomeCategoryID(ctx context.Context, budgetName string) (string, error) {
+	c.incomeMu.Lock()
+	defer c.incomeMu.Unlock()
+
+	if id, ok := c.incomeCategoryIDs[budgetName]; ok || c.cfg.Income.Category != "" {
+		return id, nil
+	}
+
+	categories, err := c.GetAllCategories(ctx, budgetName)
+	if err != nil {
+		return "", errors.Wrapf(err, "getting categories of budget '%s'", budgetName)
+	}
+
+	id, ok := findCategory(categories, "", DefaultIncomeCategory)
+	if !ok {
+		slog.Warn("Income category not found, bank income stays uncategorised",
+			slog.String("budget", budgetName), slog.String("category", DefaultIncomeCategory))
+	}
+
+	if c.incomeCategoryIDs == nil {
+		c.incomeCategoryIDs = make(map[string]string)
+	}
+	c.incomeCategoryIDs[budgetName] = id
+
+	return id, nil
+}
+
+// isIncome reports whether the transaction is money paid out by bunq itself.
+func (c *Client) isIncome(t *entity.Transaction) bool {
+	if !t.Amount.IsPositive() {
+		return false
+	}
+
+	if len(c.cfg.Income.PaymentTypes) == 0 {
+		for _, pt := range DefaultIncomeTypes {
+			if t.Type == pt {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	for _, pt := range c.cfg.Income.PaymentTypes {
+		if strings.EqualFold(pt, t.Type.String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// markIncome gives bank income the income payee and category. It runs before the rules,
+// so those can match on the income payee and override the category.
+func (c *Client) markIncome(ctx context.Context, account entity.ConfigAccount, transactions []*entity.Transaction) error {
+	payee := c.cfg.Income.Payee
+	if payee == "" {
+		payee = DefaultIncomePayee
+	}
+
+	for _, t := range transactions {
+		if t.TransferPayeeID != "" || !c.isIncome(t) {
+			continue
+		}
+
+		id, err := c.incomeCategoryID(ctx, account.YnabBudgetName)
+		if err != nil {
+			return errors.Wrap(err, "getting income category")
+		}
+
+		t.Payee = payee
+		t.PayeeID = ""
+		if id != "" {
+			t.CategoryID = id
+			t.Category = incomeCategory(c.cfg.Income)
+		}
+	}
+
+	return nil
+}
+
+// incomeCategory returns the "group: name" label of the income category.
+func incomeCategory(income entity.ConfigIncome) string {
+	if income.Category == "" {
+		return DefaultIncomeCategory
+	}
+
+	return income.CategoryGroup + ": " + income.Category
+}
+
+// interestByMonth sums the interest among the transactions per month, oldest month first.
+func interestByMonth(transactions ...[]*entity.Transaction) []*MonthlyInterest {
+	byMonth := make(map[time.Time]*MonthlyInterest)
+	var res []*MonthlyInterest
+	for _, ts := range transactions {
+		for _, t := range ts {
+			if t.Type != entity.PaymentTypeINTEREST {
+				continue
+			}
+
+			month := time.Date(t.Date.Year(), t.Date.Month(), 1, 0, 0, 0, 0, t.Date.Location())
+			mi, ok := byMonth[month]
+			if !ok {
+				mi = &MonthlyInterest{Month: month}
+				byMonth[month] = mi
+				res = append(res, mi)
+			}
+
+			mi.Amount = mi.Amount.Add(t.Amount)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].Month.Before(res[j].Month) })
+
+	return res
+}
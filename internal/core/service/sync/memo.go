@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxMemoLength is the maximum number of characters YNAB accepts in a memo.
+	maxMemoLength = 200
+
+	// defaultMemoTemplate prefixes the description with the start of the payee,
+	// and adds the original amount, rate and fee of foreign currency payments.
+	defaultMemoTemplate = `{{truncate 6 .Payee}}: {{.Description}}{{with .FX}} ({{.}}){{end}}`
+)
+
+var (
+	memoFuncs = template.FuncMap{
+		"truncate": truncate,
+	}
+
+	defaultMemo = template.Must(template.New("memo").Funcs(memoFuncs).Parse(defaultMemoTemplate))
+)
+
+// LoadMemoTemplates parses the configured memo templates.
+// Until they are loaded, Sync uses the default template for every account.
+func (c *Client) LoadMemoTemplates() error {
+	fallback := defaultMemo
+	if c.cfg.MemoTemplate != "" {
+		var err error
+		fallback, err = parseMemoTemplate(c.cfg.MemoTemplate)
+		if err != nil {
+			return errors.Wrap(err, "parsing memo template")
+		}
+	}
+
+	memos := make(map[string]*template.Template, len(c.cfg.Accounts))
+	for _, account := range c.cfg.Accounts {
+		if account.MemoTemplate == "" {
+			memos[account.Key()] = fallback
+			continue
+		}
+
+		tmpl, err := parseMemoTemplate(account.MemoTemplate)
+		if err != nil {
+			return errors.Wrapf(err, "parsing memo template of account '%s'", account.BunqAccountName)
+		}
+
+		memos[account.Key()] = tmpl
+	}
+
+	c.memos = memos
+
+	return nil
+}
+
+// parseMemoTemplate parses the template and renders it once, so templates
+// referring to unknown fields fail at startup instead of halfway a sync.
+func parseMemoTemplate(src string) (*template.Template, error) {
+	tmpl, err := template.New("memo").Funcs(memoFuncs).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tmpl.Execute(&strings.Builder{}, &entity.Transaction{})
+	if err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// renderMemos sets the memo of each transaction using the account's memo template.
+func (c *Client) renderMemos(account entity.ConfigAccount, transactions []*entity.Transaction) error {
+	tmpl, ok := c.memos[account.Key()]
+	if !ok {
+		tmpl = defaultMemo
+	}
+
+	for _, t := range transactions {
+		var sb strings.Builder
+		err := tmpl.Execute(&sb, t)
+		if err != nil {
+			return errors.Wrapf(err, "rendering memo of transaction %d", t.BankID)
+		}
+
+		t.Memo = truncate(maxMemoLength, strings.TrimSpace(sb.String()))
+	}
+
+	return nil
+}
+
+// truncate shortens s to at most n characters without splitting a UTF-8 character.
+func truncate(n int, s string) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+
+	return string(runes[:n])
+}
@@ -0,0 +1,167 @@
+package sync
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+)
+
+// RegisterCallbacks makes bunq call url for every payment on the configured accounts.
+func (c *Client) RegisterCallbacks(ctx context.Context, url string) error {
+	registered := make(map[int]bool)
+	for _, account := range c.cfg.Accounts {
+		acc, err := c.GetAccountByName(ctx, account.BunqAccountName)
+		if err != nil {
+			return errors.Wrapf(err, "getting account '%s'", account.BunqAccountName)
+		}
+
+		if registered[acc.BankID] {
+			continue
+		}
+
+		err = c.bu.RegisterNotificationFilters(ctx, acc.BankID, url)
+		if err != nil {
+			return errors.Wrapf(err, "registering callback for account '%s'", account.BunqAccountName)
+		}
+
+		registered[acc.BankID] = true
+		slog.Info("Registered callback", slog.String("account", account.BunqAccountName))
+	}
+
+	return nil
+}
+
+// defaultCallbackDays is how many days back the sync of a card callback looks,
+// unless SetCallbackDays is called. It is the default window of a scheduled sync.
+const defaultCallbackDays = 30
+
+// SetCallbackDays sets how many days back the sync of a card callback looks, it should be
+// the window of the scheduled syncs so a callback never moves a cursor past what they'd sync.
+func (c *Client) SetCallbackDays(days int) {
+	c.callbackDays = days
+}
+
+// HandleNotification syncs the payment or card authorisation in a bunq callback to every
+// configured account it belongs to. The callback body is only trusted for the IDs once its
+// signature is verified, the payment is fetched from bunq.
+//
+// A payment is pushed on its own, filtered payments and round-ups that are dropped or aggregated
+// are skipped. The cursors are left alone, the next scheduled sync catches up and YNAB skips the
+// payments pushed here by their import ID. Card payments and authorisations have to be matched
+// to the other authorisations of the account, so with updates enabled the whole account is synced.
+// With updates disabled card authorisations aren't imported, so their callbacks are ignored.
+func (c *Client) HandleNotification(ctx context.Context, body []byte, signature string) error {
+	n, err := c.bu.ParseNotification(body, signature)
+	if err != nil {
+		return errors.Wrap(err, "parsing notification")
+	}
+
+	if n == nil {
+		slog.Debug("Ignoring notification without payment")
+		return nil
+	}
+
+	var t *entity.Transaction
+	for _, account := range c.cfg.Accounts {
+		acc, err := c.GetAccountByName(ctx, account.BunqAccountName)
+		if err != nil {
+			return errors.Wrapf(err, "getting account '%s'", account.BunqAccountName)
+		}
+
+		if acc.BankID != n.BankID {
+			continue
+		}
+
+		if t == nil && n.PaymentID != 0 {
+			t, err = c.bu.GetTransaction(ctx, n.BankID, n.PaymentID)
+			if err != nil {
+				return errors.Wrapf(err, "getting payment %d", n.PaymentID)
+			}
+		}
+
+		card := t == nil || t.Type == entity.PaymentTypeMASTERCARD
+		switch {
+		case card && !c.cfg.Update.Disabled:
+			err = c.syncCallbackAccount(ctx, account)
+			if err != nil {
+				return errors.Wrapf(err, "syncing account '%s'", account.BunqAccountName)
+			}
+		case t == nil:
+			slog.Debug("Ignoring card authorisation, updates are disabled", slog.Int("id", n.AuthorisationID))
+		default:
+			err = c.pushNotification(ctx, account, *t)
+			if err != nil {
+				return errors.Wrapf(err, "pushing to account '%s'", account.BunqAccountName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// syncCallbackAccount syncs the account like a scheduled sync would, over the callback window.
+func (c *Client) syncCallbackAccount(ctx context.Context, account entity.ConfigAccount) error {
+	days := c.callbackDays
+	if days <= 0 {
+		days = defaultCallbackDays
+	}
+
+	plan, stage, err := c.syncAccount(ctx, account, Options{From: time.Now().AddDate(0, 0, -days)})
+	if err != nil {
+		return &AccountError{Account: account, Stage: stage, Err: err}
+	}
+
+	slog.Info("Synced account for card callback",
+		slog.String("account", account.BunqAccountName), slog.Int("created", len(plan.Create)))
+
+	return nil
+}
+
+func (c *Client) pushNotification(ctx context.Context, account entity.ConfigAccount, t entity.Transaction) error {
+	if c.filtered(account, &t) {
+		slog.Info("Skipping filtered transaction", slog.Int("bank_id", t.BankID))
+		return nil
+	}
+
+	if skipsSavings(account, &t) {
+		slog.Info("Skipping round-up", slog.Int("bank_id", t.BankID))
+		return nil
+	}
+
+	yb, err := c.yn.GetBudgetByName(ctx, account.YnabBudgetName)
+	if err != nil {
+		return errors.Wrap(err, "getting budget by name")
+	}
+
+	ya, err := c.yn.GetAccountByName(ctx, yb.ID, account.YnabAccountName)
+	if err != nil {
+		return errors.Wrap(err, "getting account by name")
+	}
+
+	t.BudgetID = yb.ID
+	create, _, err := c.prepare(ctx, account, yb, []*entity.Transaction{&t})
+	if err != nil {
+		return errors.Wrap(err, "preparing transaction")
+	}
+
+	if len(create) == 0 {
+		slog.Info("Skipping transfer counterpart", slog.Int("bank_id", t.BankID))
+		return nil
+	}
+
+	err = c.yn.PushTransactions(ctx, yb.ID, ya.BudgetID, create)
+	if err != nil {
+		return errors.Wrap(err, "pushing transactions")
+	}
+
+	if !c.cfg.Update.Disabled {
+		c.savePushed(ctx, create, nil)
+	}
+
+	slog.Info("Pushed notified transaction", slog.String("account", account.BunqAccountName), slog.Int("bank_id", t.BankID))
+
+	return nil
+}
@@ -0,0 +1,250 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+)
+
+// payeeAlias is a compiled entity.ConfigPayee.
+type payeeAlias struct {
+	cfg   entity.ConfigPayee
+	match []*regexp.Regexp
+	ibans map[string]bool
+}
+
+// LoadPayees compiles the configured payee aliases.
+// Aliases are only applied by Sync once they are loaded.
+func (c *Client) LoadPayees() error {
+	aliases := make([]*payeeAlias, 0, len(c.cfg.Payees))
+	for i, cfg := range c.cfg.Payees {
+		if cfg.Name == "" {
+			return fmt.Errorf("payee alias %d: name is required", i+1)
+		}
+
+		a := &payeeAlias{cfg: cfg, ibans: make(map[string]bool)}
+		for _, m := range cfg.Match {
+			re, err := regexp.Compile(m)
+			if err != nil {
+				return errors.Wrapf(err, "payee alias %d '%s': compiling match", i+1, cfg.Name)
+			}
+
+			a.match = append(a.match, re)
+		}
+
+		for _, iban := range cfg.IBANs {
+			a.ibans[normalizeIBAN(iban)] = true
+		}
+
+		aliases = append(aliases, a)
+	}
+
+	c.payees = aliases
+
+	return nil
+}
+
+func (a *payeeAlias) matches(t *entity.Transaction) bool {
+	if t.PayeeIBAN != "" && a.ibans[normalizeIBAN(t.PayeeIBAN)] {
+		return true
+	}
+
+	for _, re := range a.match {
+		if re.MatchString(t.Payee) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Client) payeeAliasFor(t *entity.Transaction) *payeeAlias {
+	for _, a := range c.payees {
+		if a.matches(t) {
+			return a
+		}
+	}
+
+	return nil
+}
+
+// normalizePayees replaces the payee of each transaction with its first matching alias.
+// Transfers are left alone, they already use the transfer payee.
+func (c *Client) normalizePayees(transactions []*entity.Transaction) {
+	for _, t := range transactions {
+		if t.TransferPayeeID != "" {
+			continue
+		}
+
+		a := c.payeeAliasFor(t)
+		if a == nil {
+			continue
+		}
+
+		slog.Debug("Renamed payee", slog.String("from", t.Payee), slog.String("to", a.cfg.Name))
+		t.Payee = a.cfg.Name
+		t.PayeeID = a.cfg.YnabPayeeID
+	}
+}
+
+// SuggestPayees looks at the payees of all configured accounts since from and proposes an
+// alias for each group of payee names that look like the same counterparty. Names are grouped
+// when they share a counterparty IBAN or start with the same word. Payees already covered by
+// a loaded alias are skipped.
+func (c *Client) SuggestPayees(ctx context.Context, from time.Time) ([]entity.ConfigPayee, error) {
+	counts := make(map[string]int)
+	ibans := make(map[string]map[string]bool)
+	seen := make(map[string]bool)
+	for _, account := range c.cfg.Accounts {
+		if seen[account.BunqAccountName] {
+			continue
+		}
+		seen[account.BunqAccountName] = true
+
+		ba, err := c.GetAccountWithTransactions(ctx, account.BunqAccountName, from, 0)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting account with transactions")
+		}
+
+		for _, t := range ba.Transactions {
+			if t.Date.Before(from) || t.Payee == "" || c.payeeAliasFor(t) != nil {
+				continue
+			}
+
+			counts[t.Payee]++
+			if t.PayeeIBAN != "" {
+				if ibans[t.Payee] == nil {
+					ibans[t.Payee] = make(map[string]bool)
+				}
+				ibans[t.Payee][normalizeIBAN(t.PayeeIBAN)] = true
+			}
+		}
+	}
+
+	groups := groupPayees(counts, ibans)
+
+	suggestions := make([]entity.ConfigPayee, 0, len(groups))
+	for _, names := range groups {
+		if len(names) < 2 {
+			continue
+		}
+
+		// the most used name is the most likely to be recognised
+		sort.Slice(names, func(i, j int) bool {
+			if counts[names[i]] != counts[names[j]] {
+				return counts[names[i]] > counts[names[j]]
+			}
+			return names[i] < names[j]
+		})
+
+		suggestion := entity.ConfigPayee{Name: cleanPayeeName(names[0])}
+		groupIBANs := make(map[string]bool)
+		for _, name := range names {
+			suggestion.Match = append(suggestion.Match, "^"+regexp.QuoteMeta(name)+"$")
+			for iban := range ibans[name] {
+				groupIBANs[iban] = true
+			}
+		}
+
+		for iban := range groupIBANs {
+			suggestion.IBANs = append(suggestion.IBANs, iban)
+		}
+		sort.Strings(suggestion.IBANs)
+
+		suggestions = append(suggestions, suggestion)
+	}
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		return suggestions[i].Name < suggestions[j].Name
+	})
+
+	return suggestions, nil
+}
+
+// groupPayees groups payee names that share an IBAN or a payeeKey.
+func groupPayees(counts map[string]int, ibans map[string]map[string]bool) [][]string {
+	parent := make(map[string]string, len(counts))
+	var find func(string) string
+	find = func(n string) string {
+		if parent[n] != n {
+			parent[n] = find(parent[n])
+		}
+		return parent[n]
+	}
+
+	byLink := make(map[string]string)
+	link := func(name, key string) {
+		other, ok := byLink[key]
+		if !ok {
+			byLink[key] = name
+			return
+		}
+		parent[find(name)] = find(other)
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		parent[name] = name
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if key := payeeKey(name); key != "" {
+			link(name, "name:"+key)
+		}
+		for iban := range ibans[name] {
+			link(name, "iban:"+iban)
+		}
+	}
+
+	grouped := make(map[string][]string)
+	for _, name := range names {
+		root := find(name)
+		grouped[root] = append(grouped[root], name)
+	}
+
+	groups := make([][]string, 0, len(grouped))
+	for _, g := range grouped {
+		groups = append(groups, g)
+	}
+
+	return groups
+}
+
+// payeeKey returns the lower cased first word of the name, ignoring numbers and punctuation.
+// Short words are too ambiguous to group on, for those it returns an empty key.
+func payeeKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if len(words) == 0 || len([]rune(words[0])) < 2 {
+		return ""
+	}
+
+	return words[0]
+}
+
+// cleanPayeeName strips words containing digits, like store numbers, from the name.
+func cleanPayeeName(name string) string {
+	var words []string
+	for _, w := range strings.Fields(name) {
+		if strings.IndexFunc(w, unicode.IsDigit) == -1 {
+			words = append(words, w)
+		}
+	}
+
+	if len(words) == 0 {
+		return name
+	}
+
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,98 @@
+package sync
+
+import (
+	"context"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+)
+
+// quotaReserve is the number of YNAB requests a sync leaves unused,
+// so commands run by hand keep working while a daemon is syncing.
+const quotaReserve = 5
+
+// checkQuota returns an error when syncing the account could run into the YNAB rate limit.
+// The cursor isn't moved for a deferred account, so the next sync picks it up.
+func (c *Client) checkQuota(account entity.ConfigAccount, opts Options, transactions []*entity.Transaction) error {
+	if c.quota == nil {
+		return nil
+	}
+
+	q := c.quota.Quota()
+	need := c.estimateRequests(account, opts, transactions)
+	if q.Remaining() >= need+quotaReserve {
+		return nil
+	}
+
+	return errors.Errorf("deferred until %s, %d of %d YNAB requests left and up to %d needed",
+		q.ResetAt.Format(time.TimeOnly), q.Remaining(), q.Limit, need)
+}
+
+// estimateRequests returns the most YNAB requests syncing the transactions of the account can take.
+func (c *Client) estimateRequests(account entity.ConfigAccount, opts Options, transactions []*entity.Transaction) int {
+	// the budget and account lookups
+	n := 2
+	update := !c.cfg.Update.Disabled
+	if opts.DryRun || opts.MigrateImportIDs || update {
+		n++
+	}
+
+	// the push and the update
+	if !opts.DryRun {
+		n++
+		if update {
+			n++
+		}
+
+		// reversed card authorisations are removed one at a time
+		for _, t := range transactions {
+			if t.Reversed {
+				n++
+			}
+		}
+	}
+
+	// every transfer target needs its account and transfer payee looked up
+	for _, other := range c.cfg.Accounts {
+		if other.BunqAccountName != account.BunqAccountName && other.YnabBudgetName == account.YnabBudgetName {
+			n += 2
+		}
+	}
+
+	return n
+}
+
+// Status is the local sync state, it is read without calling bunq or YNAB.
+type Status struct {
+	// Quota is nil when YNAB usage isn't tracked.
+	Quota    *entity.Quota
+	Accounts []AccountStatus
+}
+
+// AccountStatus is the sync state of a single configured account.
+type AccountStatus struct {
+	Account entity.ConfigAccount
+	// Cursor is the last synced bunq payment ID, 0 if the account was never synced.
+	Cursor int
+}
+
+// Status returns the YNAB quota and the cursor of every configured account.
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	st := &Status{}
+	if c.quota != nil {
+		q := c.quota.Quota()
+		st.Quota = &q
+	}
+
+	for _, account := range c.cfg.Accounts {
+		cursor, err := c.cs.GetCursor(ctx, account)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting cursor")
+		}
+
+		st.Accounts = append(st.Accounts, AccountStatus{Account: account, Cursor: cursor})
+	}
+
+	return st, nil
+}
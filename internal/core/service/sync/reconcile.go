@@ -0,0 +1,127 @@
+package sync
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// reconcilePayee is the payee YNAB itself uses for reconciliation adjustments.
+	reconcilePayee = "Reconciliation Balance Adjustment"
+	reconcileMemo  = "Balance adjustment by bunq2ynab reconcile"
+)
+
+// Reconciliation compares the balance of a bunq account with its YNAB account.
+type Reconciliation struct {
+	Account entity.ConfigAccount
+	// BankBalance is the current balance in bunq, in the budget currency.
+	BankBalance decimal.Decimal
+	// OriginalBankBalance and OriginalCurrency are the balance in bunq before it was converted
+	// to the budget currency, they are only set for accounts in another currency.
+	OriginalBankBalance decimal.Decimal
+	OriginalCurrency    string
+	// BudgetBalance is the cleared plus uncleared balance in YNAB.
+	BudgetBalance decimal.Decimal
+	// Difference is BankBalance minus BudgetBalance.
+	Difference decimal.Decimal
+	// Adjusted is set when an adjustment transaction was created for the difference.
+	Adjusted bool
+}
+
+// Reconcile compares the bunq and YNAB balance of every configured account.
+// With adjust set, a cleared adjustment transaction is created in YNAB for every difference.
+func (c *Client) Reconcile(ctx context.Context, adjust bool) ([]*Reconciliation, error) {
+	var res []*Reconciliation
+	for _, account := range c.cfg.Accounts {
+		r, err := c.reconcileAccount(ctx, account, adjust)
+		if err != nil {
+			return res, errors.Wrapf(err, "reconciling account '%s'", account.BunqAccountName)
+		}
+
+		res = append(res, r)
+	}
+
+	return res, nil
+}
+
+func (c *Client) reconcileAccount(
+	ctx context.Context,
+	account entity.ConfigAccount,
+	adjust bool,
+) (*Reconciliation, error) {
+	ba, err := c.GetAccountByName(ctx, account.BunqAccountName)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting account by name")
+	}
+
+	bankBalance, err := c.bu.GetBalance(ctx, ba.BankID)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting bank balance")
+	}
+
+	yb, err := c.yn.GetBudgetByName(ctx, account.YnabBudgetName)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting budget by name")
+	}
+
+	ya, err := c.yn.GetAccountByName(ctx, yb.ID, account.YnabAccountName)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting account by name")
+	}
+
+	budgetBalance, err := c.yn.GetAccountBalance(ctx, yb.ID, ya.BudgetID)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting budget balance")
+	}
+
+	// the balance is converted at today's rate like a transaction, so the difference includes
+	// the change in value of the balance since its transactions were converted
+	balance := &entity.Transaction{Amount: bankBalance, Currency: ba.Currency, Date: time.Now()}
+	err = c.convert(ctx, yb, []*entity.Transaction{balance})
+	if err != nil {
+		return nil, errors.Wrap(err, "converting bank balance")
+	}
+
+	r := &Reconciliation{
+		Account:             account,
+		BankBalance:         balance.Amount,
+		OriginalBankBalance: balance.OriginalAmount,
+		OriginalCurrency:    balance.OriginalCurrency,
+		BudgetBalance:       budgetBalance,
+		Difference:          balance.Amount.Sub(budgetBalance),
+	}
+
+	slog.Info("Reconciled account",
+		slog.String("account", account.BunqAccountName),
+		slog.String("bank", r.BankBalance.String()),
+		slog.String("budget", r.BudgetBalance.String()),
+		slog.String("difference", r.Difference.String()),
+	)
+
+	if !adjust || r.Difference.IsZero() {
+		return r, nil
+	}
+
+	adjustment := &entity.Transaction{
+		BudgetID: yb.ID,
+		Amount:   r.Difference,
+		Date:     time.Now(),
+		Payee:    reconcilePayee,
+		Memo:     reconcileMemo,
+		Cleared:  true,
+	}
+
+	err = c.yn.PushTransactions(ctx, yb.ID, ya.BudgetID, []*entity.Transaction{adjustment})
+	if err != nil {
+		return nil, errors.Wrap(err, "pushing adjustment")
+	}
+
+	r.Adjusted = true
+
+	return r, nil
+}
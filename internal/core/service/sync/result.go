@@ -0,0 +1,63 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+)
+
+// Stage is the step of an account sync.
+type Stage string
+
+// These are the stages of an account sync, in order.
+const (
+	StageCursor Stage = "cursor"
+	StageFetch  Stage = "fetch"
+	// StageQuota means the account was deferred to keep within the YNAB rate limit.
+	StageQuota      Stage = "quota"
+	StageLookup     Stage = "lookup"
+	StagePrepare    Stage = "prepare"
+	StageExisting   Stage = "existing"
+	StagePush       Stage = "push"
+	StageUpdate     Stage = "update"
+	StageDelete     Stage = "delete"
+	StageSaveCursor Stage = "save cursor"
+)
+
+// AccountError is the failure of a single configured account.
+type AccountError struct {
+	Account entity.ConfigAccount
+	Stage   Stage
+	Err     error
+}
+
+func (e *AccountError) Error() string {
+	return fmt.Sprintf("syncing account '%s' failed at %s: %v", e.Account.BunqAccountName, e.Stage, e.Err)
+}
+
+// Cause returns the underlying error, for errors.Cause.
+func (e *AccountError) Cause() error {
+	return e.Err
+}
+
+// SyncError is returned when one or more accounts failed, the other accounts did sync.
+type SyncError struct {
+	Failed []*AccountError
+	// Synced is the number of accounts that synced without error.
+	Synced int
+}
+
+func (e *SyncError) Error() string {
+	msgs := make([]string, 0, len(e.Failed))
+	for _, f := range e.Failed {
+		msgs = append(msgs, f.Error())
+	}
+
+	return fmt.Sprintf("%d of %d accounts failed: %s", len(e.Failed), len(e.Failed)+e.Synced, strings.Join(msgs, "; "))
+}
+
+// Partial reports whether some accounts did sync.
+func (e *SyncError) Partial() bool {
+	return e.Synced > 0
+}
@@ -0,0 +1,172 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+)
+
+// rule is a compiled entity.ConfigRule.
+type rule struct {
+	cfg         entity.ConfigRule
+	payee       *regexp.Regexp
+	description *regexp.Regexp
+	// categoryIDs holds the ID of the rule's category per YNAB budget name.
+	categoryIDs map[string]string
+}
+
+// LoadRules compiles the configured rules and resolves their categories in every budget
+// they can apply to. It fails on the first rule that is invalid or names an unknown account or category.
+// Rules are only applied by Sync once they are loaded.
+func (c *Client) LoadRules(ctx context.Context) error {
+	categories := make(map[string][]*entity.GroupWithCategories)
+	rules := make([]*rule, 0, len(c.cfg.Rules))
+	for i, cfg := range c.cfg.Rules {
+		r, err := compileRule(cfg)
+		if err != nil {
+			return errors.Wrapf(err, "compiling rule %d '%s'", i+1, cfg.Name)
+		}
+
+		budgets := c.ruleBudgets(cfg)
+		if cfg.Account != "" && len(budgets) == 0 {
+			return fmt.Errorf("rule %d '%s': account '%s' is not configured", i+1, cfg.Name, cfg.Account)
+		}
+
+		for _, budgetName := range budgets {
+			if _, ok := categories[budgetName]; !ok {
+				categories[budgetName], err = c.GetAllCategories(ctx, budgetName)
+				if err != nil {
+					return errors.Wrapf(err, "getting categories of budget '%s'", budgetName)
+				}
+			}
+
+			id, ok := findCategory(categories[budgetName], cfg.CategoryGroup, cfg.Category)
+			if !ok {
+				return fmt.Errorf("rule %d '%s': category '%s: %s' not found in budget '%s'",
+					i+1, cfg.Name, cfg.CategoryGroup, cfg.Category, budgetName)
+			}
+
+			r.categoryIDs[budgetName] = id
+		}
+
+		rules = append(rules, r)
+	}
+
+	c.rules = rules
+	slog.Info("Loaded categorisation rules", slog.Int("count", len(rules)))
+
+	return nil
+}
+
+func compileRule(cfg entity.ConfigRule) (*rule, error) {
+	if cfg.Category == "" {
+		return nil, errors.New("category is required")
+	}
+
+	r := &rule{cfg: cfg, categoryIDs: make(map[string]string)}
+	warnUnknownTypes(cfg.Name, cfg.PaymentType, cfg.PaymentSubType)
+
+	var err error
+	if cfg.Payee != "" {
+		r.payee, err = regexp.Compile(cfg.Payee)
+		if err != nil {
+			return nil, errors.Wrap(err, "compiling payee")
+		}
+	}
+
+	if cfg.Description != "" {
+		r.description, err = regexp.Compile(cfg.Description)
+		if err != nil {
+			return nil, errors.Wrap(err, "compiling description")
+		}
+	}
+
+	return r, nil
+}
+
+// ruleBudgets returns the names of the budgets the rule can apply to.
+func (c *Client) ruleBudgets(cfg entity.ConfigRule) []string {
+	var budgets []string
+	seen := make(map[string]bool)
+	for _, account := range c.cfg.Accounts {
+		if cfg.Account != "" && cfg.Account != account.BunqAccountName {
+			continue
+		}
+
+		if !seen[account.YnabBudgetName] {
+			seen[account.YnabBudgetName] = true
+			budgets = append(budgets, account.YnabBudgetName)
+		}
+	}
+
+	return budgets
+}
+
+func findCategory(groups []*entity.GroupWithCategories, groupName, name string) (string, bool) {
+	for _, g := range groups {
+		if groupName != "" && g.Name != groupName {
+			continue
+		}
+
+		for _, cat := range g.Categories {
+			if cat.Name == name {
+				return cat.ID, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func (r *rule) matches(account entity.ConfigAccount, t *entity.Transaction) bool {
+	cfg := r.cfg
+	switch {
+	case cfg.Account != "" && cfg.Account != account.BunqAccountName:
+		return false
+	case r.payee != nil && !r.payee.MatchString(t.Payee):
+		return false
+	case cfg.PayeeIBAN != "" && normalizeIBAN(cfg.PayeeIBAN) != normalizeIBAN(t.PayeeIBAN):
+		return false
+	case r.description != nil && !r.description.MatchString(t.Description):
+		return false
+	case cfg.AmountMin != nil && t.Amount.LessThan(*cfg.AmountMin):
+		return false
+	case cfg.AmountMax != nil && t.Amount.GreaterThan(*cfg.AmountMax):
+		return false
+	case !matchesPaymentType(cfg.PaymentType, cfg.PaymentSubType, t):
+		return false
+	default:
+		return true
+	}
+}
+
+// categorize assigns the category of the first matching rule to each transaction.
+// Transfers are left alone, YNAB does not categorise transfers between budget accounts.
+func (c *Client) categorize(account entity.ConfigAccount, transactions []*entity.Transaction) {
+	for _, t := range transactions {
+		if t.TransferPayeeID != "" {
+			continue
+		}
+
+		for _, r := range c.rules {
+			if !r.matches(account, t) {
+				continue
+			}
+
+			t.CategoryID = r.categoryIDs[account.YnabBudgetName]
+			t.Category = r.cfg.CategoryGroup + ": " + r.cfg.Category
+			slog.Info("Categorised transaction",
+				slog.String("rule", r.cfg.Name),
+				slog.String("category", t.Category),
+				slog.String("payee", t.Payee),
+				slog.String("amount", t.Amount.String()),
+			)
+
+			break
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package sync
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/shopspring/decimal"
+)
+
+// validateSavings fails when the savings handling of the account is incomplete.
+// In transfer mode the savings account has to be another configured account in the same budget.
+func validateSavings(account entity.ConfigAccount, accounts []entity.ConfigAccount) error {
+	s := account.Savings
+	switch s.Mode {
+	case "", entity.SavingsModeDrop:
+		return nil
+	case entity.SavingsModeAggregate:
+		if s.YnabAccountName == "" {
+			return fmt.Errorf("savings mode '%s' needs a ynab_account_name", s.Mode)
+		}
+	case entity.SavingsModeTransfer:
+		if s.BunqAccountName == "" {
+			return fmt.Errorf("savings mode '%s' needs a bunq_account_name", s.Mode)
+		}
+
+		for _, other := range accounts {
+			if other.BunqAccountName == s.BunqAccountName && other.YnabBudgetName == account.YnabBudgetName &&
+				other.Key() != account.Key() {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("savings account '%s' is not a configured account in budget '%s'",
+			s.BunqAccountName, account.YnabBudgetName)
+	default:
+		return fmt.Errorf("unknown savings mode '%s'", s.Mode)
+	}
+
+	return nil
+}
+
+// skipsSavings reports whether the savings payment is left out of callbacks, since it is
+// either dropped or only synced as part of the aggregate of its day.
+func skipsSavings(account entity.ConfigAccount, t *entity.Transaction) bool {
+	mode := account.Savings.Mode
+
+	return t.Type == entity.PaymentTypeSAVINGS && (mode == entity.SavingsModeDrop || mode == entity.SavingsModeAggregate)
+}
+
+// splitSavings takes the round-ups out of the transactions in drop and aggregate mode.
+// Dropped round-ups are returned as filtered, the others as roundUps to aggregate.
+func splitSavings(
+	account entity.ConfigAccount,
+	transactions []*entity.Transaction,
+) (rest, roundUps, filtered []*entity.Transaction) {
+	for _, t := range transactions {
+		switch {
+		case !skipsSavings(account, t):
+			rest = append(rest, t)
+		case account.Savings.Mode == entity.SavingsModeDrop:
+			filtered = append(filtered, t)
+		default:
+			roundUps = append(roundUps, t)
+		}
+	}
+
+	return rest, roundUps, filtered
+}
+
+// aggregateRoundUps sums the round-ups per day into one transaction. Only complete days are
+// aggregated: round-ups of today are held, they go into tomorrow's aggregate, and those of
+// a day that started before from are filtered, since the earlier ones of that day are missing.
+func aggregateRoundUps(
+	account entity.ConfigAccount,
+	roundUps []*entity.Transaction,
+	from time.Time,
+	now time.Time,
+) (aggregates, held, filtered []*entity.Transaction) {
+	byDay := make(map[string]*entity.Transaction)
+	for _, t := range roundUps {
+		day := startOfDay(t.Date)
+		if !day.Before(startOfDay(now.In(day.Location()))) {
+			held = append(held, t)
+			continue
+		}
+
+		if day.Before(from) {
+			filtered = append(filtered, t)
+			continue
+		}
+
+		agg, ok := byDay[day.Format(time.DateOnly)]
+		if !ok {
+			agg = &entity.Transaction{
+				BudgetID: t.BudgetID,
+				Amount:   decimal.Zero,
+				Currency: t.Currency,
+				Date:     day,
+				Payee:    account.Savings.YnabAccountName,
+				Type:     entity.PaymentTypeSAVINGS,
+			}
+			byDay[day.Format(time.DateOnly)] = agg
+			aggregates = append(aggregates, agg)
+		}
+
+		agg.Amount = agg.Amount.Add(t.Amount)
+		agg.RoundUps++
+		agg.Description = strconv.Itoa(agg.RoundUps) + " round-ups"
+	}
+
+	return aggregates, held, filtered
+}
+
+// heldCursor keeps the cursor before the earliest held round-up, so the next sync fetches it again.
+func heldCursor(last int, held []*entity.Transaction) int {
+	for _, t := range held {
+		if t.BankID <= last {
+			last = t.BankID - 1
+		}
+	}
+
+	return last
+}
+
+// dayStart returns the start of the day of t. Payment dates may be in UTC rather than the
+// zone of t, so the earlier of both starts is returned to cover the whole day in either.
+func dayStart(t time.Time) time.Time {
+	start := startOfDay(t)
+	if utc := startOfDay(t.UTC()); utc.Before(start) {
+		return utc
+	}
+
+	return start
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -3,6 +3,8 @@ package sync
 import (
 	"context"
 	"fmt"
+	gosync "sync"
+	"text/template"
 	"time"
 
 	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
@@ -12,32 +14,94 @@ import (
 
 type Service interface {
 	// Sync syncs all transactions from bunq to YNAB from the given date.
-	// There is a limit of 200 transactions per request.
+	// Older pages of transactions are fetched until the from date is reached.
 	// It has rate limiting that will wait till the next request can be made.
-	Sync(ctx context.Context, from time.Time) error
+	// The returned plans describe what was, or with opts.DryRun would be, synced per account.
+	Sync(ctx context.Context, opts Options) ([]*Plan, error)
+}
+
+// Options configures a single sync run.
+type Options struct {
+	// From is the date from which transactions are synced.
+	From time.Time
+	// Full ignores the stored cursors and syncs every transaction since From.
+	Full bool
+	// MigrateImportIDs skips transactions that were already imported under the legacy import ID scheme.
+	// Accounts without a stored cursor always do.
+	MigrateImportIDs bool
+	// DryRun builds the plans without pushing transactions or moving the cursors.
+	DryRun bool
+}
+
+// Plan describes the sync of a single configured account.
+type Plan struct {
+	Account entity.ConfigAccount
+	// Create holds the transactions that are pushed to YNAB.
+	Create []*entity.Transaction
+	// Existing holds the transactions that are already in YNAB, matched by import ID.
+	// It is only filled for dry runs, when migrating import IDs and when updates are enabled.
+	Existing []*entity.Transaction
+	// Update holds the changes to existing transactions that changed in bunq.
+	Update []*entity.TransactionUpdate
+	// Delete holds the reversed card authorisations that are removed from YNAB.
+	Delete []*entity.TransactionDelete
+	// Filtered holds the transactions that are before the from date or the cursor or match
+	// a filter, the card authorisations that can't be reconciled or didn't change since the
+	// last sync and the round-ups that are dropped or held for the aggregate of their day.
+	Filtered []*entity.Transaction
+	// Counterparts holds incoming transfers from other synced accounts,
+	// YNAB creates these as the other side of the outgoing transfer.
+	Counterparts []*entity.Transaction
+	// Interest sums the interest among the created and existing transactions per month.
+	Interest []*MonthlyInterest
+	// Err is set when the account failed to sync.
+	Err *AccountError
 }
 
 type Client struct {
 	bu  Bunq
 	bus AccountStorage
+	cs  CursorStorage
 	yn  Ynab
 	cfg *entity.Config
+
+	rules   []*rule
+	payees  []*payeeAlias
+	filters []entity.ConfigFilter
+	memos   map[string]*template.Template
+	quota   Quota
+	ps      PushedStorage
+	// feeCategoryIDs holds the ID of the FX fee category per YNAB budget name.
+	feeCategoryIDs map[string]string
+	rates          Rates
+	// incomeCategoryIDs holds the ID of the bank income category per YNAB budget name,
+	// callbacks can look it up while a sync runs.
+	incomeCategoryIDs map[string]string
+	incomeMu          gosync.Mutex
+	// callbackDays is how many days back the sync of a card callback looks.
+	callbackDays int
 }
 
-func NewClient(bu Bunq, bus AccountStorage, yn Ynab, cfg *entity.Config) *Client {
+func NewClient(bu Bunq, bus AccountStorage, cs CursorStorage, yn Ynab, cfg *entity.Config) *Client {
 	return &Client{
 		bu:  bu,
 		bus: bus,
+		cs:  cs,
 		yn:  yn,
 		cfg: cfg,
 	}
 }
 
+// SetQuota makes Sync defer accounts when the YNAB rate limit is nearly used up.
+func (c *Client) SetQuota(q Quota) {
+	c.quota = q
+}
+
 func (c *Client) GetAllCategories(
 	ctx context.Context,
 	budgetName string,
 ) ([]*entity.GroupWithCategories, error) {
-	budget, err := c.yn.GetBudgetByName(budgetName)
+	budget, err := c.yn.GetBudgetByName(ctx, budgetName)
 	if err != nil {
 		return nil, errors.Wrap(err, "getting budget by name")
 	}
@@ -51,63 +115,337 @@ func (c *Client) GetAllCategories(
 }
 
 // Sync syncs all transactions from bunq to YNAB.
-func (c *Client) Sync(ctx context.Context, from time.Time) error {
+// Unless opts.Full is set, only transactions newer than the stored cursor are synced.
+// An account that fails doesn't stop the others, the failures are returned as a *SyncError
+// and every plan of a failed account has Err set.
+// When ctx is cancelled the account in flight is given finishTimeout to finish and the
+// remaining accounts are skipped.
+func (c *Client) Sync(ctx context.Context, opts Options) ([]*Plan, error) {
+	var plans []*Plan
+	res := &SyncError{}
 	for _, account := range c.cfg.Accounts {
-		ba, err := c.GetAccountWithTransactions(ctx, account.BunqAccountName)
+		// stop between accounts, so an account is never left half synced
+		if err := ctx.Err(); err != nil {
+			return plans, errors.Wrap(err, "sync interrupted")
+		}
+
+		accountCtx, cancel := finishing(ctx)
+		plan, stage, err := c.syncAccount(accountCtx, account, opts)
+		cancel()
+		if err != nil {
+			plan.Err = &AccountError{Account: account, Stage: stage, Err: err}
+			res.Failed = append(res.Failed, plan.Err)
+			slog.Error("Syncing account failed",
+				slog.String("account", account.BunqAccountName),
+				slog.String("stage", string(stage)),
+				slog.String("error", err.Error()))
+		} else {
+			res.Synced++
+		}
+
+		plans = append(plans, plan)
+	}
+
+	if len(res.Failed) > 0 {
+		return plans, res
+	}
+
+	return plans, nil
+}
+
+// finishTimeout is how long the account in flight may take to finish once the sync is cancelled.
+const finishTimeout = 30 * time.Second
+
+// finishing returns a context that is only cancelled finishTimeout after ctx is,
+// so a shutdown doesn't abort an account halfway.
+func finishing(ctx context.Context) (context.Context, context.CancelFunc) {
+	detached, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	stop := context.AfterFunc(ctx, func() {
+		time.AfterFunc(finishTimeout, cancel)
+	})
+
+	return detached, func() {
+		stop()
+		cancel()
+	}
+}
+
+// syncAccount syncs a single account. The returned plan is never nil, on error it holds
+// what was known when the given stage failed.
+func (c *Client) syncAccount(
+	ctx context.Context,
+	account entity.ConfigAccount,
+	opts Options,
+) (*Plan, Stage, error) {
+	plan := &Plan{Account: account}
+
+	// round-ups are aggregated per day, so the first day of the window is synced whole
+	if account.Savings.Mode == entity.SavingsModeAggregate {
+		opts.From = dayStart(opts.From)
+	}
+
+	var cursor int
+	if !opts.Full {
+		var err error
+		cursor, err = c.cs.GetCursor(ctx, account)
 		if err != nil {
-			return errors.Wrap(err, "getting account with transactions")
+			return plan, StageCursor, errors.Wrap(err, "getting cursor")
+		}
+
+		// an account without a cursor was never synced by this version, so transactions
+		// imported under the legacy import IDs are looked up to not import them twice
+		if cursor == 0 {
+			opts.MigrateImportIDs = true
+		}
+	}
+
+	ba, err := c.GetAccountWithTransactions(ctx, account.BunqAccountName, opts.From, cursor)
+	if err != nil {
+		return plan, StageFetch, errors.Wrap(err, "getting account with transactions")
+	}
+
+	slog.Info("----------------------------------------")
+	slog.Info("Syncing account", slog.String("account", account.BunqAccountName), slog.Int("cursor", cursor))
+
+	update := !c.cfg.Update.Disabled
+	var skipped []*entity.Transaction
+	for _, transaction := range ba.Transactions {
+		// card authorisations have no bank ID, they are synced again until they settle; card
+		// transactions are dated like their authorisation, the bank filtered them on their own date
+		if transaction.Date.Before(opts.From) && transaction.AuthorisationID == 0 ||
+			transaction.BankID != 0 && transaction.BankID <= cursor {
+			plan.Filtered = append(plan.Filtered, transaction)
+			continue
 		}
 
-		yb, err := c.yn.GetBudgetByName(account.YnabBudgetName)
+		// without updates a pending authorisation would never be cleared or removed
+		if (transaction.Pending || transaction.Reversed) && !update {
+			plan.Filtered = append(plan.Filtered, transaction)
+			continue
+		}
+
+		// authorisations come back every sync until they settle, only changed ones need YNAB
+		unchanged, err := c.authorisationUnchanged(ctx, transaction)
 		if err != nil {
-			return errors.Wrap(err, "getting budget by name")
+			return plan, StageExisting, errors.Wrap(err, "checking card authorisation")
+		}
+		if unchanged {
+			plan.Filtered = append(plan.Filtered, transaction)
+			continue
 		}
 
-		ya, err := c.yn.GetAccountByName(yb.ID, account.YnabAccountName)
+		if c.filtered(account, transaction) {
+			plan.Filtered = append(plan.Filtered, transaction)
+			skipped = append(skipped, transaction)
+			continue
+		}
+
+		plan.Create = append(plan.Create, transaction)
+	}
+
+	err = validateSavings(account, c.cfg.Accounts)
+	if err != nil {
+		return plan, StagePrepare, err
+	}
+
+	// round-ups are aggregated before anything else, so a day counts as one transaction everywhere
+	var roundUps, dropped []*entity.Transaction
+	plan.Create, roundUps, dropped = splitSavings(account, plan.Create)
+	aggregates, held, incomplete := aggregateRoundUps(account, roundUps, opts.From, time.Now())
+	plan.Filtered = append(plan.Filtered, dropped...)
+	plan.Filtered = append(plan.Filtered, held...)
+	plan.Filtered = append(plan.Filtered, incomplete...)
+	// filtered payments and dropped or aggregated round-ups move the cursor like pushed
+	// payments, held round-ups keep it back
+	skipped = append(skipped, dropped...)
+	last := lastBankID(plan.Create, lastBankID(roundUps, lastBankID(skipped, cursor)))
+	last = heldCursor(last, held)
+	plan.Create = append(plan.Create, aggregates...)
+
+	// YNAB is only asked for anything when there is something to sync, which keeps syncs within its rate limit
+	if len(plan.Create) == 0 {
+		slog.Info("No transactions to sync")
+		// filtered payments and dropped round-ups still move the cursor
+		if last > cursor && !opts.DryRun {
+			err = c.cs.SaveCursor(ctx, account, last)
+			if err != nil {
+				return plan, StageSaveCursor, errors.Wrap(err, "saving cursor")
+			}
+		}
+
+		return plan, "", nil
+	}
+
+	err = c.checkQuota(account, opts, plan.Create)
+	if err != nil {
+		return plan, StageQuota, err
+	}
+
+	yb, err := c.yn.GetBudgetByName(ctx, account.YnabBudgetName)
+	if err != nil {
+		return plan, StageLookup, errors.Wrap(err, "getting budget by name")
+	}
+
+	ya, err := c.yn.GetAccountByName(ctx, yb.ID, account.YnabAccountName)
+	if err != nil {
+		return plan, StageLookup, errors.Wrap(err, "getting account by name")
+	}
+
+	for _, transaction := range plan.Create {
+		transaction.BudgetID = yb.ID
+	}
+
+	authorisations := authorisationsOf(plan.Create)
+	plan.Create, plan.Counterparts, err = c.prepare(ctx, account, yb, plan.Create)
+	if err != nil {
+		return plan, StagePrepare, errors.Wrap(err, "preparing transactions")
+	}
+
+	if (opts.DryRun || opts.MigrateImportIDs || update) && len(plan.Create) > 0 {
+		imported, err := c.yn.GetImportedTransactions(ctx, yb.ID, ya.BudgetID, earliestDate(plan.Create))
 		if err != nil {
-			return errors.Wrap(err, "getting account by name")
+			return plan, StageExisting, errors.Wrap(err, "getting imported transactions")
 		}
-		slog.Info("----------------------------------------")
-		slog.Info("Syncing account", slog.String("account", account.BunqAccountName))
 
-		var transactions []*entity.Transaction
-		for _, transaction := range ba.Transactions {
-			if transaction.Date.Before(from) {
-				continue
+		importIDs := make([]string, 0, len(imported))
+		for _, it := range imported {
+			importIDs = append(importIDs, it.ImportID)
+		}
+		plan.Create, plan.Existing = splitExisting(plan.Create, importIDs, opts.MigrateImportIDs)
+		splitReversed(plan, imported)
+
+		if update {
+			plan.Update, err = c.planUpdates(ctx, plan.Existing, imported)
+			if err != nil {
+				return plan, StageExisting, errors.Wrap(err, "planning updates")
 			}
+		}
+	}
 
-			transaction.BudgetID = yb.ID
+	plan.Interest = interestByMonth(plan.Create, plan.Existing)
 
-			transactions = append(transactions, transaction)
+	if opts.DryRun {
+		slog.Info("Planned transactions",
+			slog.Int("create", len(plan.Create)),
+			slog.Int("update", len(plan.Update)),
+			slog.Int("delete", len(plan.Delete)),
+			slog.Int("existing", len(plan.Existing)))
+		return plan, "", nil
+	}
+
+	if len(plan.Create) > 0 {
+		err = c.yn.PushTransactions(ctx, yb.ID, ya.BudgetID, plan.Create)
+		if err != nil {
+			return plan, StagePush, errors.Wrap(err, "pushing transactions")
 		}
+	}
 
-		if len(transactions) == 0 {
-			slog.Info("No transactions to sync")
-			continue
+	if len(plan.Update) > 0 {
+		err = c.yn.UpdateTransactions(ctx, yb.ID, plan.Update)
+		if err != nil {
+			return plan, StageUpdate, errors.Wrap(err, "updating transactions")
 		}
+	}
 
-		err = c.yn.PushTransactions(yb.ID, ya.BudgetID, transactions)
+	if len(plan.Delete) > 0 {
+		err = c.yn.DeleteTransactions(ctx, yb.ID, plan.Delete)
 		if err != nil {
-			return errors.Wrap(err, "pushing transactions")
+			return plan, StageDelete, errors.Wrap(err, "deleting transactions")
+		}
+	}
+
+	// without the lookup of existing transactions it is unknown which creates YNAB skipped
+	if update {
+		c.savePushed(ctx, plan.Create, plan.Update)
+		c.saveAuthorisations(ctx, authorisations)
+	}
+
+	err = c.cs.SaveCursor(ctx, account, last)
+	if err != nil {
+		return plan, StageSaveCursor, errors.Wrap(err, "saving cursor")
+	}
+
+	slog.Info("Synced transactions",
+		slog.Int("count", len(plan.Create)),
+		slog.Int("updated", len(plan.Update)),
+		slog.Int("deleted", len(plan.Delete)))
+
+	return plan, "", nil
+}
+
+// prepare turns bunq transactions into the transactions pushed to YNAB: it converts them to the
+// budget currency, links transfers, applies payee aliases, the bank income payee and category,
+// rules and the FX fee category and renders the memos. Counterparts are returned separately.
+func (c *Client) prepare(
+	ctx context.Context,
+	account entity.ConfigAccount,
+	budget *entity.Budget,
+	transactions []*entity.Transaction,
+) (create, counterparts []*entity.Transaction, err error) {
+	err = c.convert(ctx, budget, transactions)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "converting currency")
+	}
+
+	create, counterparts, err = c.splitTransfers(ctx, account, budget.ID, transactions)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "splitting transfers")
+	}
+
+	c.normalizePayees(create)
+	err = c.markIncome(ctx, account, create)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "marking income")
+	}
+
+	c.categorize(account, create)
+	c.categorizeFees(account, create)
+
+	err = c.renderMemos(account, create)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "rendering memos")
+	}
+
+	return create, counterparts, nil
+}
+
+// earliestDate returns the date of the oldest transaction.
+func earliestDate(transactions []*entity.Transaction) time.Time {
+	since := transactions[0].Date
+	for _, t := range transactions {
+		if t.Date.Before(since) {
+			since = t.Date
 		}
+	}
 
-		slog.Info("Synced transactions", slog.Int("count", len(transactions)))
+	return since
+}
+
+// lastBankID returns the highest bank ID of the transactions, or cursor if that is higher.
+func lastBankID(transactions []*entity.Transaction, cursor int) int {
+	for _, t := range transactions {
+		if t.BankID > cursor {
+			cursor = t.BankID
+		}
 	}
 
-	return nil
+	return cursor
 }
 
-// GetAccountWithTransactions returns all payments for the given account.
+// GetAccountWithTransactions returns all payments for the given account
+// made on or after from with a bank ID higher than afterID.
 func (c *Client) GetAccountWithTransactions(
 	ctx context.Context,
 	name string,
+	from time.Time,
+	afterID int,
 ) (*entity.Account, error) {
 	acc, err := c.GetAccountByName(ctx, name)
 	if err != nil {
 		return nil, errors.Wrap(err, "getting account by name")
 	}
 
-	ts, err := c.bu.GetTransactions(ctx, acc.BankID)
+	ts, err := c.bu.GetTransactions(ctx, acc.BankID, from, afterID)
 	if err != nil {
 		return nil, errors.Wrap(err, "getting all payments")
 	}
@@ -126,7 +464,7 @@ func (c *Client) GetAccountByName(ctx context.Context, name string) (*entity.Acc
 		slog.Info("Account not found in memory, fetching from bunq")
 	}
 
-	accounts, err := c.bu.GetAllAccounts()
+	accounts, err := c.bu.GetAllAccounts(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "getting all accounts")
 	}
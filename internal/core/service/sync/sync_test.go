@@ -4,18 +4,21 @@ import (
 	"context"
 	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
 	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 func TestSuccessfulSyncWithCorrectTransactions(t *testing.T) {
 	ctx := context.Background()
 	fromDate := time.Now().Add(-30 * 24 * time.Hour)
 
-	mockBunq, mockYnab, mockStorage, config := setupMocks()
-	client := NewClient(mockBunq, mockStorage, mockYnab, config)
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
 
-	err := client.Sync(ctx, fromDate)
+	_, err := client.Sync(ctx, Options{From: fromDate})
 	if err != nil {
 		t.Fatalf("Sync() error = %v", err)
 	}
@@ -38,11 +41,11 @@ func TestSyncErrorFetchingTransactionsFromBunq(t *testing.T) {
 	ctx := context.Background()
 	fromDate := time.Now().Add(-30 * 24 * time.Hour)
 
-	mockBunq, mockYnab, mockStorage, config := setupMocks()
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
 	mockBunq.GetTransactionsErr = errors.New("transaction fetch error")
 
-	client := NewClient(mockBunq, mockStorage, mockYnab, config)
-	err := client.Sync(ctx, fromDate)
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	_, err := client.Sync(ctx, Options{From: fromDate})
 	if err == nil {
 		t.Error("Expected error when fetching transactions, got none")
 	}
@@ -52,37 +55,1027 @@ func TestSyncErrorPushingTransactionsToYnab(t *testing.T) {
 	ctx := context.Background()
 	fromDate := time.Now().Add(-30 * 24 * time.Hour)
 
-	mockBunq, mockYnab, mockStorage, config := setupMocks()
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
 	mockYnab.PushTransactionsErr = errors.New("push transactions error")
 
-	client := NewClient(mockBunq, mockStorage, mockYnab, config)
-	err := client.Sync(ctx, fromDate)
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	_, err := client.Sync(ctx, Options{From: fromDate})
 	if err == nil {
 		t.Error("Expected error when pushing transactions, got none")
 	}
 }
 
+func TestSyncContinuesAfterFailedAccount(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	config.Accounts = append([]entity.ConfigAccount{{
+		BunqAccountName: "Closed account",
+		YnabBudgetName:  "budget1",
+		YnabAccountName: "Closed account",
+	}}, config.Accounts...)
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	plans, err := client.Sync(ctx, Options{From: fromDate})
+
+	syncErr, ok := err.(*SyncError)
+	if !ok {
+		t.Fatalf("Expected a *SyncError, got %v", err)
+	}
+
+	if !syncErr.Partial() || len(syncErr.Failed) != 1 || syncErr.Failed[0].Stage != StageFetch {
+		t.Errorf("Expected a partial failure at the fetch stage, got %+v", syncErr)
+	}
+
+	if len(plans) != 2 || plans[0].Err == nil || plans[1].Err != nil {
+		t.Fatalf("Expected a failed and a synced plan, got %+v", plans)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 1 {
+		t.Errorf("Expected the second account to sync, got %d transactions", len(mockYnab.ProcessedTransactions))
+	}
+}
+
+func TestSyncDefersAccountNearQuota(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	client.SetQuota(&MockQuota{Current: entity.Quota{Used: 197, Limit: 200}})
+
+	plans, err := client.Sync(ctx, Options{From: fromDate})
+
+	syncErr, ok := err.(*SyncError)
+	if !ok || syncErr.Failed[0].Stage != StageQuota {
+		t.Fatalf("Expected the account to be deferred at the quota stage, got %v", err)
+	}
+
+	if len(plans[0].Create) != 1 || len(mockYnab.ProcessedTransactions) != 0 {
+		t.Errorf("Expected the transaction to be planned but not pushed, got %d pushed", len(mockYnab.ProcessedTransactions))
+	}
+
+	if cursor := mockCursors.Cursors[config.Accounts[0].Key()]; cursor != 0 {
+		t.Errorf("Expected the cursor to stay put for a deferred account, got %d", cursor)
+	}
+
+	client.SetQuota(&MockQuota{Current: entity.Quota{Used: 100, Limit: 200}})
+	_, err = client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 1 {
+		t.Errorf("Expected the deferred transaction to sync with quota left, got %d", len(mockYnab.ProcessedTransactions))
+	}
+}
+
 func TestSyncNoTransactionsToSync(t *testing.T) {
 	ctx := context.Background()
 	fromDate := time.Now().Add(-30 * 24 * time.Hour)
 
-	mockBunq, mockYnab, mockStorage, config := setupMocks()
-	mockBunq.Transactions[1] = []*entity.Transaction{} // Simulate no transactions
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{} // Simulate no transactions
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	_, err := client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Errorf("Sync() error = %v, expected no error for no transactions", err)
+	}
+}
+
+func TestSyncSkipsTransactionsBeforeCursor(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 10, Date: time.Now().Add(-3 * 24 * time.Hour)},
+		{BankID: 11, Date: time.Now().Add(-2 * 24 * time.Hour)},
+		{BankID: 12, Date: time.Now().Add(-1 * 24 * time.Hour)},
+	}
+	mockCursors.Cursors[config.Accounts[0].Key()] = 11
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	_, err := client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 1 || mockYnab.ProcessedTransactions[0].BankID != 12 {
+		t.Errorf("Expected only transaction 12 to be processed, got %d transactions", len(mockYnab.ProcessedTransactions))
+	}
+
+	if mockCursors.Cursors[config.Accounts[0].Key()] != 12 {
+		t.Errorf("Expected cursor to be moved to 12, got %d", mockCursors.Cursors[config.Accounts[0].Key()])
+	}
+}
+
+func TestSyncFullIgnoresCursor(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 10, Date: time.Now().Add(-2 * 24 * time.Hour)},
+		{BankID: 11, Date: time.Now().Add(-1 * 24 * time.Hour)},
+	}
+	mockCursors.Cursors[config.Accounts[0].Key()] = 11
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	_, err := client.Sync(ctx, Options{From: fromDate, Full: true})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 2 {
+		t.Errorf("Expected 2 transactions to be processed, got %d", len(mockYnab.ProcessedTransactions))
+	}
+}
+
+func TestSyncMigrateImportIDsSkipsLegacyImports(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+	date := time.Now().Add(-1 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	// Two payments with the same amount on the same day, only one was imported by the legacy scheme
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 10, Date: date, Amount: decimal.RequireFromString("-3.2")},
+		{BankID: 11, Date: date, Amount: decimal.RequireFromString("-3.2")},
+	}
+	mockYnab.ImportIDs = []string{mockBunq.Transactions[1][0].LegacyImportID()}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	_, err := client.Sync(ctx, Options{From: fromDate, MigrateImportIDs: true})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 1 {
+		t.Errorf("Expected 1 transaction to be processed, got %d", len(mockYnab.ProcessedTransactions))
+	}
+
+	if mockCursors.Cursors[config.Accounts[0].Key()] != 11 {
+		t.Errorf("Expected cursor to be moved to 11, got %d", mockCursors.Cursors[config.Accounts[0].Key()])
+	}
+}
+
+func TestSyncWithoutCursorSkipsLegacyImports(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+	date := time.Now().Add(-1 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 10, Date: date, Amount: decimal.RequireFromString("-3.2")},
+		{BankID: 11, Date: date, Amount: decimal.RequireFromString("-4.5")},
+	}
+	mockYnab.ImportIDs = []string{mockBunq.Transactions[1][0].LegacyImportID()}
+	delete(mockCursors.Cursors, config.Accounts[0].Key())
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	_, err := client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 1 {
+		t.Fatalf("Expected 1 transaction to be processed, got %d", len(mockYnab.ProcessedTransactions))
+	}
+
+	if mockYnab.ProcessedTransactions[0].BankID != 11 {
+		t.Errorf("Expected payment 11 to be processed, got %d", mockYnab.ProcessedTransactions[0].BankID)
+	}
+}
+
+func TestSyncDryRunDoesNotPush(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = append(mockBunq.Transactions[1], &entity.Transaction{
+		BankID: 3, Date: time.Now().Add(-1 * 24 * time.Hour),
+	})
+	mockYnab.ImportIDs = []string{mockBunq.Transactions[1][2].ImportID()}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	plans, err := client.Sync(ctx, Options{From: fromDate, DryRun: true})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 0 {
+		t.Errorf("Expected no transactions to be pushed, got %d", len(mockYnab.ProcessedTransactions))
+	}
+
+	if len(mockCursors.Cursors) != 0 {
+		t.Errorf("Expected no cursors to be saved, got %d", len(mockCursors.Cursors))
+	}
+
+	if len(plans) != 1 {
+		t.Fatalf("Expected 1 plan, got %d", len(plans))
+	}
+
+	plan := plans[0]
+	if len(plan.Create) != 1 || len(plan.Existing) != 1 || len(plan.Filtered) != 1 {
+		t.Errorf("Expected 1 create, 1 existing and 1 filtered transaction, got %d, %d and %d",
+			len(plan.Create), len(plan.Existing), len(plan.Filtered))
+	}
+}
+
+func TestSyncInternalTransferCreatesOneSide(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+	date := time.Now().Add(-1 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	config.Accounts = append(config.Accounts, entity.ConfigAccount{
+		BunqAccountName: "Account 2",
+		YnabBudgetName:  "budget1",
+		YnabAccountName: "Account 2",
+	})
+	mockStorage.Accounts["Account 1"].IBAN = "NL01BUNQ0000000001"
+	mockStorage.Accounts["Account 2"] = &entity.Account{BankID: 2, Description: "Account 2", IBAN: "NL01BUNQ0000000002"}
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 10, Date: date, Amount: decimal.NewFromInt(-10), PayeeIBAN: "NL01 BUNQ 0000 0000 02"},
+	}
+	mockBunq.Transactions[2] = []*entity.Transaction{
+		{BankID: 11, Date: date, Amount: decimal.NewFromInt(10), PayeeIBAN: "NL01BUNQ0000000001"},
+	}
+	mockYnab.TransferPayeeID = "transfer-payee"
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	plans, err := client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 1 {
+		t.Fatalf("Expected 1 transaction to be processed, got %d", len(mockYnab.ProcessedTransactions))
+	}
+
+	if mockYnab.ProcessedTransactions[0].TransferPayeeID != "transfer-payee" {
+		t.Errorf("Expected the outgoing transfer to use the transfer payee, got '%s'", mockYnab.ProcessedTransactions[0].TransferPayeeID)
+	}
+
+	if len(plans) != 2 || len(plans[1].Counterparts) != 1 {
+		t.Errorf("Expected the incoming transfer to be a counterpart")
+	}
+
+	if mockCursors.Cursors[config.Accounts[1].Key()] != 11 {
+		t.Errorf("Expected cursor of the receiving account to be moved to 11, got %d", mockCursors.Cursors[config.Accounts[1].Key()])
+	}
+}
+
+func TestSyncCategorisesWithFirstMatchingRule(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+	date := time.Now().Add(-1 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 10, Date: date, Amount: decimal.NewFromInt(-25), Payee: "Albert Heijn 1234", Type: entity.PaymentTypeMASTERCARD},
+		{BankID: 11, Date: date, Amount: decimal.NewFromInt(-250), Payee: "Albert Heijn 1234", Type: entity.PaymentTypeMASTERCARD},
+		{BankID: 12, Date: date, Amount: decimal.NewFromInt(-25), Payee: "Unknown"},
+	}
+	mockYnab.Categories = []*entity.GroupWithCategories{
+		{Name: "Everyday", Categories: []*entity.Category{{ID: "groceries", Name: "Groceries"}, {ID: "party", Name: "Party"}}},
+	}
+	maxAmount := decimal.NewFromInt(-100)
+	config.Rules = []entity.ConfigRule{
+		{Name: "party", Payee: "^Albert Heijn", AmountMax: &maxAmount, CategoryGroup: "Everyday", Category: "Party"},
+		{Name: "groceries", Payee: "^Albert Heijn", PaymentType: "MASTERCARD", CategoryGroup: "Everyday", Category: "Groceries"},
+	}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.LoadRules(ctx)
+	if err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+
+	_, err = client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	expected := map[int]string{10: "groceries", 11: "party", 12: ""}
+	for _, txn := range mockYnab.ProcessedTransactions {
+		if txn.CategoryID != expected[txn.BankID] {
+			t.Errorf("Expected transaction %d to have category '%s', got '%s'", txn.BankID, expected[txn.BankID], txn.CategoryID)
+		}
+	}
+}
+
+func TestSyncFiltersAndCategorisesByPaymentType(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+	date := time.Now().Add(-1 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 13, Date: date, Amount: decimal.NewFromInt(-3), Type: entity.PaymentTypeBUNQ, SubType: entity.PaymentSubTypeBilling},
+		// a type bunq2ynab doesn't model is kept as bunq sent it
+		{BankID: 12, Date: date, Amount: decimal.NewFromInt(-9), Type: entity.PaymentTypeFromString("TIKKIE"),
+			SubType: entity.PaymentSubTypeFromString("PAYMENT")},
+		{BankID: 11, Date: date, Amount: decimal.NewFromInt(-20), Type: entity.PaymentTypeBUNQ, SubType: entity.PaymentSubTypePayment},
+	}
+	mockYnab.Categories = []*entity.GroupWithCategories{
+		{Name: "Everyday", Categories: []*entity.Category{{ID: "friends", Name: "Friends"}}},
+	}
+	config.Rules = []entity.ConfigRule{
+		{Name: "tikkie", PaymentType: "tikkie", CategoryGroup: "Everyday", Category: "Friends"},
+	}
+	config.Filters = []entity.ConfigFilter{{Name: "fees", PaymentType: "BUNQ", PaymentSubType: "BILLING"}}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.LoadRules(ctx)
+	if err != nil {
+		t.Fatalf("LoadRules() error = %v", err)
+	}
+
+	err = client.LoadFilters()
+	if err != nil {
+		t.Fatalf("LoadFilters() error = %v", err)
+	}
+
+	plans, err := client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	expected := map[int]string{11: "", 12: "friends"}
+	if len(mockYnab.ProcessedTransactions) != len(expected) {
+		t.Fatalf("Expected the billing payment to be filtered, got %d pushed", len(mockYnab.ProcessedTransactions))
+	}
+
+	for _, txn := range mockYnab.ProcessedTransactions {
+		if txn.CategoryID != expected[txn.BankID] {
+			t.Errorf("Expected transaction %d to have category '%s', got '%s'", txn.BankID, expected[txn.BankID], txn.CategoryID)
+		}
+	}
+
+	if len(plans[0].Filtered) != 1 || mockCursors.Cursors[config.Accounts[0].Key()] != 13 {
+		t.Errorf("Expected payment 13 to be filtered with the cursor past it, got %+v", plans[0].Filtered)
+	}
+
+	config.Filters = []entity.ConfigFilter{{Name: "everything"}}
+	if client.LoadFilters() == nil {
+		t.Error("Expected a filter without conditions to fail")
+	}
+}
+
+func TestSyncMovesCursorPastOnlyFilteredPayments(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+	date := time.Now().Add(-1 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 13, Date: date, Amount: decimal.NewFromInt(-3), Type: entity.PaymentTypeBUNQ, SubType: entity.PaymentSubTypeBilling},
+	}
+	config.Filters = []entity.ConfigFilter{{Name: "fees", PaymentType: "BUNQ", PaymentSubType: "BILLING"}}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.LoadFilters()
+	if err != nil {
+		t.Fatalf("LoadFilters() error = %v", err)
+	}
+
+	_, err = client.Sync(ctx, Options{From: fromDate, DryRun: true})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(mockCursors.Cursors) != 0 {
+		t.Errorf("Expected a dry run to leave the cursor alone, got %v", mockCursors.Cursors)
+	}
+
+	_, err = client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if mockCursors.Cursors[config.Accounts[0].Key()] != 13 || len(mockYnab.ProcessedTransactions) != 0 {
+		t.Errorf("Expected the cursor past the filtered payment without pushing, got %v", mockCursors.Cursors)
+	}
+}
+
+func TestLoadRulesUnknownCategory(t *testing.T) {
+	ctx := context.Background()
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	config.Rules = []entity.ConfigRule{{Name: "missing", Category: "Missing"}}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.LoadRules(ctx)
+	if err == nil {
+		t.Error("Expected error for unknown category, got none")
+	}
+}
+
+func TestLoadRulesUnknownAccount(t *testing.T) {
+	ctx := context.Background()
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	config.Rules = []entity.ConfigRule{{Name: "typo", Account: "Acount 1", Category: "Groceries"}}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.LoadRules(ctx)
+	if err == nil || !strings.Contains(err.Error(), "'typo'") {
+		t.Errorf("Expected error naming the rule with an unknown account, got %v", err)
+	}
+}
+
+func TestSyncAppliesPayeeAliases(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+	date := time.Now().Add(-1 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 10, Date: date, Payee: "AH 1234 AMSTERDAM"},
+		{BankID: 11, Date: date, Payee: "Someone", PayeeIBAN: "NL01BUNQ0000000009"},
+		{BankID: 12, Date: date, Payee: "Unknown"},
+	}
+	config.Payees = []entity.ConfigPayee{
+		{Name: "Albert Heijn", Match: []string{"^AH [0-9]+"}, YnabPayeeID: "ah"},
+		{Name: "Landlord", IBANs: []string{"NL01 BUNQ 0000 0000 09"}},
+	}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.LoadPayees()
+	if err != nil {
+		t.Fatalf("LoadPayees() error = %v", err)
+	}
+
+	_, err = client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	expected := map[int]string{10: "Albert Heijn", 11: "Landlord", 12: "Unknown"}
+	for _, txn := range mockYnab.ProcessedTransactions {
+		if txn.Payee != expected[txn.BankID] {
+			t.Errorf("Expected transaction %d to have payee '%s', got '%s'", txn.BankID, expected[txn.BankID], txn.Payee)
+		}
+	}
+
+	if mockYnab.ProcessedTransactions[0].PayeeID != "ah" {
+		t.Errorf("Expected the YNAB payee ID of the alias to be used")
+	}
+}
+
+func TestSuggestPayeesGroupsSimilarNames(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+	date := time.Now().Add(-1 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 10, Date: date, Payee: "Albert Heijn 1234"},
+		{BankID: 11, Date: date, Payee: "Albert Heijn 1234"},
+		{BankID: 12, Date: date, Payee: "Albert Heijn 5678"},
+		{BankID: 13, Date: date, Payee: "Gas Company", PayeeIBAN: "NL01BUNQ0000000009"},
+		{BankID: 14, Date: date, Payee: "GC Energy B.V.", PayeeIBAN: "NL01BUNQ0000000009"},
+		{BankID: 15, Date: date, Payee: "Unique"},
+	}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	suggestions, err := client.SuggestPayees(ctx, fromDate)
+	if err != nil {
+		t.Fatalf("SuggestPayees() error = %v", err)
+	}
+
+	if len(suggestions) != 2 {
+		t.Fatalf("Expected 2 suggestions, got %d", len(suggestions))
+	}
+
+	if suggestions[0].Name != "Albert Heijn" || len(suggestions[0].Match) != 2 {
+		t.Errorf("Expected an 'Albert Heijn' alias matching 2 names, got %+v", suggestions[0])
+	}
+
+	if len(suggestions[1].IBANs) != 1 || len(suggestions[1].Match) != 2 {
+		t.Errorf("Expected an alias grouped on IBAN, got %+v", suggestions[1])
+	}
+}
+
+func TestSyncRendersMemoTemplates(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+	date := time.Now().Add(-1 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 10, Date: date, Payee: "Café Zoë", Description: "Koffie", Type: entity.PaymentTypeMASTERCARD},
+		{BankID: 11, Date: date, Payee: "Long", Description: strings.Repeat("€", 300)},
+	}
+	config.Accounts[0].MemoTemplate = "{{.Type}} {{truncate 4 .Payee}}: {{.Description}}"
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.LoadMemoTemplates()
+	if err != nil {
+		t.Fatalf("LoadMemoTemplates() error = %v", err)
+	}
+
+	_, err = client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if memo := mockYnab.ProcessedTransactions[0].Memo; memo != "MASTERCARD Café: Koffie" {
+		t.Errorf("Expected memo 'MASTERCARD Café: Koffie', got '%s'", memo)
+	}
+
+	memo := mockYnab.ProcessedTransactions[1].Memo
+	if !utf8.ValidString(memo) || utf8.RuneCountInString(memo) != 200 {
+		t.Errorf("Expected a valid memo of 200 characters, got %d characters", utf8.RuneCountInString(memo))
+	}
+}
+
+func TestLoadMemoTemplatesUnknownField(t *testing.T) {
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	config.Accounts[0].MemoTemplate = "{{.Unknown}}"
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.LoadMemoTemplates()
+	if err == nil {
+		t.Error("Expected error for unknown field, got none")
+	}
+}
+
+func TestSyncDescribesForeignCurrencyPayments(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{{
+		BankID:           3,
+		Payee:            "Starbucks",
+		Description:      "Coffee",
+		Amount:           decimal.RequireFromString("-11.04"),
+		Date:             time.Now(),
+		OriginalAmount:   decimal.RequireFromString("-12.00"),
+		OriginalCurrency: "USD",
+		ExchangeRate:     decimal.RequireFromString("0.915"),
+		Fee:              decimal.RequireFromString("0.06"),
+	}}
+	mockYnab.Categories = []*entity.GroupWithCategories{
+		{Name: "Bank", Categories: []*entity.Category{{ID: "cat-fx", Name: "FX fees"}}},
+	}
+	config.FX = entity.ConfigFX{FeeCategoryGroup: "Bank", FeeCategory: "FX fees"}
 
-	client := NewClient(mockBunq, mockStorage, mockYnab, config)
-	err := client.Sync(ctx, fromDate)
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.LoadFX(ctx)
 	if err != nil {
-		t.Errorf("Sync() error = %v, expected no error for no transactions", err)
+		t.Fatalf("LoadFX() error = %v", err)
+	}
+
+	_, err = client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	pushed := mockYnab.ProcessedTransactions[0]
+	if pushed.Memo != "Starbu: Coffee (USD 12.00 @ 0.915000 + fee 0.06)" {
+		t.Errorf("Expected the original amount, rate and fee in the memo, got '%s'", pushed.Memo)
+	}
+
+	if pushed.FeeCategoryID != "cat-fx" {
+		t.Errorf("Expected the fee to be categorised as FX fees, got '%s'", pushed.FeeCategoryID)
+	}
+}
+
+func TestSyncConvertsToBudgetCurrency(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{{
+		BankID:      3,
+		Payee:       "Landlord",
+		Description: "Rent",
+		Amount:      decimal.RequireFromString("-1500.00"),
+		Currency:    "USD",
+		Date:        time.Now(),
+	}}
+	mockYnab.Budgets[0].Currency = "EUR"
+	mockYnab.Budgets[0].Decimals = 2
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	_, err := client.Sync(ctx, Options{From: fromDate})
+	if err == nil {
+		t.Fatal("Expected the account to fail without exchange rates")
+	}
+
+	client.SetRates(MockRates{"USD/EUR": decimal.RequireFromString("0.9183")})
+	_, err = client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	pushed := mockYnab.ProcessedTransactions[0]
+	if !pushed.Amount.Equal(decimal.RequireFromString("-1377.45")) || pushed.Currency != "EUR" {
+		t.Errorf("Expected EUR -1377.45 to be pushed, got %s %s", pushed.Currency, pushed.Amount)
+	}
+
+	if pushed.Memo != "Landlo: Rent (USD 1500.00 @ 0.918300)" {
+		t.Errorf("Expected the amount in USD in the memo, got '%s'", pushed.Memo)
+	}
+}
+
+func TestSyncAggregatesRoundUps(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+	yesterday := time.Now().Add(-24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 6, Type: entity.PaymentTypeSAVINGS, Amount: decimal.RequireFromString("-0.40"), Date: time.Now()},
+		{BankID: 5, Type: entity.PaymentTypeIDEAL, Amount: decimal.RequireFromString("-20.00"), Date: time.Now()},
+		{BankID: 4, Type: entity.PaymentTypeSAVINGS, Amount: decimal.RequireFromString("-0.25"), Date: yesterday},
+		{BankID: 3, Type: entity.PaymentTypeSAVINGS, Amount: decimal.RequireFromString("-0.50"), Date: yesterday},
+	}
+	mockYnab.TransferPayeeID = "payee-savings"
+	config.Accounts[0].Savings = entity.ConfigSavings{Mode: entity.SavingsModeAggregate, YnabAccountName: "Savings"}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	plans, err := client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 2 {
+		t.Fatalf("Expected the payment and one aggregate to be pushed, got %d", len(mockYnab.ProcessedTransactions))
+	}
+
+	agg := mockYnab.ProcessedTransactions[1]
+	if !agg.Amount.Equal(decimal.RequireFromString("-0.75")) || agg.RoundUps != 2 || agg.TransferPayeeID != "payee-savings" {
+		t.Errorf("Expected a transfer of -0.75 for 2 round-ups, got %+v", agg)
+	}
+
+	if agg.ImportID() != "BUNQ:SAVINGS:"+yesterday.Format(time.DateOnly)+":1" {
+		t.Errorf("Expected the aggregate to be imported under the date, got %q", agg.ImportID())
+	}
+
+	// today's round-up goes into tomorrow's aggregate, so the cursor stays before it
+	if len(plans[0].Filtered) != 1 || mockCursors.Cursors[config.Accounts[0].Key()] != 5 {
+		t.Errorf("Expected round-up 6 to be held with the cursor at 5, got %d held and cursor %d",
+			len(plans[0].Filtered), mockCursors.Cursors[config.Accounts[0].Key()])
+	}
+}
+
+func TestSyncAggregatesRoundUpsOfTheFirstDay(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	yesterday := now.Add(-24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 4, Type: entity.PaymentTypeSAVINGS, Amount: decimal.RequireFromString("-0.25"), Date: yesterday},
+		// before the start of a one day window, on the same day
+		{BankID: 3, Type: entity.PaymentTypeSAVINGS, Amount: decimal.RequireFromString("-0.50"), Date: startOfDay(yesterday)},
+	}
+	mockYnab.TransferPayeeID = "payee-savings"
+	config.Accounts[0].Savings = entity.ConfigSavings{Mode: entity.SavingsModeAggregate, YnabAccountName: "Savings"}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	_, err := client.Sync(ctx, Options{From: yesterday})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 1 || !mockYnab.ProcessedTransactions[0].Amount.Equal(decimal.RequireFromString("-0.75")) {
+		t.Fatalf("Expected yesterday's round-ups to be pushed as one aggregate of -0.75, got %+v", mockYnab.ProcessedTransactions)
+	}
+}
+
+func TestSyncDropsRoundUps(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 4, Type: entity.PaymentTypeSAVINGS, Amount: decimal.RequireFromString("-0.25"), Date: time.Now()},
+		{BankID: 3, Type: entity.PaymentTypeIDEAL, Amount: decimal.RequireFromString("-20.00"), Date: time.Now()},
+	}
+	config.Accounts[0].Savings = entity.ConfigSavings{Mode: entity.SavingsModeDrop}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	_, err := client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 1 || mockYnab.ProcessedTransactions[0].BankID != 3 {
+		t.Errorf("Expected only the payment to be pushed, got %+v", mockYnab.ProcessedTransactions)
+	}
+
+	if mockCursors.Cursors[config.Accounts[0].Key()] != 4 {
+		t.Errorf("Expected the cursor past the dropped round-up, got %d", mockCursors.Cursors[config.Accounts[0].Key()])
+	}
+}
+
+// cancellingBunq cancels the sync while the account is being fetched.
+type cancellingBunq struct {
+	*MockBunq
+	cancel context.CancelFunc
+}
+
+func (m *cancellingBunq) GetTransactions(ctx context.Context, bankID int, from time.Time, afterID int) ([]*entity.Transaction, error) {
+	m.cancel()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return m.MockBunq.GetTransactions(ctx, bankID, from, afterID)
+}
+
+func TestSyncFinishesAccountInFlightWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 3, Amount: decimal.RequireFromString("-20.00"), Date: time.Now()},
+	}
+	config.Accounts = append(config.Accounts, entity.ConfigAccount{
+		BunqAccountName: "Account 2",
+		YnabBudgetName:  "budget1",
+		YnabAccountName: "Account 2",
+	})
+
+	client := NewClient(&cancellingBunq{MockBunq: mockBunq, cancel: cancel}, mockStorage, mockCursors, mockYnab, config)
+	plans, err := client.Sync(ctx, Options{From: time.Now().Add(-30 * 24 * time.Hour)})
+	if errors.Cause(err) != context.Canceled {
+		t.Errorf("Expected the sync to be interrupted, got %v", err)
+	}
+
+	if len(plans) != 1 || plans[0].Err != nil || len(mockYnab.ProcessedTransactions) != 1 {
+		t.Errorf("Expected the account in flight to be finished and the other skipped, got %d plans and %d pushed",
+			len(plans), len(mockYnab.ProcessedTransactions))
+	}
+}
+
+func TestValidateSavingsTransferNeedsConfiguredAccount(t *testing.T) {
+	account := entity.ConfigAccount{
+		BunqAccountName: "Account 1",
+		YnabBudgetName:  "budget1",
+		YnabAccountName: "Account 1",
+		Savings:         entity.ConfigSavings{Mode: entity.SavingsModeTransfer, BunqAccountName: "Savings"},
+	}
+	savings := entity.ConfigAccount{BunqAccountName: "Savings", YnabBudgetName: "budget1", YnabAccountName: "Savings"}
+	elsewhere := entity.ConfigAccount{BunqAccountName: "Savings", YnabBudgetName: "budget2", YnabAccountName: "Savings"}
+
+	if err := validateSavings(account, []entity.ConfigAccount{account, savings}); err != nil {
+		t.Errorf("Expected a savings account in the same budget to be valid, got %v", err)
+	}
+
+	if err := validateSavings(account, []entity.ConfigAccount{account, elsewhere}); err == nil {
+		t.Error("Expected a savings account in another budget to fail")
+	}
+
+	if err := validateSavings(account, []entity.ConfigAccount{account}); err == nil {
+		t.Error("Expected an unconfigured savings account to fail")
+	}
+}
+
+func TestSyncImportsBankIncome(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 5, Type: entity.PaymentTypeINTEREST, Payee: "bunq B.V.", Amount: decimal.RequireFromString("0.80"), Date: time.Now()},
+		{BankID: 4, Type: entity.PaymentTypePAYDAY, Payee: "bunq B.V.", Amount: decimal.RequireFromString("5.00"), Date: time.Now()},
+		{BankID: 3, Type: entity.PaymentTypeINTEREST, Payee: "bunq B.V.", Amount: decimal.RequireFromString("0.43"), Date: time.Now()},
+		{BankID: 2, Type: entity.PaymentTypeIDEAL, Payee: "Shop", Amount: decimal.RequireFromString("2.00"), Date: time.Now()},
+	}
+	mockYnab.Categories = []*entity.GroupWithCategories{
+		{Name: "Internal Master Category", Categories: []*entity.Category{{ID: "cat-rta", Name: "Inflow: Ready to Assign"}}},
+	}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.LoadIncome(ctx)
+	if err != nil {
+		t.Fatalf("LoadIncome() error = %v", err)
+	}
+
+	plans, err := client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	for _, pushed := range mockYnab.ProcessedTransactions {
+		income := pushed.Type != entity.PaymentTypeIDEAL
+		if income != (pushed.Payee == "bunq" && pushed.CategoryID == "cat-rta") {
+			t.Errorf("Expected only interest and payday to be income from bunq, got %+v", pushed)
+		}
+	}
+
+	interest := plans[0].Interest
+	if len(interest) != 1 || !interest[0].Amount.Equal(decimal.RequireFromString("1.23")) {
+		t.Errorf("Expected 1.23 interest this month, got %+v", interest)
+	}
+}
+
+func TestReconcileCreatesAdjustment(t *testing.T) {
+	ctx := context.Background()
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Balances = map[int]decimal.Decimal{1: decimal.RequireFromString("100.50")}
+	mockYnab.Balance = decimal.RequireFromString("90.25")
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	res, err := client.Reconcile(ctx, true)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if len(res) != 1 || !res[0].Difference.Equal(decimal.RequireFromString("10.25")) || !res[0].Adjusted {
+		t.Fatalf("Expected an adjusted difference of 10.25, got %+v", res)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 1 {
+		t.Fatalf("Expected 1 adjustment to be pushed, got %d", len(mockYnab.ProcessedTransactions))
+	}
+
+	adjustment := mockYnab.ProcessedTransactions[0]
+	if !adjustment.Amount.Equal(res[0].Difference) || !adjustment.Cleared || adjustment.ImportID() != "" {
+		t.Errorf("Expected a cleared adjustment of the difference without import ID, got %+v", adjustment)
+	}
+}
+
+func TestSyncFailsForUnknownBudgetCurrency(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Transactions[1] = []*entity.Transaction{{BankID: 3, Amount: decimal.RequireFromString("-15.00"), Currency: "USD", Date: time.Now()}}
+	mockYnab.Budgets[0].Currency = ""
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	client.SetRates(MockRates{"USD/EUR": decimal.RequireFromString("0.92")})
+	_, err := client.Sync(ctx, Options{From: fromDate})
+	if err == nil {
+		t.Fatal("Expected the account to fail while the budget currency is unknown")
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 0 {
+		t.Errorf("Expected nothing to be pushed, got %d", len(mockYnab.ProcessedTransactions))
+	}
+}
+
+func TestReconcileConvertsBankBalance(t *testing.T) {
+	ctx := context.Background()
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockStorage.Accounts["Account 1"].Currency = "USD"
+	mockBunq.Balances = map[int]decimal.Decimal{1: decimal.RequireFromString("100.00")}
+	mockYnab.Budgets[0].Currency = "EUR"
+	mockYnab.Budgets[0].Decimals = 2
+	mockYnab.Balance = decimal.RequireFromString("90.00")
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	client.SetRates(MockRates{"USD/EUR": decimal.RequireFromString("0.92")})
+	res, err := client.Reconcile(ctx, true)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	if !res[0].BankBalance.Equal(decimal.RequireFromString("92")) || !res[0].Difference.Equal(decimal.RequireFromString("2")) {
+		t.Errorf("Expected the USD balance to be compared in EUR, got %+v", res[0])
+	}
+
+	if res[0].OriginalCurrency != "USD" || !res[0].OriginalBankBalance.Equal(decimal.RequireFromString("100")) {
+		t.Errorf("Expected the USD balance to be kept, got %s %s", res[0].OriginalCurrency, res[0].OriginalBankBalance)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 1 || !mockYnab.ProcessedTransactions[0].Amount.Equal(res[0].Difference) {
+		t.Errorf("Expected an adjustment of the difference in EUR, got %+v", mockYnab.ProcessedTransactions)
+	}
+}
+
+func TestHandleNotificationPushesWithoutMovingCursor(t *testing.T) {
+	ctx := context.Background()
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Notification = &entity.Notification{BankID: 1, PaymentID: 3}
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{BankID: 3, Payee: "Albert Heijn", Description: "groceries", Date: time.Now()},
+	}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.LoadMemoTemplates()
+	if err != nil {
+		t.Fatalf("LoadMemoTemplates() error = %v", err)
+	}
+
+	err = client.HandleNotification(ctx, []byte("{}"), "signature")
+	if err != nil {
+		t.Fatalf("HandleNotification() error = %v", err)
+	}
+
+	if mockBunq.Signature != "signature" {
+		t.Errorf("Expected the signature to be verified, got %q", mockBunq.Signature)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 1 || mockYnab.ProcessedTransactions[0].ImportID() != "BUNQ:3:1" {
+		t.Fatalf("Expected the notified payment to be pushed, got %+v", mockYnab.ProcessedTransactions)
+	}
+
+	if mockYnab.ProcessedTransactions[0].Memo == "" {
+		t.Error("Expected the memo to be rendered")
+	}
+
+	if len(mockCursors.Cursors) != 0 {
+		t.Errorf("Expected cursors to be untouched, got %v", mockCursors.Cursors)
+	}
+}
+
+func TestHandleNotificationSyncsAccountForCardAuthorisation(t *testing.T) {
+	ctx := context.Background()
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Notification = &entity.Notification{BankID: 1, AuthorisationID: 7}
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{AuthorisationID: 7, Type: entity.PaymentTypeMASTERCARD, Pending: true, Payee: "NS", Date: time.Now()},
+		{BankID: 3, Payee: "Albert Heijn", Date: time.Now()},
+	}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.HandleNotification(ctx, []byte("{}"), "signature")
+	if err != nil {
+		t.Fatalf("HandleNotification() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 2 {
+		t.Errorf("Expected the account to be synced with the pending authorisation, got %+v", mockYnab.ProcessedTransactions)
+	}
+
+	if mockCursors.Cursors[config.Accounts[0].Key()] != 3 {
+		t.Errorf("Expected the sync to move the cursor to 3, got %d", mockCursors.Cursors[config.Accounts[0].Key()])
+	}
+}
+
+func TestHandleNotificationIgnoresCardAuthorisationWithoutUpdates(t *testing.T) {
+	ctx := context.Background()
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Notification = &entity.Notification{BankID: 1, AuthorisationID: 7}
+	config.Update.Disabled = true
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.HandleNotification(ctx, []byte("{}"), "signature")
+	if err != nil {
+		t.Fatalf("HandleNotification() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 0 || len(mockCursors.Cursors) != 0 {
+		t.Errorf("Expected nothing to be synced, got %d pushed and cursors %v",
+			len(mockYnab.ProcessedTransactions), mockCursors.Cursors)
+	}
+}
+
+func TestHandleNotificationIgnoresOtherAccounts(t *testing.T) {
+	ctx := context.Background()
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	mockBunq.Notification = &entity.Notification{BankID: 42, PaymentID: 3}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.HandleNotification(ctx, []byte("{}"), "signature")
+	if err != nil {
+		t.Fatalf("HandleNotification() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 0 {
+		t.Errorf("Expected nothing to be pushed, got %d", len(mockYnab.ProcessedTransactions))
+	}
+}
+
+func TestRegisterCallbacks(t *testing.T) {
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	err := client.RegisterCallbacks(context.Background(), "https://example.com/callback/secret")
+	if err != nil {
+		t.Fatalf("RegisterCallbacks() error = %v", err)
+	}
+
+	if mockBunq.Registered[1] != "https://example.com/callback/secret" {
+		t.Errorf("Expected a callback for account 1, got %v", mockBunq.Registered)
 	}
 }
 
-func setupMocks() (*MockBunq, *MockYnab, *MockAccountStorage, *entity.Config) {
+func setupMocks() (*MockBunq, *MockYnab, *MockAccountStorage, *MockCursorStorage, *entity.Config) {
 	mockBunq := &MockBunq{
 		Accounts: []*entity.Account{{BankID: 1, Description: "Account 1"}},
 		Transactions: map[int][]*entity.Transaction{
 			1: {
-				{Date: time.Now().Add(-10 * 24 * time.Hour)}, // Recent transaction
-				{Date: time.Now().Add(-40 * 24 * time.Hour)}, // Older transaction
+				{BankID: 2, Date: time.Now().Add(-10 * 24 * time.Hour)}, // Recent transaction
+				{BankID: 1, Date: time.Now().Add(-40 * 24 * time.Hour)}, // Older transaction
 			},
 		},
 	}
@@ -112,7 +1105,9 @@ func setupMocks() (*MockBunq, *MockYnab, *MockAccountStorage, *entity.Config) {
 		},
 	}
 
-	return mockBunq, mockYnab, mockStorage, config
+	mockCursors := &MockCursorStorage{Cursors: map[string]int{}}
+
+	return mockBunq, mockYnab, mockStorage, mockCursors, config
 }
 
 // MockBunq is a mock implementation of the Bunq interface
@@ -121,33 +1116,121 @@ type MockBunq struct {
 	Transactions       map[int][]*entity.Transaction
 	GetAllAccountsErr  error
 	GetTransactionsErr error
+	Balances           map[int]decimal.Decimal
+	Notification       *entity.Notification
+	Signature          string
+	Registered         map[int]string
 }
 
-func (m *MockBunq) GetAllAccounts() ([]*entity.Account, error) {
+func (m *MockBunq) GetAllAccounts(ctx context.Context) ([]*entity.Account, error) {
 	return m.Accounts, m.GetAllAccountsErr
 }
 
-func (m *MockBunq) GetTransactions(_ context.Context, bankID int) ([]*entity.Transaction, error) {
+func (m *MockBunq) GetBalance(_ context.Context, bankID int) (decimal.Decimal, error) {
+	return m.Balances[bankID], nil
+}
+
+func (m *MockBunq) GetTransactions(_ context.Context, bankID int, from time.Time, afterID int) ([]*entity.Transaction, error) {
 	return m.Transactions[bankID], m.GetTransactionsErr
 }
 
+func (m *MockBunq) GetTransaction(_ context.Context, bankID int, paymentID int) (*entity.Transaction, error) {
+	for _, t := range m.Transactions[bankID] {
+		if t.BankID == paymentID {
+			return t, nil
+		}
+	}
+
+	return nil, errors.New("payment not found")
+}
+
+func (m *MockBunq) RegisterNotificationFilters(_ context.Context, bankID int, url string) error {
+	if m.Registered == nil {
+		m.Registered = map[int]string{}
+	}
+	m.Registered[bankID] = url
+	return nil
+}
+
+func (m *MockBunq) ParseNotification(body []byte, signature string) (*entity.Notification, error) {
+	m.Signature = signature
+	return m.Notification, nil
+}
+
 // MockYnab is a mock implementation of the Ynab interface
 type MockYnab struct {
 	Budgets               []*entity.Budget
 	Accounts              map[string]*entity.Account
 	PushTransactionsErr   error
 	ProcessedTransactions []*entity.Transaction
+	ImportIDs             []string
+	Imported              []*entity.ImportedTransaction
+	ImportedCalls         int
+	Updates               []*entity.TransactionUpdate
+	Deletes               []*entity.TransactionDelete
+	TransferPayeeID       string
+	Categories            []*entity.GroupWithCategories
+	Balance               decimal.Decimal
+}
+
+// MockRates holds rates by currency pair.
+type MockRates map[string]decimal.Decimal
+
+func (m MockRates) Rate(_ context.Context, t *entity.Transaction, to string) (decimal.Decimal, error) {
+	rate, ok := m[t.Currency+"/"+to]
+	if !ok {
+		return decimal.Decimal{}, errors.New("no rate")
+	}
+
+	return rate, nil
 }
 
-func (m *MockYnab) GetBudgetByName(name string) (*entity.Budget, error) {
+func (m *MockYnab) GetBudgetByName(ctx context.Context, name string) (*entity.Budget, error) {
 	return m.Budgets[0], nil
 }
 
-func (m *MockYnab) GetAccountByName(budgetID string, name string) (*entity.Account, error) {
+func (m *MockYnab) GetAccountByName(ctx context.Context, budgetID string, name string) (*entity.Account, error) {
 	return m.Accounts[budgetID], nil
 }
 
-func (m *MockYnab) PushTransactions(budgetID string, accountID string, transactions []*entity.Transaction) error {
+func (m *MockYnab) GetAllCategories(_ context.Context, budgetID string) ([]*entity.GroupWithCategories, error) {
+	return m.Categories, nil
+}
+
+func (m *MockYnab) GetImportedTransactions(
+	ctx context.Context,
+	budgetID string,
+	accountID string,
+	since time.Time,
+) ([]*entity.ImportedTransaction, error) {
+	m.ImportedCalls++
+	imported := m.Imported
+	for _, id := range m.ImportIDs {
+		imported = append(imported, &entity.ImportedTransaction{ID: id, ImportID: id})
+	}
+
+	return imported, nil
+}
+
+func (m *MockYnab) UpdateTransactions(ctx context.Context, budgetID string, updates []*entity.TransactionUpdate) error {
+	m.Updates = append(m.Updates, updates...)
+	return nil
+}
+
+func (m *MockYnab) DeleteTransactions(ctx context.Context, budgetID string, deletes []*entity.TransactionDelete) error {
+	m.Deletes = append(m.Deletes, deletes...)
+	return nil
+}
+
+func (m *MockYnab) GetAccountBalance(ctx context.Context, budgetID string, accountID string) (decimal.Decimal, error) {
+	return m.Balance, nil
+}
+
+func (m *MockYnab) GetTransferPayeeID(ctx context.Context, budgetID string, accountID string) (string, error) {
+	return m.TransferPayeeID, nil
+}
+
+func (m *MockYnab) PushTransactions(ctx context.Context, budgetID string, accountID string, transactions []*entity.Transaction) error {
 	m.ProcessedTransactions = append(m.ProcessedTransactions, transactions...)
 	return m.PushTransactionsErr
 }
@@ -159,9 +1242,36 @@ type MockAccountStorage struct {
 }
 
 func (m *MockAccountStorage) GetAccountByName(ctx context.Context, name string) (*entity.Account, error) {
-	return m.Accounts[name], nil // Simplified example
+	acc, ok := m.Accounts[name]
+	if !ok {
+		return nil, errors.New("account not found")
+	}
+	return acc, nil
 }
 
 func (m *MockAccountStorage) SaveAccount(ctx context.Context, b entity.Account) error {
 	return m.SaveAccountErr
 }
+
+// MockCursorStorage is a mock implementation of the CursorStorage interface
+// MockQuota is a mock implementation of the Quota interface
+type MockQuota struct {
+	Current entity.Quota
+}
+
+func (m *MockQuota) Quota() entity.Quota {
+	return m.Current
+}
+
+type MockCursorStorage struct {
+	Cursors map[string]int
+}
+
+func (m *MockCursorStorage) GetCursor(_ context.Context, account entity.ConfigAccount) (int, error) {
+	return m.Cursors[account.Key()], nil
+}
+
+func (m *MockCursorStorage) SaveCursor(_ context.Context, account entity.ConfigAccount, bankID int) error {
+	m.Cursors[account.Key()] = bankID
+	return nil
+}
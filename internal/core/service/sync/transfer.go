@@ -0,0 +1,117 @@
+package sync
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+)
+
+// splitTransfers detects transfers between the given account and the other configured
+// accounts in the same budget. Outgoing transfers get the YNAB transfer payee of the target
+// account, so YNAB creates and pairs the incoming side itself. Incoming transfers are returned
+// as counterparts and must not be pushed, or YNAB would end up with both sides twice.
+// Daily aggregates of round-ups are always pushed, as transfers to the configured savings account.
+func (c *Client) splitTransfers(
+	ctx context.Context,
+	account entity.ConfigAccount,
+	budgetID string,
+	transactions []*entity.Transaction,
+) (create, counterparts []*entity.Transaction, err error) {
+	own := c.ownAccounts(ctx, account)
+
+	payeeIDs := make(map[string]string)
+	for _, t := range transactions {
+		target, ok := c.transferTarget(account, own, t)
+		if !ok {
+			create = append(create, t)
+			continue
+		}
+
+		if t.Amount.IsPositive() && t.RoundUps == 0 {
+			counterparts = append(counterparts, t)
+			continue
+		}
+
+		payeeID, ok := payeeIDs[target]
+		if !ok {
+			ya, err := c.yn.GetAccountByName(ctx, budgetID, target)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "getting transfer account by name")
+			}
+
+			payeeID, err = c.yn.GetTransferPayeeID(ctx, budgetID, ya.BudgetID)
+			if err != nil {
+				return nil, nil, errors.Wrap(err, "getting transfer payee")
+			}
+
+			payeeIDs[target] = payeeID
+		}
+
+		t.TransferPayeeID = payeeID
+		create = append(create, t)
+	}
+
+	return create, counterparts, nil
+}
+
+// transferTarget returns the name of the YNAB account the transaction is a transfer with, if any.
+// Round-ups in transfer mode are transfers with the configured savings account whatever their
+// counterparty, other transactions are when their counterparty is one of the own accounts.
+func (c *Client) transferTarget(
+	account entity.ConfigAccount,
+	own map[string]entity.ConfigAccount,
+	t *entity.Transaction,
+) (string, bool) {
+	if t.RoundUps > 0 {
+		return account.Savings.YnabAccountName, true
+	}
+
+	if t.Type == entity.PaymentTypeSAVINGS && account.Savings.Mode == entity.SavingsModeTransfer {
+		for _, other := range c.cfg.Accounts {
+			if other.BunqAccountName == account.Savings.BunqAccountName && other.YnabBudgetName == account.YnabBudgetName {
+				return other.YnabAccountName, true
+			}
+		}
+	}
+
+	target, ok := own[normalizeIBAN(t.PayeeIBAN)]
+
+	return target.YnabAccountName, ok
+}
+
+// ownAccounts returns the other configured accounts in the same budget as account, keyed by IBAN.
+// Accounts that can't be found are left out, their own sync reports the failure.
+func (c *Client) ownAccounts(
+	ctx context.Context,
+	account entity.ConfigAccount,
+) map[string]entity.ConfigAccount {
+	own := make(map[string]entity.ConfigAccount)
+	for _, other := range c.cfg.Accounts {
+		if other.BunqAccountName == account.BunqAccountName || other.YnabBudgetName != account.YnabBudgetName {
+			continue
+		}
+
+		acc, err := c.GetAccountByName(ctx, other.BunqAccountName)
+		if err != nil {
+			slog.Warn("Skipping account for transfers",
+				slog.String("account", other.BunqAccountName), slog.String("error", err.Error()))
+			continue
+		}
+
+		if acc.IBAN == "" {
+			continue
+		}
+
+		own[normalizeIBAN(acc.IBAN)] = other
+	}
+
+	return own
+}
+
+// normalizeIBAN strips spaces and upper cases the IBAN so differently formatted IBANs compare equal.
+func normalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+}
@@ -0,0 +1,219 @@
+package sync
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+)
+
+// SetPushedStorage makes Sync remember what it pushed, so fields that aren't owned are
+// still updated until they are edited in YNAB. Without it only owned fields and the
+// category of uncategorised transactions are updated.
+func (c *Client) SetPushedStorage(ps PushedStorage) {
+	c.ps = ps
+}
+
+// planUpdates returns the updates that bring the transactions already in YNAB in line with bunq.
+func (c *Client) planUpdates(
+	ctx context.Context,
+	existing []*entity.Transaction,
+	imported []*entity.ImportedTransaction,
+) ([]*entity.TransactionUpdate, error) {
+	byImportID := make(map[string]*entity.ImportedTransaction, len(imported))
+	for _, it := range imported {
+		byImportID[it.ImportID] = it
+	}
+
+	var updates []*entity.TransactionUpdate
+	for _, t := range existing {
+		// a settled card payment is in YNAB under the import ID of its authorisation
+		it, ok := byImportID[t.ImportID()]
+		if !ok && t.AuthorisationID != 0 {
+			it, ok = byImportID[t.CardImportID()]
+		}
+
+		// transactions matched by their legacy import ID are left as they are
+		if !ok {
+			continue
+		}
+
+		var last *entity.Pushed
+		if c.ps != nil {
+			p, found, err := c.ps.GetPushed(ctx, it.ImportID)
+			if err != nil {
+				return nil, errors.Wrap(err, "getting pushed transaction")
+			}
+			if found {
+				last = &p
+			}
+		}
+
+		if u := planUpdate(c.cfg.Update.Owned, t, it, last); u != nil {
+			updates = append(updates, u)
+		}
+	}
+
+	return updates, nil
+}
+
+// planUpdate returns the update of a single transaction, or nil when nothing changes.
+// A field that isn't owned is only updated when it still holds what was last pushed.
+// The amount and category of a split are spread over its parts, so only its memo and
+// cleared state are updated.
+func planUpdate(
+	owned entity.ConfigOwned,
+	t *entity.Transaction,
+	it *entity.ImportedTransaction,
+	last *entity.Pushed,
+) *entity.TransactionUpdate {
+	if it.Reconciled || it.Transfer {
+		return nil
+	}
+
+	u := &entity.TransactionUpdate{ID: it.ID, ImportID: it.ImportID, Transaction: t}
+	changed := false
+
+	if !it.Split && !t.Amount.Equal(it.Amount) && (owned.Amount || last != nil && last.Amount.Equal(it.Amount)) {
+		u.Amount = &t.Amount
+		changed = true
+	}
+
+	if t.Memo != it.Memo && (owned.Memo || last != nil && last.Memo == it.Memo) {
+		u.Memo = &t.Memo
+		changed = true
+	}
+
+	if t.Cleared != it.Cleared && (owned.Cleared || last != nil && last.Cleared == it.Cleared) {
+		u.Cleared = &t.Cleared
+		changed = true
+	}
+
+	if !it.Split && t.CategoryID != "" && t.CategoryID != it.CategoryID && (owned.Category || it.CategoryID == "") {
+		u.CategoryID = &t.CategoryID
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return u
+}
+
+// savePushed records what was pushed for the created transactions and the updates.
+// An update of a transaction without an earlier record is not recorded, as the fields it
+// left alone might hold edits made in YNAB.
+func (c *Client) savePushed(
+	ctx context.Context,
+	created []*entity.Transaction,
+	updates []*entity.TransactionUpdate,
+) {
+	if c.ps == nil {
+		return
+	}
+
+	pushed := make(map[string]entity.Pushed)
+	for _, t := range created {
+		if id := t.ImportID(); id != "" {
+			pushed[id] = entity.PushedFrom(t)
+		}
+	}
+
+	for _, u := range updates {
+		id := u.ImportID
+		p, found, err := c.ps.GetPushed(ctx, id)
+		if err != nil || !found {
+			continue
+		}
+
+		if u.Amount != nil {
+			p.Amount = *u.Amount
+		}
+		if u.Memo != nil {
+			p.Memo = *u.Memo
+		}
+		if u.Cleared != nil {
+			p.Cleared = *u.Cleared
+		}
+		if u.CategoryID != nil {
+			p.CategoryID = *u.CategoryID
+		}
+		pushed[id] = p
+	}
+
+	if len(pushed) == 0 {
+		return
+	}
+
+	// YNAB is up to date already, a missing record only means fewer updates later on
+	err := c.ps.SavePushed(ctx, pushed)
+	if err != nil {
+		slog.Warn("Saving pushed transactions failed", slog.String("error", err.Error()))
+	}
+}
+
+// authorisationUnchanged reports whether the pending or reversed card authorisation is in the
+// same state as when it was last synced, so YNAB isn't asked about it again. A reversed
+// authorisation that was never pushed has nothing to remove.
+func (c *Client) authorisationUnchanged(ctx context.Context, t *entity.Transaction) (bool, error) {
+	state := entity.AuthorisationOf(t)
+	if c.ps == nil || state == nil {
+		return false, nil
+	}
+
+	p, found, err := c.ps.GetPushed(ctx, t.ImportID())
+	if err != nil {
+		return false, errors.Wrap(err, "getting pushed transaction")
+	}
+
+	if !found {
+		return state.Reversed, nil
+	}
+
+	return p.Authorisation != nil && p.Authorisation.Reversed == state.Reversed &&
+		p.Authorisation.Amount.Equal(state.Amount), nil
+}
+
+// authorisationsOf returns the state of the pending and reversed card authorisations by import ID.
+// It is taken before the transactions are prepared, which may convert their amount.
+func authorisationsOf(transactions []*entity.Transaction) map[string]*entity.PushedAuthorisation {
+	res := make(map[string]*entity.PushedAuthorisation)
+	for _, t := range transactions {
+		if state := entity.AuthorisationOf(t); state != nil {
+			res[t.ImportID()] = state
+		}
+	}
+
+	return res
+}
+
+// saveAuthorisations records the state of the synced card authorisations with what was pushed
+// for them. Pending authorisations without such a record were never pushed by a sync with
+// updates, their fields can't be recorded and they are looked up in YNAB again next time.
+func (c *Client) saveAuthorisations(ctx context.Context, authorisations map[string]*entity.PushedAuthorisation) {
+	if c.ps == nil || len(authorisations) == 0 {
+		return
+	}
+
+	pushed := make(map[string]entity.Pushed)
+	for id, state := range authorisations {
+		p, found, err := c.ps.GetPushed(ctx, id)
+		if err != nil || !found && !state.Reversed {
+			continue
+		}
+
+		p.Authorisation = state
+		pushed[id] = p
+	}
+
+	if len(pushed) == 0 {
+		return
+	}
+
+	err := c.ps.SavePushed(ctx, pushed)
+	if err != nil {
+		slog.Warn("Saving card authorisations failed", slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,276 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/shopspring/decimal"
+)
+
+func TestPlanUpdate(t *testing.T) {
+	bunq := &entity.Transaction{
+		BankID:     1,
+		Amount:     decimal.RequireFromString("-12.50"),
+		Memo:       "AH: groceries",
+		Cleared:    true,
+		CategoryID: "groceries",
+	}
+	pushed := &entity.Pushed{Amount: decimal.RequireFromString("-10.00"), Memo: "AH: groceries"}
+
+	tests := []struct {
+		name     string
+		owned    entity.ConfigOwned
+		imported entity.ImportedTransaction
+		last     *entity.Pushed
+		want     []string
+	}{
+		{
+			name:     "unchanged",
+			imported: entity.ImportedTransaction{Amount: bunq.Amount, Memo: bunq.Memo, Cleared: true, CategoryID: "groceries"},
+			last:     pushed,
+		},
+		{
+			name:     "changed in bunq",
+			imported: entity.ImportedTransaction{Amount: pushed.Amount, Memo: pushed.Memo},
+			last:     pushed,
+			want:     []string{"amount", "cleared", "category"},
+		},
+		{
+			name:     "edited in YNAB",
+			imported: entity.ImportedTransaction{Amount: decimal.RequireFromString("-11.00"), Memo: "shared with Sam", Cleared: true, CategoryID: "dining"},
+			last:     pushed,
+		},
+		{
+			name:     "edited in YNAB but owned",
+			owned:    entity.ConfigOwned{Amount: true, Memo: true, Category: true},
+			imported: entity.ImportedTransaction{Amount: decimal.RequireFromString("-11.00"), Memo: "shared with Sam", Cleared: true, CategoryID: "dining"},
+			last:     pushed,
+			want:     []string{"amount", "memo", "category"},
+		},
+		{
+			name:     "never pushed",
+			imported: entity.ImportedTransaction{Amount: pushed.Amount, Memo: pushed.Memo},
+			want:     []string{"category"},
+		},
+		{
+			name:     "reconciled",
+			owned:    entity.ConfigOwned{Amount: true},
+			imported: entity.ImportedTransaction{Amount: pushed.Amount, Cleared: true, Reconciled: true},
+			last:     pushed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := planUpdate(tt.owned, bunq, &tt.imported, tt.last)
+
+			var got []string
+			if u != nil {
+				if u.Amount != nil {
+					got = append(got, "amount")
+				}
+				if u.Memo != nil {
+					got = append(got, "memo")
+				}
+				if u.Cleared != nil {
+					got = append(got, "cleared")
+				}
+				if u.CategoryID != nil {
+					got = append(got, "category")
+				}
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected updates of %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Expected updates of %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncUpdatesChangedTransactions(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	tx := mockBunq.Transactions[1][0]
+	tx.Amount = decimal.RequireFromString("-12.50")
+
+	// the card payment was pushed at its authorised amount
+	authorised := decimal.RequireFromString("-10.00")
+	mockYnab.Imported = []*entity.ImportedTransaction{{ID: "ynab-1", ImportID: tx.ImportID(), Amount: authorised}}
+	pushed := &MockPushedStorage{Pushed: map[string]entity.Pushed{tx.ImportID(): {Amount: authorised}}}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	client.SetPushedStorage(pushed)
+
+	plans, err := client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 0 || len(plans[0].Existing) != 1 {
+		t.Errorf("Expected the transaction to be existing and not pushed again, got %d pushed", len(mockYnab.ProcessedTransactions))
+	}
+
+	if len(mockYnab.Updates) != 1 || mockYnab.Updates[0].ID != "ynab-1" || !mockYnab.Updates[0].Amount.Equal(tx.Amount) {
+		t.Fatalf("Expected the amount of ynab-1 to be updated, got %+v", mockYnab.Updates)
+	}
+
+	if p := pushed.Pushed[tx.ImportID()]; !p.Amount.Equal(tx.Amount) {
+		t.Errorf("Expected the settled amount to be recorded as pushed, got %s", p.Amount)
+	}
+}
+
+// MockPushedStorage is a mock implementation of the PushedStorage interface
+type MockPushedStorage struct {
+	Pushed map[string]entity.Pushed
+}
+
+func (m *MockPushedStorage) GetPushed(_ context.Context, importID string) (entity.Pushed, bool, error) {
+	p, ok := m.Pushed[importID]
+	return p, ok, nil
+}
+
+func (m *MockPushedStorage) SavePushed(_ context.Context, pushed map[string]entity.Pushed) error {
+	for id, p := range pushed {
+		m.Pushed[id] = p
+	}
+	return nil
+}
+
+func TestSyncReconcilesCardAuthorisations(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+	date := time.Now().Add(-2 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	pending := &entity.Transaction{AuthorisationID: 10, Amount: decimal.RequireFromString("-5.00"), Date: date, Pending: true}
+	settled := &entity.Transaction{BankID: 3, AuthorisationID: 11, Amount: decimal.RequireFromString("-12.50"), Date: date, Cleared: true}
+	reversed := &entity.Transaction{AuthorisationID: 12, Amount: decimal.RequireFromString("-20.00"), Date: date, Reversed: true}
+	declined := &entity.Transaction{AuthorisationID: 13, Amount: decimal.RequireFromString("-7.00"), Date: date, Reversed: true}
+	mockBunq.Transactions[1] = []*entity.Transaction{settled, pending, reversed, declined}
+
+	// the settled payment and the reversed authorisation were imported while pending
+	authorised := decimal.RequireFromString("-10.00")
+	mockYnab.Imported = []*entity.ImportedTransaction{
+		{ID: "ynab-11", ImportID: settled.CardImportID(), Amount: authorised},
+		{ID: "ynab-12", ImportID: reversed.CardImportID(), Amount: reversed.Amount},
+	}
+	pushed := &MockPushedStorage{Pushed: map[string]entity.Pushed{
+		settled.CardImportID(): {Amount: authorised},
+		reversed.CardImportID(): {
+			Amount:        reversed.Amount,
+			Authorisation: &entity.PushedAuthorisation{Amount: reversed.Amount},
+		},
+	}}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	client.SetPushedStorage(pushed)
+
+	plans, err := client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(mockYnab.ProcessedTransactions) != 1 || mockYnab.ProcessedTransactions[0].ImportID() != "BUNQ:CARD:10:1" {
+		t.Errorf("Expected only the pending authorisation to be pushed, got %+v", mockYnab.ProcessedTransactions)
+	}
+
+	if len(mockYnab.Updates) != 1 || mockYnab.Updates[0].ID != "ynab-11" ||
+		!mockYnab.Updates[0].Amount.Equal(settled.Amount) || mockYnab.Updates[0].Cleared == nil || !*mockYnab.Updates[0].Cleared {
+		t.Fatalf("Expected ynab-11 to be settled and cleared, got %+v", mockYnab.Updates)
+	}
+
+	if p := pushed.Pushed[settled.CardImportID()]; !p.Amount.Equal(settled.Amount) || !p.Cleared {
+		t.Errorf("Expected the settlement to be recorded under the authorisation, got %+v", p)
+	}
+
+	if len(mockYnab.Deletes) != 1 || mockYnab.Deletes[0].ID != "ynab-12" {
+		t.Errorf("Expected ynab-12 to be deleted, got %+v", mockYnab.Deletes)
+	}
+
+	if len(plans[0].Filtered) != 1 || plans[0].Filtered[0] != declined {
+		t.Errorf("Expected the reversed authorisation that was never imported to be filtered, got %+v", plans[0].Filtered)
+	}
+
+	if cursor := mockCursors.Cursors[config.Accounts[0].Key()]; cursor != 3 {
+		t.Errorf("Expected the cursor at the settled payment, got %d", cursor)
+	}
+}
+
+func TestSyncSkipsUnchangedCardAuthorisations(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+	date := time.Now().Add(-2 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	pending := &entity.Transaction{AuthorisationID: 10, Amount: decimal.RequireFromString("-5.00"), Date: date, Pending: true}
+	declined := &entity.Transaction{AuthorisationID: 11, Amount: decimal.RequireFromString("-7.00"), Date: date, Reversed: true}
+	mockBunq.Transactions[1] = []*entity.Transaction{pending, declined}
+	pushed := &MockPushedStorage{Pushed: map[string]entity.Pushed{}}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	client.SetPushedStorage(pushed)
+
+	_, err := client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if p := pushed.Pushed[pending.ImportID()]; p.Authorisation == nil || !p.Authorisation.Amount.Equal(pending.Amount) {
+		t.Fatalf("Expected the pending authorisation to be recorded, got %+v", p)
+	}
+
+	mockYnab.ImportedCalls = 0
+	plans, err := client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if mockYnab.ImportedCalls != 0 || len(plans[0].Filtered) != 2 {
+		t.Errorf("Expected unchanged authorisations to be filtered without asking YNAB, got %d lookups and %d filtered",
+			mockYnab.ImportedCalls, len(plans[0].Filtered))
+	}
+
+	// the authorisation is reversed in bunq, YNAB is asked to remove it
+	pending.Pending, pending.Reversed = false, true
+	_, err = client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if mockYnab.ImportedCalls != 1 {
+		t.Errorf("Expected the changed authorisation to be looked up in YNAB, got %d lookups", mockYnab.ImportedCalls)
+	}
+}
+
+func TestSyncSkipsCardAuthorisationsWithoutUpdates(t *testing.T) {
+	ctx := context.Background()
+	fromDate := time.Now().Add(-30 * 24 * time.Hour)
+	date := time.Now().Add(-2 * 24 * time.Hour)
+
+	mockBunq, mockYnab, mockStorage, mockCursors, config := setupMocks()
+	config.Update.Disabled = true
+	mockBunq.Transactions[1] = []*entity.Transaction{
+		{AuthorisationID: 10, Amount: decimal.RequireFromString("-5.00"), Date: date, Pending: true},
+		{AuthorisationID: 11, Amount: decimal.RequireFromString("-20.00"), Date: date, Reversed: true},
+	}
+
+	client := NewClient(mockBunq, mockStorage, mockCursors, mockYnab, config)
+	plans, err := client.Sync(ctx, Options{From: fromDate})
+	if err != nil {
+		t.Fatalf("Sync() error = %v", err)
+	}
+
+	if len(plans[0].Filtered) != 2 || len(mockYnab.ProcessedTransactions) != 0 {
+		t.Errorf("Expected the authorisations to be filtered, got %d filtered and %d pushed",
+			len(plans[0].Filtered), len(mockYnab.ProcessedTransactions))
+	}
+}
@@ -0,0 +1,495 @@
+package bunq
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// api is a minimal client for the bunq API.
+// It registers an installation, device and session on first use and, when it has a
+// context store, keeps them there so later runs reuse them instead of registering new ones.
+type api struct {
+	http    *http.Client
+	baseURL string
+	apiKey  string
+	store   *contextStore
+
+	mu                sync.Mutex
+	loaded            bool
+	key               *rsa.PrivateKey
+	installationToken string
+	// serverPublicKey is the PEM encoded key bunq signs its responses and callbacks with,
+	// serverKey the parsed key.
+	serverPublicKey string
+	serverKey       *rsa.PublicKey
+	sessionToken    string
+	userID          int
+}
+
+func newAPI(baseURL, apiKey string, store *contextStore) *api {
+	return &api{
+		http:    http.DefaultClient,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		store:   store,
+	}
+}
+
+// apiError is the error body returned by bunq.
+type apiError struct {
+	Error []struct {
+		ErrorDescription string `json:"error_description"`
+	} `json:"Error"`
+}
+
+// statusError is returned for responses with an error status code.
+type statusError struct {
+	method, path string
+	code         int
+	description  string
+	retryAfter   time.Duration
+}
+
+func (e *statusError) Error() string {
+	if e.description == "" {
+		return fmt.Sprintf("bunq: %s %s: %d", e.method, e.path, e.code)
+	}
+
+	return fmt.Sprintf("bunq: %s %s: %d %s", e.method, e.path, e.code, e.description)
+}
+
+// StatusCode returns the HTTP status code of the response.
+func (e *statusError) StatusCode() int {
+	return e.code
+}
+
+// RetryAfter returns the wait asked for by the Retry-After header, or 0 without one.
+func (e *statusError) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// statusCode returns the status code of a statusError, or 0 for other errors.
+func statusCode(err error) int {
+	e, ok := errors.Cause(err).(*statusError)
+	if !ok {
+		return 0
+	}
+
+	return e.code
+}
+
+// session returns the session token and user ID, creating a session if there is none yet.
+func (a *api) session(ctx context.Context) (string, int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !a.loaded {
+		a.load()
+		a.loaded = true
+	}
+
+	if a.sessionToken != "" {
+		return a.sessionToken, a.userID, nil
+	}
+
+	err := a.createSession(ctx)
+	if code := statusCode(err); a.installationToken != "" && code >= 400 && code < 500 {
+		// the stored installation may have been revoked, start over once
+		slog.Warn("Reusing bunq installation failed, registering a new one", slog.String("error", err.Error()))
+		a.reset()
+		err = a.createSession(ctx)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	a.save()
+
+	return a.sessionToken, a.userID, nil
+}
+
+// expire drops the session token if it is still the given one, so the next request opens a new session.
+func (a *api) expire(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.sessionToken == token {
+		a.sessionToken = ""
+	}
+}
+
+// load restores the stored context, it must be called with the lock held.
+// A context that can't be read is ignored, a new installation is registered instead.
+func (a *api) load() {
+	if a.store == nil {
+		return
+	}
+
+	c, err := a.store.load()
+	if err != nil {
+		slog.Warn("Ignoring bunq context", slog.String("error", err.Error()))
+		return
+	}
+
+	if c == nil || c.BaseURL != a.baseURL {
+		return
+	}
+
+	key, err := decodePrivateKey(c.PrivateKey)
+	if err != nil {
+		slog.Warn("Ignoring bunq context", slog.String("error", err.Error()))
+		return
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		slog.Warn("Ignoring bunq context with a non RSA key")
+		return
+	}
+
+	serverKey, err := parseServerKey(c.ServerPublicKey)
+	if err != nil {
+		slog.Warn("Ignoring bunq context", slog.String("error", err.Error()))
+		return
+	}
+
+	a.key = rsaKey
+	a.installationToken = c.InstallationToken
+	a.serverPublicKey = c.ServerPublicKey
+	a.serverKey = serverKey
+	a.sessionToken = c.SessionToken
+	a.userID = c.UserID
+}
+
+// save stores the context, it must be called with the lock held.
+// Failing to save only costs a new installation on the next run, so it is logged.
+func (a *api) save() {
+	if a.store == nil {
+		return
+	}
+
+	key, err := encodePrivateKey(a.key)
+	if err == nil {
+		err = a.store.save(&apiContext{
+			BaseURL:           a.baseURL,
+			PrivateKey:        key,
+			InstallationToken: a.installationToken,
+			ServerPublicKey:   a.serverPublicKey,
+			SessionToken:      a.sessionToken,
+			UserID:            a.userID,
+		})
+	}
+	if err != nil {
+		slog.Warn("Saving bunq context failed", slog.String("error", err.Error()))
+	}
+}
+
+// reset forgets the installation and session, it must be called with the lock held.
+func (a *api) reset() {
+	a.key = nil
+	a.installationToken = ""
+	a.serverPublicKey = ""
+	a.serverKey = nil
+	a.sessionToken = ""
+	a.userID = 0
+}
+
+// createSession registers an installation and device server if there is none yet and opens a session.
+// It must be called with the lock held.
+func (a *api) createSession(ctx context.Context) error {
+	if a.key == nil {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return errors.Wrap(err, "generating key")
+		}
+		a.key = key
+	}
+
+	if a.installationToken == "" {
+		pub, err := x509.MarshalPKIXPublicKey(&a.key.PublicKey)
+		if err != nil {
+			return errors.Wrap(err, "marshalling public key")
+		}
+
+		var installation struct {
+			Response []struct {
+				Token *struct {
+					Token string `json:"token"`
+				} `json:"Token"`
+				ServerPublicKey *struct {
+					ServerPublicKey string `json:"server_public_key"`
+				} `json:"ServerPublicKey"`
+			} `json:"Response"`
+		}
+		// the installation response brings the server key, so it is the one response that can't be verified
+		err = a.request(ctx, http.MethodPost, "/v1/installation", "", a.key, nil, map[string]string{
+			"client_public_key": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})),
+		}, &installation)
+		if err != nil {
+			return errors.Wrap(err, "creating installation")
+		}
+
+		var token, serverPublicKey string
+		for _, r := range installation.Response {
+			switch {
+			case r.Token != nil:
+				token = r.Token.Token
+			case r.ServerPublicKey != nil:
+				serverPublicKey = r.ServerPublicKey.ServerPublicKey
+			}
+		}
+
+		serverKey, err := parseServerKey(serverPublicKey)
+		if err != nil {
+			return errors.Wrap(err, "reading installation")
+		}
+		a.serverPublicKey = serverPublicKey
+		a.serverKey = serverKey
+
+		err = a.request(ctx, http.MethodPost, "/v1/device-server", token, a.key, a.serverKey, map[string]any{
+			"description":   name,
+			"secret":        a.apiKey,
+			"permitted_ips": []string{"*"},
+		}, nil)
+		if err != nil {
+			return errors.Wrap(err, "creating device server")
+		}
+
+		a.installationToken = token
+		slog.Info("Registered new bunq device")
+	}
+
+	var session struct {
+		Response []struct {
+			Token *struct {
+				Token string `json:"token"`
+			} `json:"Token"`
+			UserPerson  *struct{ ID int } `json:"UserPerson"`
+			UserCompany *struct{ ID int } `json:"UserCompany"`
+			UserAPIKey  *struct{ ID int } `json:"UserApiKey"`
+		} `json:"Response"`
+	}
+	err := a.request(ctx, http.MethodPost, "/v1/session-server", a.installationToken, a.key, a.serverKey, map[string]string{
+		"secret": a.apiKey,
+	}, &session)
+	if err != nil {
+		return errors.Wrap(err, "creating session")
+	}
+
+	for _, r := range session.Response {
+		switch {
+		case r.Token != nil:
+			a.sessionToken = r.Token.Token
+		case r.UserPerson != nil:
+			a.userID = r.UserPerson.ID
+		case r.UserCompany != nil:
+			a.userID = r.UserCompany.ID
+		case r.UserAPIKey != nil:
+			a.userID = r.UserAPIKey.ID
+		}
+	}
+
+	if a.sessionToken == "" || a.userID == 0 {
+		return errors.New("session response without token or user")
+	}
+
+	return nil
+}
+
+// do sends an authenticated request for the current user, path may use %d for the user ID.
+// When the session expired mid-run a new one is opened and the request is sent once more.
+func (a *api) do(ctx context.Context, method, path string, in, out any) error {
+	token, err := a.doOnce(ctx, method, path, in, out)
+	if statusCode(err) != http.StatusUnauthorized {
+		return err
+	}
+
+	slog.Info("bunq session expired, opening a new one")
+	a.expire(token)
+
+	_, err = a.doOnce(ctx, method, path, in, out)
+
+	return err
+}
+
+func (a *api) doOnce(ctx context.Context, method, path string, in, out any) (string, error) {
+	token, userID, err := a.session(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "getting session")
+	}
+
+	if strings.Contains(path, "%d") {
+		path = fmt.Sprintf(path, userID)
+	}
+
+	key, serverKey := a.keys()
+
+	return token, a.request(ctx, method, path, token, key, serverKey, in, out)
+}
+
+// keys returns the key requests are signed with and the key bunq signs its responses with.
+// They are taken under the lock, as a new session may replace them while a request is sent.
+func (a *api) keys() (*rsa.PrivateKey, *rsa.PublicKey) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.key, a.serverKey
+}
+
+// publicKey returns the key bunq signs its responses and callbacks with, nil before the installation.
+func (a *api) publicKey() *rsa.PublicKey {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.serverKey
+}
+
+// request sends a request to bunq, signed with key when set, and decodes the response into out.
+// Successful responses must carry a valid server signature when serverKey is set.
+func (a *api) request(ctx context.Context, method, path, token string, key *rsa.PrivateKey, serverKey *rsa.PublicKey, in, out any) error {
+	var body []byte
+	if in != nil {
+		var err error
+		body, err = json.Marshal(in)
+		if err != nil {
+			return errors.Wrap(err, "marshalling request")
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "creating request")
+	}
+
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", name)
+	req.Header.Set("X-Bunq-Language", "en_US")
+	req.Header.Set("X-Bunq-Region", "nl_NL")
+	req.Header.Set("X-Bunq-Geolocation", "0 0 0 0 000")
+	req.Header.Set("X-Bunq-Client-Request-Id", requestID())
+	if token != "" {
+		req.Header.Set("X-Bunq-Client-Authentication", token)
+	}
+
+	if len(body) > 0 && key != nil {
+		sum := sha256.Sum256(body)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+		if err != nil {
+			return errors.Wrap(err, "signing request")
+		}
+		req.Header.Set("X-Bunq-Client-Signature", base64.StdEncoding.EncodeToString(sig))
+	}
+
+	res, err := a.http.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "sending request")
+	}
+	defer res.Body.Close()
+
+	dat, err := io.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "reading response")
+	}
+
+	if res.StatusCode >= 400 {
+		se := &statusError{method: method, path: path, code: res.StatusCode}
+		if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+			se.retryAfter = time.Duration(seconds) * time.Second
+		}
+		var e apiError
+		if json.Unmarshal(dat, &e) == nil && len(e.Error) > 0 {
+			se.description = e.Error[0].ErrorDescription
+		}
+		return se
+	}
+
+	if serverKey != nil {
+		err = verifySignature(serverKey, dat, res.Header.Get(serverSignatureHeader))
+		if err != nil {
+			return errors.Wrapf(err, "verifying response to %s %s", method, path)
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	err = json.Unmarshal(dat, out)
+	if err != nil {
+		return errors.Wrap(err, "unmarshalling response")
+	}
+
+	return nil
+}
+
+// serverSignatureHeader holds bunq's signature of the body of a response or callback.
+const serverSignatureHeader = "X-Bunq-Server-Signature"
+
+// parseServerKey parses the PEM encoded public key of the bunq server.
+func parseServerKey(src string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(src))
+	if block == nil {
+		return nil, errors.New("no PEM data in server public key")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing server public key")
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("server public key is not an RSA key")
+	}
+
+	return rsaKey, nil
+}
+
+// verifySignature checks that bunq signed the body, signature is the base64 encoded
+// SHA256 PKCS #1 v1.5 signature from the X-Bunq-Server-Signature header.
+func verifySignature(key *rsa.PublicKey, body []byte, signature string) error {
+	if signature == "" {
+		return errors.New("missing server signature")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.Wrap(err, "decoding server signature")
+	}
+
+	sum := sha256.Sum256(body)
+	err = rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig)
+	if err != nil {
+		return errors.New("invalid server signature")
+	}
+
+	return nil
+}
+
+// requestID returns a random ID for the X-Bunq-Client-Request-Id header.
+func requestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
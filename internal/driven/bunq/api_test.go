@@ -0,0 +1,274 @@
+package bunq
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	gosync "sync"
+	"testing"
+)
+
+func TestSessionIsReusedAcrossRuns(t *testing.T) {
+	srv := newFakeBunq(t)
+	path := filepath.Join(t.TempDir(), ContextFile)
+
+	first := newAPI(srv.URL, "key", newContextStore(path, "key"))
+	err := first.do(context.Background(), http.MethodGet, "/v1/user/%d", nil, nil)
+	if err != nil {
+		t.Fatalf("do() error = %v", err)
+	}
+
+	second := newAPI(srv.URL, "key", newContextStore(path, "key"))
+	err = second.do(context.Background(), http.MethodGet, "/v1/user/%d", nil, nil)
+	if err != nil {
+		t.Fatalf("do() error = %v", err)
+	}
+
+	if srv.calls["/v1/installation"] != 1 || srv.calls["/v1/device-server"] != 1 || srv.calls["/v1/session-server"] != 1 {
+		t.Errorf("Expected a single installation, device and session, got %v", srv.calls)
+	}
+}
+
+func TestExpiredSessionIsRefreshed(t *testing.T) {
+	srv := newFakeBunq(t)
+	path := filepath.Join(t.TempDir(), ContextFile)
+
+	a := newAPI(srv.URL, "key", newContextStore(path, "key"))
+	err := a.do(context.Background(), http.MethodGet, "/v1/user/%d", nil, nil)
+	if err != nil {
+		t.Fatalf("do() error = %v", err)
+	}
+
+	srv.expire()
+	err = a.do(context.Background(), http.MethodGet, "/v1/user/%d", nil, nil)
+	if err != nil {
+		t.Fatalf("do() after expiry error = %v", err)
+	}
+
+	if srv.calls["/v1/installation"] != 1 || srv.calls["/v1/session-server"] != 2 {
+		t.Errorf("Expected a new session on the same installation, got %v", srv.calls)
+	}
+
+	c, err := newContextStore(path, "key").load()
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+
+	if c.SessionToken != srv.session {
+		t.Errorf("Expected the new session to be stored, got %s", c.SessionToken)
+	}
+}
+
+func TestUnsignedResponsesAreRejected(t *testing.T) {
+	srv := newFakeBunq(t)
+	a := newAPI(srv.URL, "key", newContextStore(filepath.Join(t.TempDir(), ContextFile), "key"))
+
+	err := a.do(context.Background(), http.MethodGet, "/v1/user/%d", nil, nil)
+	if err != nil {
+		t.Fatalf("do() error = %v", err)
+	}
+
+	srv.mu.Lock()
+	srv.forge = true
+	srv.mu.Unlock()
+
+	err = a.do(context.Background(), http.MethodGet, "/v1/user/%d", nil, nil)
+	if err == nil {
+		t.Error("Expected an error for a response with an invalid signature, got none")
+	}
+}
+
+func TestParseNotificationVerifiesSignature(t *testing.T) {
+	srv := newFakeBunq(t)
+	a := newAPI(srv.URL, "key", newContextStore(filepath.Join(t.TempDir(), ContextFile), "key"))
+	_, _, err := a.session(context.Background())
+	if err != nil {
+		t.Fatalf("session() error = %v", err)
+	}
+	c := &Client{api: a}
+
+	body := []byte(`{"NotificationUrl":{"category":"PAYMENT","object":{"Payment":{"id":3,"monetary_account_id":1}}}}`)
+	n, err := c.ParseNotification(body, srv.sign(body))
+	if err != nil {
+		t.Fatalf("ParseNotification() error = %v", err)
+	}
+
+	if n.BankID != 1 || n.PaymentID != 3 {
+		t.Errorf("Expected payment 3 of account 1, got %+v", n)
+	}
+
+	card := []byte(`{"NotificationUrl":{"category":"CARD_TRANSACTION_SUCCESSFUL",` +
+		`"object":{"MasterCardAction":{"id":7,"monetary_account_id":1}}}}`)
+	n, err = c.ParseNotification(card, srv.sign(card))
+	if err != nil {
+		t.Fatalf("ParseNotification() error = %v", err)
+	}
+
+	if n.BankID != 1 || n.AuthorisationID != 7 || n.PaymentID != 0 {
+		t.Errorf("Expected card authorisation 7 of account 1, got %+v", n)
+	}
+
+	_, err = c.ParseNotification(body, srv.sign([]byte("other")))
+	if err == nil {
+		t.Error("Expected an error for a callback with an invalid signature, got none")
+	}
+
+	_, err = c.ParseNotification(body, "")
+	if err == nil {
+		t.Error("Expected an error for an unsigned callback, got none")
+	}
+}
+
+func TestContextNeedsTheAPIKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ContextFile)
+	err := newContextStore(path, "key").save(&apiContext{SessionToken: "token"})
+	if err != nil {
+		t.Fatalf("save() error = %v", err)
+	}
+
+	_, err = newContextStore(path, "other key").load()
+	if err == nil {
+		t.Error("Expected an error decrypting with another API key, got none")
+	}
+}
+
+func TestCreateSandboxUser(t *testing.T) {
+	srv := newFakeBunq(t)
+
+	apiKey, err := CreateSandboxUser(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("CreateSandboxUser() error = %v", err)
+	}
+
+	if apiKey != "sandbox_key" {
+		t.Errorf("Expected the sandbox API key, got %s", apiKey)
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	tests := []struct {
+		environment, override, want string
+	}{
+		{"", "", BaseURLProduction},
+		{"sandbox", "", BaseURLSandbox},
+		{"sandbox", "http://localhost:8080", "http://localhost:8080"},
+	}
+
+	for _, tt := range tests {
+		got, err := BaseURL(tt.environment, tt.override)
+		if err != nil || got != tt.want {
+			t.Errorf("BaseURL(%q, %q) = %s, %v, want %s", tt.environment, tt.override, got, err, tt.want)
+		}
+	}
+
+	_, err := BaseURL("staging", "")
+	if err == nil {
+		t.Error("Expected error for unknown environment, got none")
+	}
+}
+
+// fakeBunq serves the installation, device and session endpoints and a user endpoint
+// that only accepts the current session.
+type fakeBunq struct {
+	*httptest.Server
+
+	key *rsa.PrivateKey
+
+	mu      gosync.Mutex
+	calls   map[string]int
+	session string
+	// forge makes the fake sign something else than the response body.
+	forge bool
+}
+
+func newFakeBunq(t *testing.T) *fakeBunq {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeBunq{calls: map[string]int{}, key: key}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *fakeBunq) publicKey() string {
+	dat, _ := x509.MarshalPKIXPublicKey(&f.key.PublicKey)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: dat}))
+}
+
+func (f *fakeBunq) sign(body []byte) string {
+	sum := sha256.Sum256(body)
+	sig, _ := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, sum[:])
+
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// serve signs the response of handle with the server key.
+func (f *fakeBunq) serve(w http.ResponseWriter, r *http.Request) {
+	rec := httptest.NewRecorder()
+	f.handle(rec, r)
+
+	signed := rec.Body.Bytes()
+	f.mu.Lock()
+	if f.forge {
+		signed = []byte("forged")
+	}
+	f.mu.Unlock()
+
+	w.Header().Set(serverSignatureHeader, f.sign(signed))
+	w.WriteHeader(rec.Code)
+	_, _ = w.Write(rec.Body.Bytes())
+}
+
+func (f *fakeBunq) expire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.session = ""
+}
+
+func (f *fakeBunq) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls[r.URL.Path]++
+	switch r.URL.Path {
+	case "/v1/installation":
+		writeJSON(w, `{"Response":[{"Id":{"id":1}},{"Token":{"token":"installation"}},{"ServerPublicKey":{"server_public_key":`+strconv.Quote(f.publicKey())+`}}]}`)
+	case "/v1/sandbox-user-person":
+		writeJSON(w, `{"Response":[{"ApiKey":{"api_key":"sandbox_key"}}]}`)
+	case "/v1/device-server":
+		writeJSON(w, `{"Response":[{"Id":{"id":1}}]}`)
+	case "/v1/session-server":
+		f.session = "session-" + strconv.Itoa(f.calls[r.URL.Path])
+		writeJSON(w, `{"Response":[{"Id":{"id":1}},{"Token":{"token":"`+f.session+`"}},{"UserPerson":{"id":7}}]}`)
+	case "/v1/user/7":
+		if f.session == "" || r.Header.Get("X-Bunq-Client-Authentication") != f.session {
+			w.WriteHeader(http.StatusUnauthorized)
+			writeJSON(w, `{"Error":[{"error_description":"Insufficient authorisation."}]}`)
+			return
+		}
+		writeJSON(w, `{"Response":[]}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, body string) {
+	_, _ = w.Write([]byte(body))
+}
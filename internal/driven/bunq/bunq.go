@@ -3,6 +3,9 @@ package bunq
 
 import (
 	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
@@ -10,134 +13,264 @@ import (
 	"github.com/shopspring/decimal"
 )
 
-// GetTransactions returns all payments for the given account.
+// apiPayment is a payment as sent by bunq in API responses and callbacks.
+type apiPayment struct {
+	ID                int    `json:"id"`
+	Created           string `json:"created"`
+	MonetaryAccountID int    `json:"monetary_account_id"`
+	Amount            struct {
+		Value    string `json:"value"`
+		Currency string `json:"currency"`
+	} `json:"amount"`
+	Description       string `json:"description"`
+	Type              string `json:"type"`
+	SubType           string `json:"sub_type"`
+	CounterpartyAlias struct {
+		IBAN        string `json:"iban"`
+		DisplayName string `json:"display_name"`
+	} `json:"counterparty_alias"`
+}
+
+// paymentPage is a page of payments, newest first.
+type paymentPage struct {
+	Response []struct {
+		Payment *apiPayment `json:"Payment"`
+	} `json:"Response"`
+	Pagination struct {
+		OlderURL string `json:"older_url"`
+	} `json:"Pagination"`
+}
+
+// GetTransactions returns the payments for the given account made on or after from
+// with an ID higher than afterID. bunq returns payments newest first, so older pages
+// are followed until a page reaches past from or afterID, or there are no older pages left.
+// Card payments are matched to their Mastercard actions of up to the settle window before
+// from, the pending authorisations since from are returned as pending transactions and
+// the reversed ones in the window as reversed transactions.
 func (c *Client) GetTransactions(
-	_ context.Context,
+	ctx context.Context,
 	bankID int,
+	from time.Time,
+	afterID int,
 ) ([]*entity.Transaction, error) {
-	c.rt.Take()
-	allPaymentResponse, err := c.client.PaymentService.GetAllPayment(uint(bankID))
-	if err != nil {
-		return nil, errors.Wrap(err, "getting all payments")
-	}
+	path := "/v1/user/%d/monetary-account/" + strconv.Itoa(bankID) + "/payment?count=200"
 
 	var transactions []*entity.Transaction
+	for {
+		var page paymentPage
+		c.rt.Take()
+		err := c.api.do(ctx, http.MethodGet, path, nil, &page)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting payments")
+		}
 
-	for _, r := range allPaymentResponse.Response {
-		payment := r.Payment
+		reachedFrom := false
+		for _, r := range page.Response {
+			if r.Payment == nil {
+				continue
+			}
 
-		amount, err := decimal.NewFromString(payment.Amount.Value)
-		if err != nil {
-			return nil, errors.Wrap(err, "converting amount to decimal")
+			transaction, err := paymentToDomain(r.Payment)
+			if err != nil {
+				return nil, errors.Wrap(err, "converting payment")
+			}
+
+			if transaction.Date.Before(from) || transaction.BankID <= afterID {
+				reachedFrom = true
+			}
+
+			transactions = append(transactions, transaction)
 		}
 
-		date, err := time.Parse(layout, payment.Created)
-		if err != nil {
-			return nil, errors.Wrap(err, "parsing date")
+		if reachedFrom || page.Pagination.OlderURL == "" {
+			break
 		}
 
-		transaction := &entity.Transaction{
-			BankID:      payment.ID,
-			Description: payment.Description,
-			Amount:      amount,
-			Date:        date,
-			Type:        entity.PaymentTypeFromString(payment.Type),
-			SubType:     entity.PaymentSubTypeFromString(payment.SubType),
-			Payee:       payment.CounterpartyAlias.DisplayName,
-			PayeeIBAN:   payment.CounterpartyAlias.IBAN,
+		path = page.Pagination.OlderURL
+	}
+
+	// settling dates a payment like its authorisation, so payments are filtered on their own date first
+	var synced []*entity.Transaction
+	for _, t := range transactions {
+		if !t.Date.Before(from) && t.BankID > afterID {
+			synced = append(synced, t)
 		}
+	}
 
-		transactions = append(transactions, transaction)
+	actions, err := c.getCardActions(ctx, bankID, from.Add(-cardSettleWindow))
+	if err != nil {
+		return nil, errors.Wrap(err, "getting card authorisations")
 	}
 
-	return transactions, nil
+	// the older payments are matched too, so they settle their own authorisations;
+	// the authorisations that aren't settled are appended after the payments
+	all := matchCardActions(transactions, actions, from)
+
+	return append(synced, all[len(transactions):]...), nil
 }
 
-func (c *Client) GetAllAccounts() ([]*entity.Account, error) {
+// paymentResponse is the response to a request for a single payment.
+type paymentResponse struct {
+	Response []struct {
+		Payment *apiPayment `json:"Payment"`
+	} `json:"Response"`
+}
+
+// GetTransaction returns a single payment of the given account.
+func (c *Client) GetTransaction(ctx context.Context, bankID int, paymentID int) (*entity.Transaction, error) {
+	var res paymentResponse
 	c.rt.Take()
-	sa, err := c.getAllSavingAccounts()
+	err := c.api.do(ctx, http.MethodGet,
+		"/v1/user/%d/monetary-account/"+strconv.Itoa(bankID)+"/payment/"+strconv.Itoa(paymentID), nil, &res)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting all saving accounts")
+		return nil, errors.Wrap(err, "getting payment")
 	}
 
-	ba, err := c.getAllBankAccounts()
+	for _, r := range res.Response {
+		if r.Payment != nil {
+			return paymentToDomain(r.Payment)
+		}
+	}
+
+	return nil, errors.Errorf("payment %d not found", paymentID)
+}
+
+func paymentToDomain(payment *apiPayment) (*entity.Transaction, error) {
+	amount, err := decimal.NewFromString(payment.Amount.Value)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting all bank accounts")
+		return nil, errors.Wrap(err, "converting amount to decimal")
 	}
 
-	jas, err := c.getAllJointAccounts()
+	date, err := time.Parse(layout, payment.Created)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting all joint accounts")
+		return nil, errors.Wrap(err, "parsing date")
 	}
 
-	return append(append(sa, ba...), jas...), nil
+	t := &entity.Transaction{
+		BankID:      payment.ID,
+		Description: payment.Description,
+		Amount:      amount,
+		Currency:    payment.Amount.Currency,
+		Date:        date,
+		Type:        entity.PaymentTypeFromString(payment.Type),
+		SubType:     entity.PaymentSubTypeFromString(payment.SubType),
+		Payee:       payment.CounterpartyAlias.DisplayName,
+		PayeeIBAN:   payment.CounterpartyAlias.IBAN,
+	}
+
+	// types bunq2ynab doesn't know yet are kept, rules and filters can still match them
+	if !t.Type.Known() || t.SubType != entity.PaymentSubTypeUnknown && !t.SubType.Known() {
+		slog.Debug("Unknown payment type",
+			slog.Int("bank_id", t.BankID), slog.String("type", payment.Type), slog.String("sub_type", payment.SubType))
+	}
+
+	return t, nil
 }
 
-func (c *Client) getAllSavingAccounts() ([]*entity.Account, error) {
-	var accounts []*entity.Account
+// GetBalance returns the current balance of the given account.
+func (c *Client) GetBalance(ctx context.Context, bankID int) (decimal.Decimal, error) {
+	var res struct {
+		Response []map[string]*apiAccount `json:"Response"`
+	}
 	c.rt.Take()
-	savingAccounts, err := c.client.AccountService.GetAllMonetaryAccountSaving()
+	err := c.api.do(ctx, http.MethodGet, "/v1/user/%d/monetary-account/"+strconv.Itoa(bankID), nil, &res)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting all saving accounts")
+		return decimal.Zero, errors.Wrap(err, "getting account")
 	}
 
-	for _, r := range savingAccounts.Response {
-		acc := r.MonetaryAccountSaving
-		account := &entity.Account{
-			BankID:      acc.ID,
-			Description: acc.Description,
-			AccountType: entity.AccountTypeSaving,
-		}
-		if len(acc.Alias) > 0 {
-			account.IBAN = acc.Alias[0].Value
+	// the account is wrapped in the object name of its type, which isn't known up front
+	for _, r := range res.Response {
+		for _, acc := range r {
+			if acc == nil || acc.ID != bankID {
+				continue
+			}
+
+			balance, err := decimal.NewFromString(acc.Balance.Value)
+			if err != nil {
+				return decimal.Zero, errors.Wrap(err, "converting balance to decimal")
+			}
+
+			return balance, nil
 		}
-		accounts = append(accounts, account)
 	}
 
-	return accounts, nil
+	return decimal.Zero, errors.New("account not found")
 }
 
-func (c *Client) getAllBankAccounts() ([]*entity.Account, error) {
-	var accounts []*entity.Account
-	c.rt.Take()
-	savingAccounts, err := c.client.AccountService.GetAllMonetaryAccountBank()
+// apiAccount is a monetary account of any type as returned by bunq.
+type apiAccount struct {
+	ID          int    `json:"id"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+	Balance     struct {
+		Value    string `json:"value"`
+		Currency string `json:"currency"`
+	} `json:"balance"`
+	Alias []struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	} `json:"alias"`
+}
+
+func (c *Client) GetAllAccounts(ctx context.Context) ([]*entity.Account, error) {
+	sa, err := c.getAllAccounts(ctx, "monetary-account-savings", "MonetaryAccountSavings", entity.AccountTypeSaving)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting all saving accounts")
+	}
+
+	ba, err := c.getAllAccounts(ctx, "monetary-account-bank", "MonetaryAccountBank", entity.AccountTypeBank)
 	if err != nil {
 		return nil, errors.Wrap(err, "getting all bank accounts")
 	}
 
-	for _, r := range savingAccounts.Response {
-		acc := r.MonetaryAccountBank
-		account := &entity.Account{
-			BankID:      acc.ID,
-			Description: acc.Description,
-			AccountType: entity.AccountTypeBank,
-		}
-		if len(acc.Alias) > 0 {
-			account.IBAN = acc.Alias[0].Value
-		}
-		accounts = append(accounts, account)
+	jas, err := c.getAllAccounts(ctx, "monetary-account-joint", "MonetaryAccountJoint", entity.AccountTypeJoint)
+	if err != nil {
+		return nil, errors.Wrap(err, "getting all joint accounts")
 	}
 
-	return accounts, nil
+	return append(append(sa, ba...), jas...), nil
 }
 
-func (c *Client) getAllJointAccounts() ([]*entity.Account, error) {
-	var accounts []*entity.Account
+// getAllAccounts returns the accounts of one type, kind is the endpoint and key the
+// object name bunq wraps every account of that type in.
+func (c *Client) getAllAccounts(
+	ctx context.Context,
+	kind string,
+	key string,
+	accountType entity.AccountType,
+) ([]*entity.Account, error) {
+	var res struct {
+		Response []map[string]*apiAccount `json:"Response"`
+	}
 	c.rt.Take()
-	jointAccounts, err := c.client.AccountService.GetAllMonetaryAccountJoint()
+	err := c.api.do(ctx, http.MethodGet, "/v1/user/%d/"+kind+"?count=200", nil, &res)
 	if err != nil {
-		return nil, errors.Wrap(err, "getting all joint accounts")
+		return nil, errors.Wrap(err, "getting accounts")
 	}
 
-	for _, r := range jointAccounts.Response {
-		acc := r.MonetaryAccountJoint
+	var accounts []*entity.Account
+	for _, r := range res.Response {
+		acc, ok := r[key]
+		if !ok || acc == nil {
+			continue
+		}
+
 		account := &entity.Account{
 			BankID:      acc.ID,
 			Description: acc.Description,
-			AccountType: entity.AccountTypeJoint,
+			AccountType: accountType,
+		}
+		balance, err := decimal.NewFromString(acc.Balance.Value)
+		if err != nil {
+			return nil, errors.Wrap(err, "converting balance to decimal")
 		}
-		if len(acc.Alias) > 0 {
-			account.IBAN = acc.Alias[0].Value
+		account.Balance = balance
+		account.Currency = acc.Balance.Currency
+		for _, alias := range acc.Alias {
+			if alias.Type == "IBAN" {
+				account.IBAN = alias.Value
+				break
+			}
 		}
 		accounts = append(accounts, account)
 	}
@@ -0,0 +1,103 @@
+package bunq
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/fake/fakebunq"
+	"github.com/shopspring/decimal"
+	"go.uber.org/ratelimit"
+)
+
+// newPagedClient returns a Client for a fake with two payments per page and an account
+// with payments 14, 12, 10, 8, 6, 4 and 2 days ago, oldest first.
+func newPagedClient(t *testing.T) (*Client, *fakebunq.Server, int, []int) {
+	t.Helper()
+
+	srv := fakebunq.New()
+	t.Cleanup(srv.Close)
+	srv.PageSize = 2
+
+	bankID := srv.AddAccount(fakebunq.KindBank, "Main", "NL00BUNQ0000000001")
+	var ids []int
+	for days := 14; days > 0; days -= 2 {
+		ids = append(ids, srv.AddPayment(bankID, fakebunq.Payment{
+			Created:          time.Now().AddDate(0, 0, -days),
+			Amount:           decimal.RequireFromString("-1.00"),
+			CounterpartyName: "Shop",
+		}))
+	}
+
+	c, err := NewClient(context.Background(), srv.URL, "key", "")
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	c.rt = ratelimit.NewUnlimited()
+
+	return c, srv, bankID, ids
+}
+
+func TestGetTransactionsFollowsPagesUntilFrom(t *testing.T) {
+	ctx := context.Background()
+	c, srv, bankID, ids := newPagedClient(t)
+
+	got, err := c.GetTransactions(ctx, bankID, time.Now().AddDate(0, 0, -9), 0)
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+
+	// newest first, the payments 8 days ago and later
+	want := []int{ids[6], ids[5], ids[4], ids[3]}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d transactions, got %d", len(want), len(got))
+	}
+	for i, tx := range got {
+		if tx.BankID != want[i] {
+			t.Errorf("Expected transaction %d to be %d, got %d", i, want[i], tx.BankID)
+		}
+	}
+
+	// the third page holds the first payment before from, the fourth isn't needed
+	if calls := srv.Calls("/v1/user/1/monetary-account/" + strconv.Itoa(bankID) + "/payment"); calls != 3 {
+		t.Errorf("Expected 3 pages to be fetched, got %d", calls)
+	}
+}
+
+func TestGetTransactionsStopsAtAfterID(t *testing.T) {
+	ctx := context.Background()
+	c, srv, bankID, ids := newPagedClient(t)
+
+	got, err := c.GetTransactions(ctx, bankID, time.Now().AddDate(0, 0, -30), ids[4])
+	if err != nil {
+		t.Fatalf("GetTransactions() error = %v", err)
+	}
+
+	if len(got) != 2 || got[0].BankID != ids[6] || got[1].BankID != ids[5] {
+		t.Errorf("Expected only the payments after %d, got %+v", ids[4], got)
+	}
+
+	// the second page holds the cursor, the older ones aren't needed
+	if calls := srv.Calls("/v1/user/1/monetary-account/" + strconv.Itoa(bankID) + "/payment"); calls != 2 {
+		t.Errorf("Expected 2 pages to be fetched, got %d", calls)
+	}
+}
+
+func TestGetBalanceGetsTheAccount(t *testing.T) {
+	ctx := context.Background()
+	c, srv, bankID, _ := newPagedClient(t)
+
+	balance, err := c.GetBalance(ctx, bankID)
+	if err != nil {
+		t.Fatalf("GetBalance() error = %v", err)
+	}
+
+	if !balance.Equal(decimal.RequireFromString("-7.00")) {
+		t.Errorf("Expected a balance of -7.00, got %s", balance)
+	}
+
+	if calls := srv.Calls("/v1/user/1/monetary-account-bank"); calls != 0 {
+		t.Errorf("Expected no account lists to be fetched, got %d", calls)
+	}
+}
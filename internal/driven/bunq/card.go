@@ -0,0 +1,272 @@
+package bunq
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// These are the Mastercard action values that decide how an authorisation is synced.
+const (
+	// cardDecisionAllowed is the decision of an authorisation that went through, others were declined.
+	cardDecisionAllowed = "ALLOWED"
+	// cardClearingPending is the clearing status of an authorisation that isn't settled yet.
+	cardClearingPending = "PENDING"
+)
+
+// cardReversedStatuses are the authorisation statuses of authorisations that will never settle.
+var cardReversedStatuses = map[string]bool{
+	"REVERSED": true,
+	"EXPIRED":  true,
+	"CANCELED": true,
+}
+
+// cardSettleWindow is how long after an authorisation its payment may follow.
+const cardSettleWindow = 30 * 24 * time.Hour
+
+// apiAmount is an amount as sent by bunq.
+type apiAmount struct {
+	Value    string `json:"value"`
+	Currency string `json:"currency"`
+}
+
+// apiCardAction is a Mastercard action as sent by bunq, one per card authorisation.
+// The local amount is what the merchant charged, the billing amount what was taken
+// from the account, including the fee.
+type apiCardAction struct {
+	ID                  int        `json:"id"`
+	Created             string     `json:"created"`
+	AmountLocal         apiAmount  `json:"amount_local"`
+	AmountBilling       apiAmount  `json:"amount_billing"`
+	AmountFee           *apiAmount `json:"amount_fee"`
+	Description         string     `json:"description"`
+	Decision            string     `json:"decision"`
+	AuthorisationStatus string     `json:"authorisation_status"`
+	ClearingStatus      string     `json:"clearing_status"`
+	CounterpartyAlias   struct {
+		DisplayName string `json:"display_name"`
+	} `json:"counterparty_alias"`
+	CardID    int `json:"card_id"`
+	LabelCard struct {
+		SecondLine string `json:"second_line"`
+	} `json:"label_card"`
+}
+
+// cardActionPage is a page of Mastercard actions, newest first.
+type cardActionPage struct {
+	Response []struct {
+		MasterCardAction *apiCardAction `json:"MasterCardAction"`
+	} `json:"Response"`
+	Pagination struct {
+		OlderURL string `json:"older_url"`
+	} `json:"Pagination"`
+}
+
+// cardAction is an allowed card authorisation.
+type cardAction struct {
+	id       int
+	created  time.Time
+	amount   decimal.Decimal
+	currency string
+	payee    string
+	desc     string
+	pending  bool
+	reversed bool
+	card     string
+
+	// the original amount, rate and fee are only set for payments in a foreign currency
+	originalAmount   decimal.Decimal
+	originalCurrency string
+	rate             decimal.Decimal
+	fee              decimal.Decimal
+}
+
+// getCardActions returns the allowed card authorisations of the account made on or after from.
+// Like payments, the older ones on the last page fetched are returned as well.
+func (c *Client) getCardActions(ctx context.Context, bankID int, from time.Time) ([]*cardAction, error) {
+	path := "/v1/user/%d/monetary-account/" + strconv.Itoa(bankID) + "/mastercard-action?count=200"
+
+	var actions []*cardAction
+	for {
+		var page cardActionPage
+		c.rt.Take()
+		err := c.api.do(ctx, http.MethodGet, path, nil, &page)
+		if err != nil {
+			return nil, errors.Wrap(err, "getting mastercard actions")
+		}
+
+		reachedFrom := false
+		for _, r := range page.Response {
+			if r.MasterCardAction == nil {
+				continue
+			}
+
+			action, err := cardActionFromAPI(r.MasterCardAction)
+			if err != nil {
+				return nil, errors.Wrap(err, "converting mastercard action")
+			}
+
+			if action.created.Before(from) {
+				reachedFrom = true
+			}
+
+			if r.MasterCardAction.Decision == cardDecisionAllowed {
+				actions = append(actions, action)
+			}
+		}
+
+		if reachedFrom || page.Pagination.OlderURL == "" {
+			break
+		}
+
+		path = page.Pagination.OlderURL
+	}
+
+	return actions, nil
+}
+
+func cardActionFromAPI(a *apiCardAction) (*cardAction, error) {
+	amount, err := decimal.NewFromString(a.AmountBilling.Value)
+	if err != nil {
+		return nil, errors.Wrap(err, "converting amount to decimal")
+	}
+
+	created, err := time.Parse(layout, a.Created)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing date")
+	}
+
+	action := &cardAction{
+		id:      a.ID,
+		created: created,
+		// bunq sends the billed amount of an authorisation unsigned, it takes money from the account
+		amount:   amount.Abs().Neg(),
+		currency: a.AmountBilling.Currency,
+		payee:    a.CounterpartyAlias.DisplayName,
+		desc:     a.Description,
+		pending:  a.ClearingStatus == cardClearingPending,
+		reversed: cardReversedStatuses[a.AuthorisationStatus],
+		card:     a.LabelCard.SecondLine,
+	}
+	if action.card == "" && a.CardID != 0 {
+		action.card = strconv.Itoa(a.CardID)
+	}
+
+	if a.AmountLocal.Currency == "" || a.AmountLocal.Currency == a.AmountBilling.Currency {
+		return action, nil
+	}
+
+	local, err := decimal.NewFromString(a.AmountLocal.Value)
+	if err != nil {
+		return nil, errors.Wrap(err, "converting local amount to decimal")
+	}
+
+	if a.AmountFee != nil && a.AmountFee.Value != "" {
+		fee, err := decimal.NewFromString(a.AmountFee.Value)
+		if err != nil {
+			return nil, errors.Wrap(err, "converting fee to decimal")
+		}
+		action.fee = fee.Abs()
+	}
+
+	action.originalAmount = local.Abs().Neg()
+	action.originalCurrency = a.AmountLocal.Currency
+	if !local.IsZero() {
+		// the rate applies to the amount without the fee
+		action.rate = amount.Abs().Sub(action.fee).Div(local.Abs()).Round(6)
+	}
+
+	return action, nil
+}
+
+// setDetails copies the card and the original amount, rate and fee of the authorisation to the transaction.
+func (a *cardAction) setDetails(t *entity.Transaction) {
+	t.Card = a.card
+	t.OriginalAmount = a.originalAmount
+	t.OriginalCurrency = a.originalCurrency
+	t.ExchangeRate = a.rate
+	t.Fee = a.fee
+}
+
+// matchCardActions links the card payments to the authorisations they settle and returns
+// the transactions with the authorisations that aren't settled added as pending or reversed.
+//
+// bunq doesn't link a payment to its authorisation, so a card payment settles the oldest
+// unmatched authorisation at the same payee in the settle window before it, preferring
+// one with the same amount. A settled payment is dated and cleared like the authorisation.
+// Settled authorisations without a payment among the transactions were synced before.
+// The card and the original amount, rate and fee of foreign currency payments come from the authorisation.
+// Pending authorisations before from are left out, reversed ones are kept so an authorisation
+// imported while pending is still removed.
+func matchCardActions(transactions []*entity.Transaction, actions []*cardAction, from time.Time) []*entity.Transaction {
+	matched := make(map[int]bool)
+
+	// payments come newest first, settle the oldest first
+	for i := len(transactions) - 1; i >= 0; i-- {
+		t := transactions[i]
+		if t.Type != entity.PaymentTypeMASTERCARD {
+			continue
+		}
+
+		a := settledBy(t, actions, matched)
+		if a == nil {
+			continue
+		}
+
+		matched[a.id] = true
+		t.AuthorisationID = a.id
+		t.Date = a.created
+		t.Cleared = true
+		a.setDetails(t)
+	}
+
+	for _, a := range actions {
+		if matched[a.id] || !a.pending && !a.reversed || !a.reversed && a.created.Before(from) {
+			continue
+		}
+
+		t := &entity.Transaction{
+			AuthorisationID: a.id,
+			Description:     a.desc,
+			Amount:          a.amount,
+			Currency:        a.currency,
+			Date:            a.created,
+			Type:            entity.PaymentTypeMASTERCARD,
+			Payee:           a.payee,
+			Pending:         !a.reversed,
+			Reversed:        a.reversed,
+		}
+		a.setDetails(t)
+		transactions = append(transactions, t)
+	}
+
+	return transactions
+}
+
+// settledBy returns the authorisation the card payment settles, or nil if none matches.
+func settledBy(t *entity.Transaction, actions []*cardAction, matched map[int]bool) *cardAction {
+	var res *cardAction
+	for _, a := range actions {
+		if matched[a.id] || a.reversed || !strings.EqualFold(a.payee, t.Payee) ||
+			a.created.After(t.Date) || t.Date.Sub(a.created) > cardSettleWindow {
+			continue
+		}
+
+		// an equal amount beats an older authorisation
+		if res != nil && res.amount.Equal(t.Amount) && !a.amount.Equal(t.Amount) {
+			continue
+		}
+
+		if res == nil || a.amount.Equal(t.Amount) && !res.amount.Equal(t.Amount) || a.created.Before(res.created) {
+			res = a
+		}
+	}
+
+	return res
+}
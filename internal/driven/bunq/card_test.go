@@ -0,0 +1,105 @@
+package bunq
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/shopspring/decimal"
+)
+
+func TestMatchCardActions(t *testing.T) {
+	now := time.Now()
+	amount := decimal.RequireFromString
+
+	payment := &entity.Transaction{
+		BankID: 1, Type: entity.PaymentTypeMASTERCARD, Payee: "Albert Heijn", Amount: amount("-12.50"), Date: now,
+	}
+	other := &entity.Transaction{BankID: 2, Type: entity.PaymentTypeIDEAL, Payee: "Albert Heijn", Amount: amount("-12.50"), Date: now}
+	actions := []*cardAction{
+		{id: 10, payee: "Albert Heijn", amount: amount("-12.50"), created: now.Add(-48 * time.Hour)},
+		// older, but the amount of the first one matches the payment
+		{id: 11, payee: "albert heijn", amount: amount("-10.00"), created: now.Add(-72 * time.Hour), pending: true},
+		{id: 12, payee: "NS", amount: amount("-3.20"), created: now.Add(-time.Hour), pending: true},
+		{id: 13, payee: "Albert Heijn", amount: amount("-12.50"), created: now.Add(-time.Hour), reversed: true},
+		// settled before, its payment was synced already
+		{id: 14, payee: "Bol.com", amount: amount("-30.00"), created: now.Add(-96 * time.Hour)},
+		// before from, only the reversed one may still have to be removed
+		{id: 15, payee: "NS", amount: amount("-3.20"), created: now.AddDate(0, 0, -10), pending: true},
+		{id: 16, payee: "Shell", amount: amount("-50.00"), created: now.AddDate(0, 0, -10), reversed: true},
+	}
+
+	got := matchCardActions([]*entity.Transaction{payment, other}, actions, now.Add(-7*24*time.Hour))
+
+	if payment.AuthorisationID != 10 || !payment.Cleared || !payment.Date.Equal(actions[0].created) {
+		t.Errorf("Expected the payment to settle authorisation 10, got %+v", payment)
+	}
+
+	if other.AuthorisationID != 0 {
+		t.Errorf("Expected only card payments to be matched, got %+v", other)
+	}
+
+	byID := map[int]*entity.Transaction{}
+	for _, tx := range got[2:] {
+		byID[tx.AuthorisationID] = tx
+	}
+
+	if len(got) != 6 || !byID[11].Pending || !byID[12].Pending || !byID[13].Reversed || !byID[16].Reversed {
+		t.Errorf("Expected 11 and 12 pending and 13 and 16 reversed, got %+v", byID)
+	}
+
+	if byID[12].BankID != 0 || byID[12].ImportID() != "BUNQ:CARD:12:1" {
+		t.Errorf("Expected the pending authorisation to be imported under its card import ID, got %q", byID[12].ImportID())
+	}
+}
+
+func TestCardActionFromAPIForeignCurrency(t *testing.T) {
+	a := &apiCardAction{ID: 1, Created: "2024-05-01 12:00:00.000000"}
+	a.AmountLocal = apiAmount{Value: "12.00", Currency: "USD"}
+	a.AmountBilling = apiAmount{Value: "11.04", Currency: "EUR"}
+	a.AmountFee = &apiAmount{Value: "0.06", Currency: "EUR"}
+
+	action, err := cardActionFromAPI(a)
+	if err != nil {
+		t.Fatalf("cardActionFromAPI() error = %v", err)
+	}
+
+	tx := &entity.Transaction{}
+	action.setDetails(tx)
+
+	if tx.OriginalCurrency != "USD" || !tx.OriginalAmount.Equal(decimal.RequireFromString("-12.00")) {
+		t.Errorf("Expected an original amount of USD -12.00, got %s %s", tx.OriginalCurrency, tx.OriginalAmount)
+	}
+
+	// 10.98 EUR without the fee for 12.00 USD
+	if !tx.ExchangeRate.Equal(decimal.RequireFromString("0.915")) || !tx.Fee.Equal(decimal.RequireFromString("0.06")) {
+		t.Errorf("Expected a rate of 0.915 and a fee of 0.06, got %s and %s", tx.ExchangeRate, tx.Fee)
+	}
+}
+
+func TestCardActionFromAPICard(t *testing.T) {
+	a := &apiCardAction{ID: 1, Created: "2024-05-01 12:00:00.000000", CardID: 42}
+	a.AmountBilling = apiAmount{Value: "3.20", Currency: "EUR"}
+
+	action, err := cardActionFromAPI(a)
+	if err != nil {
+		t.Fatalf("cardActionFromAPI() error = %v", err)
+	}
+
+	tx := &entity.Transaction{}
+	action.setDetails(tx)
+	if tx.Card != "42" {
+		t.Errorf("Expected the card ID without a label, got %q", tx.Card)
+	}
+
+	a.LabelCard.SecondLine = "Groceries"
+	action, err = cardActionFromAPI(a)
+	if err != nil {
+		t.Fatalf("cardActionFromAPI() error = %v", err)
+	}
+
+	action.setDetails(tx)
+	if tx.Card != "Groceries" {
+		t.Errorf("Expected the second line of the card, got %q", tx.Card)
+	}
+}
@@ -2,9 +2,9 @@ package bunq
 
 import (
 	"context"
+	"fmt"
 	"time"
 
-	"github.com/OGKevin/go-bunq/bunq"
 	"github.com/pkg/errors"
 	"go.uber.org/ratelimit"
 )
@@ -12,31 +12,54 @@ import (
 const (
 	name   = "bunqtoynab-cli"
 	layout = "2006-01-02 15:04:05.000000"
+
+	// BaseURLProduction is the base URL of the bunq production API.
+	BaseURLProduction = "https://api.bunq.com"
+	// BaseURLSandbox is the base URL of the bunq sandbox API.
+	BaseURLSandbox = "https://public-api.sandbox.bunq.com"
 )
 
+// BaseURL returns the base URL of the given environment, a non empty override wins.
+func BaseURL(environment string, override string) (string, error) {
+	if override != "" {
+		return override, nil
+	}
+
+	switch environment {
+	case "", "production":
+		return BaseURLProduction, nil
+	case "sandbox":
+		return BaseURLSandbox, nil
+	default:
+		return "", fmt.Errorf("unknown bunq environment '%s', use production or sandbox", environment)
+	}
+}
+
 // Client is a client for the bunq API.
 type Client struct {
-	client *bunq.Client
-	rt     ratelimit.Limiter
+	api *api
+	rt  ratelimit.Limiter
 }
 
-// NewClient creates a new Client.
-func NewClient(ctx context.Context, apiKey string) (*Client, error) {
+// NewClient creates a new Client for the API at baseURL and opens a session.
+// The installation, device and session are kept encrypted in contextFile and reused
+// by later runs, an empty contextFile registers a new device on every run.
+func NewClient(ctx context.Context, baseURL string, apiKey string, contextFile string) (*Client, error) {
 	rt := ratelimit.New(3, ratelimit.Per(time.Second*3))
-	key, err := bunq.CreateNewKeyPair()
-	if err != nil {
-		return nil, errors.Wrap(err, "creating new key pair")
-	}
 
-	bunqClient := bunq.NewClient(ctx, bunq.BaseURLProduction, key, apiKey, name)
+	var store *contextStore
+	if contextFile != "" {
+		store = newContextStore(contextFile, apiKey)
+	}
 
-	err = bunqClient.Init()
+	a := newAPI(baseURL, apiKey, store)
+	_, _, err := a.session(ctx)
 	if err != nil {
 		return nil, errors.Wrap(err, "initializing bunq client")
 	}
 
 	return &Client{
-		client: bunqClient,
-		rt:     rt,
+		api: a,
+		rt:  rt,
 	}, nil
 }
@@ -0,0 +1,139 @@
+package bunq
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"os"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/fileutil"
+	"github.com/pkg/errors"
+)
+
+// ContextFile is the name of the file, in the state directory, that holds the bunq context.
+const ContextFile = "bunq-context"
+
+// apiContext is what is needed to reuse an installation, device and session across runs.
+type apiContext struct {
+	BaseURL           string `json:"base_url"`
+	PrivateKey        string `json:"private_key"`
+	InstallationToken string `json:"installation_token"`
+	ServerPublicKey   string `json:"server_public_key"`
+	SessionToken      string `json:"session_token"`
+	UserID            int    `json:"user_id"`
+}
+
+// contextStore keeps the apiContext in a file encrypted with a key derived from the API key,
+// so the tokens in it are only usable by whoever already has the API key.
+type contextStore struct {
+	path string
+	key  [32]byte
+}
+
+func newContextStore(path string, apiKey string) *contextStore {
+	return &contextStore{
+		path: path,
+		key:  sha256.Sum256([]byte("bunq2ynab context:" + apiKey)),
+	}
+}
+
+// load returns the stored context, or nil if there is none.
+func (s *contextStore) load() (*apiContext, error) {
+	dat, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading context file")
+	}
+
+	gcm, err := s.gcm()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(dat) < gcm.NonceSize() {
+		return nil, errors.New("context file too short")
+	}
+
+	plain, err := gcm.Open(nil, dat[:gcm.NonceSize()], dat[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "decrypting context file")
+	}
+
+	var c apiContext
+	err = json.Unmarshal(plain, &c)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshalling context")
+	}
+
+	return &c, nil
+}
+
+// save encrypts and writes the context, replacing the file atomically.
+func (s *contextStore) save(c *apiContext) error {
+	plain, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "marshalling context")
+	}
+
+	gcm, err := s.gcm()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return errors.Wrap(err, "generating nonce")
+	}
+
+	err = fileutil.WriteAtomic(s.path, gcm.Seal(nonce, nonce, plain, nil))
+	if err != nil {
+		return errors.Wrap(err, "writing context file")
+	}
+
+	return nil
+}
+
+func (s *contextStore) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.key[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "creating cipher")
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating gcm")
+	}
+
+	return gcm, nil
+}
+
+func encodePrivateKey(key any) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", errors.Wrap(err, "marshalling private key")
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+func decodePrivateKey(src string) (any, error) {
+	block, _ := pem.Decode([]byte(src))
+	if block == nil {
+		return nil, errors.New("no PEM data in private key")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing private key")
+	}
+
+	return key, nil
+}
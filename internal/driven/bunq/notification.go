@@ -0,0 +1,86 @@
+package bunq
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+)
+
+// notificationCategories are the callback categories that carry a payment or a card authorisation.
+var notificationCategories = []string{"PAYMENT", "MUTATION", "CARD_TRANSACTION_SUCCESSFUL"}
+
+// notification is the body of a bunq callback.
+type notification struct {
+	NotificationURL struct {
+		Category string `json:"category"`
+		Object   struct {
+			Payment          *apiPayment `json:"Payment"`
+			MasterCardAction *struct {
+				ID                int `json:"id"`
+				MonetaryAccountID int `json:"monetary_account_id"`
+			} `json:"MasterCardAction"`
+		} `json:"object"`
+	} `json:"NotificationUrl"`
+}
+
+// RegisterNotificationFilters makes bunq call the given URL for every payment, mutation and
+// card authorisation on the account.
+func (c *Client) RegisterNotificationFilters(ctx context.Context, bankID int, url string) error {
+	filters := make([]map[string]string, 0, len(notificationCategories))
+	for _, category := range notificationCategories {
+		filters = append(filters, map[string]string{
+			"category":            category,
+			"notification_target": url,
+		})
+	}
+
+	c.rt.Take()
+	err := c.api.do(ctx, http.MethodPost,
+		"/v1/user/%d/monetary-account/"+strconv.Itoa(bankID)+"/notification-filter-url",
+		map[string]any{"notification_filters": filters}, nil)
+	if err != nil {
+		return errors.Wrap(err, "creating notification filters")
+	}
+
+	return nil
+}
+
+// ParseNotification verifies that bunq signed the body of a callback and translates it.
+// Callbacks that carry neither a payment nor a card authorisation return nil.
+func (c *Client) ParseNotification(body []byte, signature string) (*entity.Notification, error) {
+	key := c.api.publicKey()
+	if key == nil {
+		return nil, errors.New("no server public key to verify the callback with")
+	}
+
+	err := verifySignature(key, body, signature)
+	if err != nil {
+		return nil, errors.Wrap(err, "verifying notification")
+	}
+
+	var n notification
+	err = json.Unmarshal(body, &n)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshalling notification")
+	}
+
+	object := n.NotificationURL.Object
+	switch {
+	case object.Payment != nil:
+		return &entity.Notification{
+			BankID:    object.Payment.MonetaryAccountID,
+			PaymentID: object.Payment.ID,
+		}, nil
+	case object.MasterCardAction != nil:
+		return &entity.Notification{
+			BankID:          object.MasterCardAction.MonetaryAccountID,
+			AuthorisationID: object.MasterCardAction.ID,
+		}, nil
+	default:
+		return nil, nil
+	}
+}
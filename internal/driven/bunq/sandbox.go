@@ -0,0 +1,116 @@
+package bunq
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// sugarDaddy is the sandbox user that accepts requests for money up to €500.
+var sugarDaddy = map[string]string{
+	"type":  "EMAIL",
+	"value": "sugardaddy@bunq.com",
+	"name":  "Sugar Daddy",
+}
+
+// demoPayments are the outgoing payments SeedSandbox makes.
+var demoPayments = []struct {
+	amount      string
+	description string
+}{
+	{"42.17", "Albert Heijn 1234 Amsterdam"},
+	{"3.50", "NS Groep IZ NS Reizigers"},
+	{"10.99", "Spotify P1A2B3C4"},
+	{"250.00", "Rent"},
+	{"24.95", "bol.com order 1234567890"},
+}
+
+// CreateSandboxUser creates a user with a funded account in the sandbox at baseURL and returns its API key.
+func CreateSandboxUser(ctx context.Context, baseURL string) (string, error) {
+	var res struct {
+		Response []struct {
+			APIKey *struct {
+				APIKey string `json:"api_key"`
+			} `json:"ApiKey"`
+		} `json:"Response"`
+	}
+	err := newAPI(baseURL, "", nil).request(ctx, http.MethodPost, "/v1/sandbox-user-person", "", nil, nil, map[string]any{}, &res)
+	if err != nil {
+		return "", errors.Wrap(err, "creating sandbox user")
+	}
+
+	for _, r := range res.Response {
+		if r.APIKey != nil {
+			return r.APIKey.APIKey, nil
+		}
+	}
+
+	return "", errors.New("sandbox user response without API key")
+}
+
+// SeedSandbox requests money from the sandbox sugar daddy into the account and spends
+// some of it on demo payments, so there is something to sync.
+func (c *Client) SeedSandbox(ctx context.Context, bankID int) error {
+	account := "/v1/user/%d/monetary-account/" + strconv.Itoa(bankID)
+
+	c.rt.Take()
+	err := c.api.do(ctx, http.MethodPost, account+"/request-inquiry", map[string]any{
+		"amount_inquired":    map[string]string{"value": "500.00", "currency": "EUR"},
+		"counterparty_alias": sugarDaddy,
+		"description":        "Sandbox funds",
+		"allow_bunqme":       false,
+	}, nil)
+	if err != nil {
+		return errors.Wrap(err, "requesting sandbox funds")
+	}
+
+	err = c.waitForBalance(ctx, bankID, decimal.NewFromInt(500))
+	if err != nil {
+		return errors.Wrap(err, "waiting for sandbox funds")
+	}
+
+	for _, p := range demoPayments {
+		c.rt.Take()
+		err = c.api.do(ctx, http.MethodPost, account+"/payment", map[string]any{
+			"amount":             map[string]string{"value": p.amount, "currency": "EUR"},
+			"counterparty_alias": sugarDaddy,
+			"description":        p.description,
+		}, nil)
+		if err != nil {
+			return errors.Wrapf(err, "making payment '%s'", p.description)
+		}
+
+		slog.Info("Made sandbox payment", slog.String("description", p.description), slog.String("amount", p.amount))
+	}
+
+	return nil
+}
+
+// waitForBalance waits until the sugar daddy accepted the request and the balance is at least min.
+func (c *Client) waitForBalance(ctx context.Context, bankID int, min decimal.Decimal) error {
+	const attempts = 10
+
+	for i := 0; i < attempts; i++ {
+		balance, err := c.GetBalance(ctx, bankID)
+		if err != nil {
+			return errors.Wrap(err, "getting balance")
+		}
+
+		if balance.GreaterThanOrEqual(min) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+
+	return errors.New("balance did not arrive in time")
+}
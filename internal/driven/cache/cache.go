@@ -0,0 +1,248 @@
+// Package cache caches YNAB lookups that rarely change, within and between runs.
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/bad33ndj3/bunq2ynab/internal/core/service/sync"
+	"github.com/bad33ndj3/bunq2ynab/internal/fileutil"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// File is the file in the state directory the cache is kept in.
+const File = "ynab-cache.json"
+
+// version is the version of the cached values, bump it whenever their shape changes.
+// A cache of another version is dropped. Version 1 added the budget currency.
+const version = 1
+
+// DefaultTTL is used for every lookup without a configured TTL.
+var DefaultTTL = entity.ConfigCache{
+	Budgets:        24 * time.Hour,
+	Accounts:       time.Hour,
+	Categories:     time.Hour,
+	TransferPayees: 24 * time.Hour,
+}
+
+// cacheFile is the content of File.
+type cacheFile struct {
+	Version int              `json:"version"`
+	Entries map[string]entry `json:"entries"`
+}
+
+// entry is a cached lookup result.
+type entry struct {
+	Value   json.RawMessage `json:"value"`
+	Expires time.Time       `json:"expires"`
+}
+
+// Ynab caches the budget, account, category and transfer payee lookups of a sync.Ynab.
+// Pushes, updates, imported transactions and balances always go to YNAB.
+type Ynab struct {
+	next sync.Ynab
+	ttl  entity.ConfigCache
+	now  func() time.Time
+
+	mu      gosync.Mutex
+	path    string
+	entries map[string]entry
+}
+
+// NewYnab wraps next, keeping the cache in the given directory and loading the existing cache if present.
+func NewYnab(next sync.Ynab, dir string, ttl entity.ConfigCache) (*Ynab, error) {
+	y := &Ynab{
+		next:    next,
+		ttl:     withDefaults(ttl),
+		now:     time.Now,
+		path:    filepath.Join(dir, File),
+		entries: make(map[string]entry),
+	}
+
+	dat, err := os.ReadFile(y.path)
+	if os.IsNotExist(err) {
+		return y, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading cache file")
+	}
+
+	var f cacheFile
+	err = json.Unmarshal(dat, &f)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshalling cache file")
+	}
+
+	if f.Version != version {
+		slog.Info("Dropping YNAB cache of another version", slog.Int("version", f.Version))
+		return y, nil
+	}
+
+	if f.Entries != nil {
+		y.entries = f.Entries
+	}
+
+	return y, nil
+}
+
+func withDefaults(ttl entity.ConfigCache) entity.ConfigCache {
+	if ttl.Budgets == 0 {
+		ttl.Budgets = DefaultTTL.Budgets
+	}
+	if ttl.Accounts == 0 {
+		ttl.Accounts = DefaultTTL.Accounts
+	}
+	if ttl.Categories == 0 {
+		ttl.Categories = DefaultTTL.Categories
+	}
+	if ttl.TransferPayees == 0 {
+		ttl.TransferPayees = DefaultTTL.TransferPayees
+	}
+
+	return ttl
+}
+
+func (y *Ynab) GetBudgetByName(ctx context.Context, name string) (*entity.Budget, error) {
+	return cached(y, "budget:"+name, y.ttl.Budgets, func() (*entity.Budget, error) {
+		return y.next.GetBudgetByName(ctx, name)
+	})
+}
+
+func (y *Ynab) GetAccountByName(ctx context.Context, budgetID string, name string) (*entity.Account, error) {
+	return cached(y, "account:"+budgetID+":"+name, y.ttl.Accounts, func() (*entity.Account, error) {
+		return y.next.GetAccountByName(ctx, budgetID, name)
+	})
+}
+
+func (y *Ynab) GetAllCategories(ctx context.Context, budgetID string) ([]*entity.GroupWithCategories, error) {
+	return cached(y, "categories:"+budgetID, y.ttl.Categories, func() ([]*entity.GroupWithCategories, error) {
+		return y.next.GetAllCategories(ctx, budgetID)
+	})
+}
+
+func (y *Ynab) GetTransferPayeeID(ctx context.Context, budgetID string, accountID string) (string, error) {
+	return cached(y, "transfer payee:"+budgetID+":"+accountID, y.ttl.TransferPayees, func() (string, error) {
+		return y.next.GetTransferPayeeID(ctx, budgetID, accountID)
+	})
+}
+
+// PushTransactions drops the cached lookups of the budget when the push fails,
+// in case it failed because of a stale account.
+func (y *Ynab) PushTransactions(ctx context.Context, budgetID string, accountID string, transactions []*entity.Transaction) error {
+	err := y.next.PushTransactions(ctx, budgetID, accountID, transactions)
+	if err != nil {
+		y.invalidate(budgetID)
+	}
+
+	return err
+}
+
+func (y *Ynab) GetImportedTransactions(
+	ctx context.Context,
+	budgetID string,
+	accountID string,
+	since time.Time,
+) ([]*entity.ImportedTransaction, error) {
+	return y.next.GetImportedTransactions(ctx, budgetID, accountID, since)
+}
+
+func (y *Ynab) UpdateTransactions(ctx context.Context, budgetID string, updates []*entity.TransactionUpdate) error {
+	return y.next.UpdateTransactions(ctx, budgetID, updates)
+}
+
+func (y *Ynab) DeleteTransactions(ctx context.Context, budgetID string, deletes []*entity.TransactionDelete) error {
+	return y.next.DeleteTransactions(ctx, budgetID, deletes)
+}
+
+func (y *Ynab) GetAccountBalance(ctx context.Context, budgetID string, accountID string) (decimal.Decimal, error) {
+	return y.next.GetAccountBalance(ctx, budgetID, accountID)
+}
+
+// cached returns the cached value for key, or calls fetch and caches its result for ttl.
+// Errors aren't cached.
+func cached[T any](y *Ynab, key string, ttl time.Duration, fetch func() (T, error)) (T, error) {
+	y.mu.Lock()
+	e, ok := y.entries[key]
+	y.mu.Unlock()
+
+	var v T
+	if ok && y.now().Before(e.Expires) && json.Unmarshal(e.Value, &v) == nil {
+		return v, nil
+	}
+
+	v, err := fetch()
+	if err != nil {
+		return v, err
+	}
+
+	dat, err := json.Marshal(v)
+	if err != nil {
+		return v, errors.Wrap(err, "marshalling cache entry")
+	}
+
+	y.mu.Lock()
+	defer y.mu.Unlock()
+
+	y.entries[key] = entry{Value: dat, Expires: y.now().Add(ttl)}
+	y.write()
+
+	return v, nil
+}
+
+// invalidate drops every entry of the budget.
+func (y *Ynab) invalidate(budgetID string) {
+	y.mu.Lock()
+	defer y.mu.Unlock()
+
+	for key := range y.entries {
+		if containsBudget(key, budgetID) {
+			delete(y.entries, key)
+		}
+	}
+
+	y.write()
+}
+
+// containsBudget reports whether the key is of a lookup within the budget.
+// Budget lookups are keyed by name, so a budget ID never matches those.
+func containsBudget(key string, budgetID string) bool {
+	return strings.Contains(key, ":"+budgetID+":") || strings.HasSuffix(key, ":"+budgetID)
+}
+
+// write persists the cache, it must be called with the lock held. The cache only saves requests,
+// so a failure is logged and the cache keeps working from memory.
+func (y *Ynab) write() {
+	// expired entries are of no use to the next run
+	for key, e := range y.entries {
+		if !y.now().Before(e.Expires) {
+			delete(y.entries, key)
+		}
+	}
+
+	err := writeFile(y.path, cacheFile{Version: version, Entries: y.entries})
+	if err != nil {
+		slog.Warn("Writing YNAB cache failed", slog.String("error", err.Error()))
+	}
+}
+
+func writeFile(path string, v any) error {
+	dat, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "marshalling cache")
+	}
+
+	err = fileutil.WriteAtomic(path, dat)
+	if err != nil {
+		return errors.Wrap(err, "writing cache file")
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/bad33ndj3/bunq2ynab/internal/core/service/sync"
+	"github.com/pkg/errors"
+)
+
+func TestLookupsAreCachedUntilExpired(t *testing.T) {
+	ctx := context.Background()
+
+	next := &MockYnab{}
+	y, err := NewYnab(next, t.TempDir(), entity.ConfigCache{})
+	if err != nil {
+		t.Fatalf("NewYnab() error = %v", err)
+	}
+
+	now := time.Now()
+	y.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		b, err := y.GetBudgetByName(ctx, "Budget")
+		if err != nil || b.ID != "budget-1" {
+			t.Fatalf("GetBudgetByName() = %+v, %v", b, err)
+		}
+
+		_, err = y.GetAccountByName(ctx, b.ID, "Checking")
+		if err != nil {
+			t.Fatalf("GetAccountByName() error = %v", err)
+		}
+	}
+
+	if next.Calls != 2 {
+		t.Errorf("Expected a single budget and account lookup, got %d calls", next.Calls)
+	}
+
+	// the account expires before the budget
+	now = now.Add(DefaultTTL.Accounts)
+	_, _ = y.GetBudgetByName(ctx, "Budget")
+	_, _ = y.GetAccountByName(ctx, "budget-1", "Checking")
+
+	if next.Calls != 3 {
+		t.Errorf("Expected only the expired account to be looked up again, got %d calls", next.Calls)
+	}
+}
+
+func TestCacheIsKeptBetweenRuns(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	next := &MockYnab{}
+	y, err := NewYnab(next, dir, entity.ConfigCache{})
+	if err != nil {
+		t.Fatalf("NewYnab() error = %v", err)
+	}
+
+	_, _ = y.GetTransferPayeeID(ctx, "budget-1", "account-1")
+
+	y, err = NewYnab(next, dir, entity.ConfigCache{})
+	if err != nil {
+		t.Fatalf("NewYnab() error = %v", err)
+	}
+
+	id, err := y.GetTransferPayeeID(ctx, "budget-1", "account-1")
+	if err != nil || id != "payee-account-1" {
+		t.Fatalf("GetTransferPayeeID() = %s, %v", id, err)
+	}
+
+	if next.Calls != 1 {
+		t.Errorf("Expected the transfer payee from the earlier run, got %d calls", next.Calls)
+	}
+}
+
+func TestCacheOfAnotherVersionIsDropped(t *testing.T) {
+	ctx := context.Background()
+
+	dir := t.TempDir()
+	// a cache from before the budget currency was cached
+	err := os.WriteFile(filepath.Join(dir, File), []byte(`{"budget:Budget":{"value":{"ID":"budget-1"},"expires":"`+
+		time.Now().Add(time.Hour).Format(time.RFC3339)+`"}}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := &MockYnab{}
+	y, err := NewYnab(next, dir, entity.ConfigCache{})
+	if err != nil {
+		t.Fatalf("NewYnab() error = %v", err)
+	}
+
+	_, _ = y.GetBudgetByName(ctx, "Budget")
+
+	if next.Calls != 1 {
+		t.Errorf("Expected the budget to be looked up again, got %d calls", next.Calls)
+	}
+}
+
+func TestFailedPushDropsBudgetLookups(t *testing.T) {
+	ctx := context.Background()
+
+	next := &MockYnab{PushErr: errors.New("account not found")}
+	y, err := NewYnab(next, t.TempDir(), entity.ConfigCache{})
+	if err != nil {
+		t.Fatalf("NewYnab() error = %v", err)
+	}
+
+	_, _ = y.GetBudgetByName(ctx, "Budget")
+	_, _ = y.GetAccountByName(ctx, "budget-1", "Checking")
+
+	err = y.PushTransactions(ctx, "budget-1", "account-1", nil)
+	if err == nil {
+		t.Fatal("Expected the push error")
+	}
+
+	_, _ = y.GetBudgetByName(ctx, "Budget")
+	_, _ = y.GetAccountByName(ctx, "budget-1", "Checking")
+
+	if next.Calls != 3 {
+		t.Errorf("Expected the account to be looked up again and the budget to stay cached, got %d calls", next.Calls)
+	}
+}
+
+func TestErrorsAreNotCached(t *testing.T) {
+	ctx := context.Background()
+
+	next := &MockYnab{}
+	y, err := NewYnab(next, t.TempDir(), entity.ConfigCache{})
+	if err != nil {
+		t.Fatalf("NewYnab() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err = y.GetAccountByName(ctx, "budget-1", "Missing")
+		if err == nil {
+			t.Fatal("Expected an error for a missing account")
+		}
+	}
+
+	if next.Calls != 2 {
+		t.Errorf("Expected both lookups to reach YNAB, got %d calls", next.Calls)
+	}
+}
+
+// MockYnab counts the lookups that reach it.
+type MockYnab struct {
+	sync.Ynab
+	Calls   int
+	PushErr error
+}
+
+func (m *MockYnab) GetBudgetByName(ctx context.Context, name string) (*entity.Budget, error) {
+	m.Calls++
+	return &entity.Budget{ID: "budget-1", Name: name}, nil
+}
+
+func (m *MockYnab) GetAccountByName(ctx context.Context, budgetID string, name string) (*entity.Account, error) {
+	m.Calls++
+	if name == "Missing" {
+		return nil, errors.New("account not found")
+	}
+
+	return &entity.Account{BudgetID: "account-1", Description: name}, nil
+}
+
+func (m *MockYnab) GetAllCategories(context.Context, string) ([]*entity.GroupWithCategories, error) {
+	m.Calls++
+	return nil, nil
+}
+
+func (m *MockYnab) GetTransferPayeeID(ctx context.Context, budgetID string, accountID string) (string, error) {
+	m.Calls++
+	return "payee-" + accountID, nil
+}
+
+func (m *MockYnab) PushTransactions(context.Context, string, string, []*entity.Transaction) error {
+	return m.PushErr
+}
@@ -0,0 +1,164 @@
+// Package rates provides the exchange rates transactions are converted to the budget currency with.
+package rates
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/bad33ndj3/bunq2ynab/internal/core/service/sync"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"gopkg.in/yaml.v3"
+)
+
+// These are the providers that can be configured.
+const (
+	// ProviderBunq uses the rate bunq applied to a foreign card payment in the budget currency.
+	ProviderBunq = "bunq"
+	// ProviderFile uses the rates file.
+	ProviderFile = "file"
+	// ProviderFixed uses the fixed rates in the config.
+	ProviderFixed = "fixed"
+)
+
+// DefaultProviders is the order providers are tried in when none are configured.
+var DefaultProviders = []string{ProviderBunq, ProviderFile, ProviderFixed}
+
+// provider returns the rate to convert the transaction to currency to, if it has one.
+type provider func(t *entity.Transaction, to string) (decimal.Decimal, bool)
+
+// Rates tries its providers in order until one has a rate.
+type Rates struct {
+	providers []provider
+}
+
+var _ sync.Rates = (*Rates)(nil)
+
+// New returns the rates of the configured providers, reading the rates file when it is set.
+func New(cfg entity.ConfigCurrency) (*Rates, error) {
+	names := cfg.Providers
+	if len(names) == 0 {
+		names = DefaultProviders
+	}
+
+	r := &Rates{}
+	for _, name := range names {
+		switch name {
+		case ProviderBunq:
+			r.providers = append(r.providers, bunqRate)
+		case ProviderFixed:
+			r.providers = append(r.providers, fixedRates(cfg.Fixed))
+		case ProviderFile:
+			if cfg.File == "" {
+				continue
+			}
+
+			rates, err := readFile(cfg.File)
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading rates file '%s'", cfg.File)
+			}
+			r.providers = append(r.providers, rates.rate)
+		default:
+			return nil, fmt.Errorf("unknown rate provider '%s'", name)
+		}
+	}
+
+	return r, nil
+}
+
+// Rate returns the rate of the first provider that has one for the transaction.
+func (r *Rates) Rate(_ context.Context, t *entity.Transaction, to string) (decimal.Decimal, error) {
+	for _, p := range r.providers {
+		if rate, ok := p(t, to); ok {
+			return rate, nil
+		}
+	}
+
+	return decimal.Decimal{}, fmt.Errorf("no rate for %s on %s", pair(t.Currency, to), t.Date.Format(time.DateOnly))
+}
+
+// bunqRate inverts the rate bunq applied to a card payment made in currency to.
+func bunqRate(t *entity.Transaction, to string) (decimal.Decimal, bool) {
+	if t.OriginalCurrency != to || t.ExchangeRate.IsZero() {
+		return decimal.Decimal{}, false
+	}
+
+	return decimal.NewFromInt(1).DivRound(t.ExchangeRate, 6), true
+}
+
+// fixedRates returns a provider of the given rates by currency pair, or the inverse of the inverse pair.
+func fixedRates(rates map[string]decimal.Decimal) provider {
+	return func(t *entity.Transaction, to string) (decimal.Decimal, bool) {
+		return lookup(rates, t.Currency, to)
+	}
+}
+
+// file holds the rates of the rates file by currency pair and date.
+type file map[string]map[string]decimal.Decimal
+
+func readFile(path string) (file, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "reading file")
+	}
+
+	var f file
+	err = yaml.Unmarshal(dat, &f)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing file")
+	}
+
+	for p, byDate := range f {
+		for date := range byDate {
+			_, err = time.Parse(time.DateOnly, date)
+			if err != nil {
+				return nil, errors.Wrapf(err, "parsing date of %s", p)
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// rate returns the latest rate on or before the date of the transaction.
+func (f file) rate(t *entity.Transaction, to string) (decimal.Decimal, bool) {
+	day := t.Date.Format(time.DateOnly)
+	latest := make(map[string]decimal.Decimal, len(f))
+	for p, byDate := range f {
+		dates := make([]string, 0, len(byDate))
+		for date := range byDate {
+			if date <= day {
+				dates = append(dates, date)
+			}
+		}
+
+		if len(dates) > 0 {
+			sort.Strings(dates)
+			latest[p] = byDate[dates[len(dates)-1]]
+		}
+	}
+
+	return lookup(latest, t.Currency, to)
+}
+
+// lookup returns the rate of the pair from/to, or the inverse of the rate of to/from.
+func lookup(rates map[string]decimal.Decimal, from, to string) (decimal.Decimal, bool) {
+	if rate, ok := rates[pair(from, to)]; ok {
+		return rate, true
+	}
+
+	if rate, ok := rates[pair(to, from)]; ok && !rate.IsZero() {
+		return decimal.NewFromInt(1).DivRound(rate, 6), true
+	}
+
+	return decimal.Decimal{}, false
+}
+
+func pair(from, to string) string {
+	return strings.ToUpper(from) + "/" + strings.ToUpper(to)
+}
@@ -0,0 +1,76 @@
+package rates
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/shopspring/decimal"
+)
+
+func TestRates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.yaml")
+	err := os.WriteFile(path, []byte(`
+USD/EUR:
+  "2024-05-01": 0.93
+  "2024-05-10": 0.92
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New(entity.ConfigCurrency{
+		File:  path,
+		Fixed: map[string]decimal.Decimal{"USD/EUR": decimal.RequireFromString("0.90"), "EUR/GBP": decimal.RequireFromString("0.8")},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	date := func(s string) time.Time {
+		d, _ := time.Parse(time.DateOnly, s)
+		return d
+	}
+
+	tests := []struct {
+		name string
+		t    *entity.Transaction
+		to   string
+		want string
+	}{
+		{
+			name: "bunq rate of a card payment in the budget currency",
+			t: &entity.Transaction{
+				Currency: "USD", Date: date("2024-05-12"),
+				OriginalCurrency: "EUR", ExchangeRate: decimal.RequireFromString("1.25"),
+			},
+			to:   "EUR",
+			want: "0.8",
+		},
+		{name: "latest rate in the file", t: &entity.Transaction{Currency: "USD", Date: date("2024-05-12")}, to: "EUR", want: "0.92"},
+		{name: "older rate in the file", t: &entity.Transaction{Currency: "USD", Date: date("2024-05-09")}, to: "EUR", want: "0.93"},
+		{name: "fixed before the file", t: &entity.Transaction{Currency: "USD", Date: date("2024-04-30")}, to: "EUR", want: "0.9"},
+		{name: "inverse fixed rate", t: &entity.Transaction{Currency: "GBP", Date: date("2024-05-12")}, to: "EUR", want: "1.25"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Rate(context.Background(), tt.t, tt.to)
+			if err != nil {
+				t.Fatalf("Rate() error = %v", err)
+			}
+
+			if !got.Equal(decimal.RequireFromString(tt.want)) {
+				t.Errorf("Rate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	_, err = r.Rate(context.Background(), &entity.Transaction{Currency: "JPY"}, "EUR")
+	if err == nil {
+		t.Error("Expected an error for a pair without rates")
+	}
+}
@@ -0,0 +1,172 @@
+package retry
+
+import (
+	"context"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/bad33ndj3/bunq2ynab/internal/core/service/sync"
+	"github.com/shopspring/decimal"
+)
+
+// Bunq retries the requests of a sync.Bunq, until the context of the request is done.
+type Bunq struct {
+	next   sync.Bunq
+	policy Policy
+}
+
+// NewBunq wraps next, retrying its failed requests with the policy.
+func NewBunq(next sync.Bunq, policy Policy) *Bunq {
+	return &Bunq{next: next, policy: policy}
+}
+
+func (b *Bunq) GetTransactions(
+	ctx context.Context,
+	bankID int,
+	from time.Time,
+	afterID int,
+) (res []*entity.Transaction, err error) {
+	err = Do(ctx, b.policy, "bunq get transactions", func() error {
+		res, err = b.next.GetTransactions(ctx, bankID, from, afterID)
+		return err
+	})
+
+	return res, err
+}
+
+func (b *Bunq) GetAllAccounts(ctx context.Context) (res []*entity.Account, err error) {
+	err = Do(ctx, b.policy, "bunq get accounts", func() error {
+		res, err = b.next.GetAllAccounts(ctx)
+		return err
+	})
+
+	return res, err
+}
+
+func (b *Bunq) GetTransaction(ctx context.Context, bankID int, paymentID int) (res *entity.Transaction, err error) {
+	err = Do(ctx, b.policy, "bunq get transaction", func() error {
+		res, err = b.next.GetTransaction(ctx, bankID, paymentID)
+		return err
+	})
+
+	return res, err
+}
+
+func (b *Bunq) GetBalance(ctx context.Context, bankID int) (res decimal.Decimal, err error) {
+	err = Do(ctx, b.policy, "bunq get balance", func() error {
+		res, err = b.next.GetBalance(ctx, bankID)
+		return err
+	})
+
+	return res, err
+}
+
+func (b *Bunq) RegisterNotificationFilters(ctx context.Context, bankID int, url string) error {
+	// registering replaces the filters, so it is safe to repeat
+	return Do(ctx, b.policy, "bunq register notification filters", func() error {
+		return b.next.RegisterNotificationFilters(ctx, bankID, url)
+	})
+}
+
+func (b *Bunq) ParseNotification(body []byte, signature string) (*entity.Notification, error) {
+	return b.next.ParseNotification(body, signature)
+}
+
+// Ynab retries the requests of a sync.Ynab, until the context of the request is done.
+type Ynab struct {
+	next   sync.Ynab
+	policy Policy
+}
+
+// NewYnab wraps next, retrying its failed requests with the policy.
+func NewYnab(next sync.Ynab, policy Policy) *Ynab {
+	return &Ynab{next: next, policy: policy}
+}
+
+func (y *Ynab) GetBudgetByName(ctx context.Context, name string) (res *entity.Budget, err error) {
+	err = Do(ctx, y.policy, "ynab get budget", func() error {
+		res, err = y.next.GetBudgetByName(ctx, name)
+		return err
+	})
+
+	return res, err
+}
+
+func (y *Ynab) GetAccountByName(ctx context.Context, budgetID string, name string) (res *entity.Account, err error) {
+	err = Do(ctx, y.policy, "ynab get account", func() error {
+		res, err = y.next.GetAccountByName(ctx, budgetID, name)
+		return err
+	})
+
+	return res, err
+}
+
+// PushTransactions is only retried on failures that can't have created anything, unless every
+// transaction has an import ID, then YNAB skips whatever an earlier attempt did create.
+func (y *Ynab) PushTransactions(ctx context.Context, budgetID string, accountID string, transactions []*entity.Transaction) error {
+	idempotent := true
+	for _, t := range transactions {
+		if t.ImportID() == "" {
+			idempotent = false
+		}
+	}
+
+	return do(ctx, y.policy, "ynab push transactions", idempotent, func() error {
+		return y.next.PushTransactions(ctx, budgetID, accountID, transactions)
+	})
+}
+
+func (y *Ynab) GetAllCategories(ctx context.Context, budgetID string) (res []*entity.GroupWithCategories, err error) {
+	err = Do(ctx, y.policy, "ynab get categories", func() error {
+		res, err = y.next.GetAllCategories(ctx, budgetID)
+		return err
+	})
+
+	return res, err
+}
+
+func (y *Ynab) GetImportedTransactions(
+	ctx context.Context,
+	budgetID string,
+	accountID string,
+	since time.Time,
+) (res []*entity.ImportedTransaction, err error) {
+	err = Do(ctx, y.policy, "ynab get imported transactions", func() error {
+		res, err = y.next.GetImportedTransactions(ctx, budgetID, accountID, since)
+		return err
+	})
+
+	return res, err
+}
+
+// UpdateTransactions sets fields to absolute values, so it is safe to repeat.
+func (y *Ynab) UpdateTransactions(ctx context.Context, budgetID string, updates []*entity.TransactionUpdate) error {
+	return Do(ctx, y.policy, "ynab update transactions", func() error {
+		return y.next.UpdateTransactions(ctx, budgetID, updates)
+	})
+}
+
+// DeleteTransactions treats transactions that are gone already as deleted, so it is safe to repeat.
+func (y *Ynab) DeleteTransactions(ctx context.Context, budgetID string, deletes []*entity.TransactionDelete) error {
+	return Do(ctx, y.policy, "ynab delete transactions", func() error {
+		return y.next.DeleteTransactions(ctx, budgetID, deletes)
+	})
+}
+
+func (y *Ynab) GetAccountBalance(ctx context.Context, budgetID string, accountID string) (res decimal.Decimal, err error) {
+	err = Do(ctx, y.policy, "ynab get account balance", func() error {
+		res, err = y.next.GetAccountBalance(ctx, budgetID, accountID)
+		return err
+	})
+
+	return res, err
+}
+
+func (y *Ynab) GetTransferPayeeID(ctx context.Context, budgetID string, accountID string) (res string, err error) {
+	err = Do(ctx, y.policy, "ynab get transfer payee", func() error {
+		res, err = y.next.GetTransferPayeeID(ctx, budgetID, accountID)
+		return err
+	})
+
+	return res, err
+}
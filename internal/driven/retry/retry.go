@@ -0,0 +1,156 @@
+// Package retry retries failed bunq and YNAB requests with capped exponential backoff.
+package retry
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Class is the kind of failure, it decides whether a request is retried.
+type Class string
+
+// These are the failure classes. Only rate limited and transient failures are retried.
+const (
+	ClassRateLimited Class = "rate limited"
+	ClassTransient   Class = "transient"
+	ClassAuth        Class = "auth"
+	ClassValidation  Class = "validation"
+	ClassPermanent   Class = "permanent"
+)
+
+// Retryable reports whether requests failing with this class are worth retrying.
+func (c Class) Retryable() bool {
+	return c == ClassRateLimited || c == ClassTransient
+}
+
+// statusCoder is implemented by the adapter errors that carry an HTTP status code.
+type statusCoder interface {
+	StatusCode() int
+}
+
+// retryAfterer is implemented by the adapter errors that carry a Retry-After header.
+type retryAfterer interface {
+	RetryAfter() time.Duration
+}
+
+// Classify returns the Class of err, based on its HTTP status code or, without one, on whether it is a network error.
+func Classify(err error) Class {
+	cause := errors.Cause(err)
+
+	if sc, ok := cause.(statusCoder); ok {
+		code := sc.StatusCode()
+		switch {
+		case code == http.StatusTooManyRequests:
+			return ClassRateLimited
+		case code == http.StatusUnauthorized || code == http.StatusForbidden:
+			return ClassAuth
+		case code == http.StatusRequestTimeout || code >= 500:
+			return ClassTransient
+		case code >= 400:
+			return ClassValidation
+		}
+	}
+
+	if stderrors.Is(cause, context.Canceled) || stderrors.Is(cause, context.DeadlineExceeded) {
+		return ClassPermanent
+	}
+
+	// the standard library wraps network errors with %w, which pkg/errors doesn't unwrap
+	var netErr net.Error
+	if cause == io.EOF || cause == io.ErrUnexpectedEOF || stderrors.As(cause, &netErr) {
+		return ClassTransient
+	}
+
+	return ClassPermanent
+}
+
+// Policy configures how often and how long to wait between attempts.
+type Policy struct {
+	// MaxAttempts is the number of attempts, including the first one.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, it doubles on every retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts.
+	MaxDelay time.Duration
+	// MaxRetryAfter is the longest Retry-After that is waited for, a request asked to wait
+	// longer fails straight away. Zero waits for any Retry-After.
+	MaxRetryAfter time.Duration
+}
+
+// DefaultPolicy gives up after about a minute of retrying.
+var DefaultPolicy = Policy{
+	MaxAttempts: 6,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+	// YNAB can ask to wait until its hourly window frees up, that defers the account instead
+	MaxRetryAfter: 2 * time.Minute,
+}
+
+// delay returns how long to wait before the given retry, starting at 1.
+// It uses full jitter: a random delay up to the capped exponential backoff.
+func (p Policy) delay(retry int) time.Duration {
+	backoff := p.MaxDelay
+	if shift := retry - 1; shift < 32 && p.BaseDelay<<shift < p.MaxDelay {
+		backoff = p.BaseDelay << shift
+	}
+
+	if backoff <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// Do calls fn until it succeeds, fails with an error that isn't retryable, the attempts
+// run out or ctx is done. A Retry-After on the error replaces the backoff.
+func Do(ctx context.Context, p Policy, op string, fn func() error) error {
+	return do(ctx, p, op, true, fn)
+}
+
+// do is Do, but when idempotent is false only rate limited requests are retried,
+// as those are known not to have been processed.
+func do(ctx context.Context, p Policy, op string, idempotent bool, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		class := Classify(err)
+		retryable := class == ClassRateLimited || (idempotent && class.Retryable())
+		if !retryable || attempt >= p.MaxAttempts {
+			return err
+		}
+
+		wait := p.delay(attempt)
+		if ra, ok := errors.Cause(err).(retryAfterer); ok && ra.RetryAfter() > 0 {
+			wait = ra.RetryAfter()
+			if p.MaxRetryAfter > 0 && wait > p.MaxRetryAfter {
+				return errors.Wrapf(err, "%s asked to wait %s", op, wait)
+			}
+		}
+
+		slog.Warn("Retrying request",
+			slog.String("op", op),
+			slog.Int("attempt", attempt),
+			slog.String("class", string(class)),
+			slog.Duration("wait", wait),
+			slog.String("error", err.Error()))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrapf(ctx.Err(), "retrying %s after: %v", op, err)
+		case <-timer.C:
+		}
+	}
+}
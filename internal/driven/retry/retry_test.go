@@ -0,0 +1,164 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/bad33ndj3/bunq2ynab/internal/core/service/sync"
+	"github.com/pkg/errors"
+)
+
+var testPolicy = Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+// statusErr is an adapter error with a status code and optional Retry-After.
+type statusErr struct {
+	code       int
+	retryAfter time.Duration
+}
+
+func (e statusErr) Error() string             { return http.StatusText(e.code) }
+func (e statusErr) StatusCode() int           { return e.code }
+func (e statusErr) RetryAfter() time.Duration { return e.retryAfter }
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Class
+	}{
+		{statusErr{code: http.StatusTooManyRequests}, ClassRateLimited},
+		{errors.Wrap(statusErr{code: http.StatusBadGateway}, "getting payments"), ClassTransient},
+		{statusErr{code: http.StatusUnauthorized}, ClassAuth},
+		{statusErr{code: http.StatusBadRequest}, ClassValidation},
+		{errors.Wrap(io.ErrUnexpectedEOF, "reading response"), ClassTransient},
+		{context.Canceled, ClassPermanent},
+		{errors.New("budget not found"), ClassPermanent},
+	}
+
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestDoRetriesTransientFailures(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), testPolicy, "test", func() error {
+		calls++
+		if calls < 3 {
+			return statusErr{code: http.StatusServiceUnavailable}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	if calls != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls)
+	}
+}
+
+func TestDoGivesUp(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), testPolicy, "test", func() error {
+		calls++
+		return statusErr{code: http.StatusInternalServerError}
+	})
+	if err == nil || calls != testPolicy.MaxAttempts {
+		t.Errorf("Expected to give up after %d attempts, got %d and %v", testPolicy.MaxAttempts, calls, err)
+	}
+}
+
+func TestDoDoesNotRetryValidation(t *testing.T) {
+	calls := 0
+	_ = Do(context.Background(), testPolicy, "test", func() error {
+		calls++
+		return statusErr{code: http.StatusBadRequest}
+	})
+
+	if calls != 1 {
+		t.Errorf("Expected a single attempt, got %d", calls)
+	}
+}
+
+func TestDoHonoursRetryAfter(t *testing.T) {
+	calls := 0
+	start := time.Now()
+	err := Do(context.Background(), testPolicy, "test", func() error {
+		calls++
+		if calls == 1 {
+			return statusErr{code: http.StatusTooManyRequests, retryAfter: 50 * time.Millisecond}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	if waited := time.Since(start); waited < 50*time.Millisecond {
+		t.Errorf("Expected to wait for Retry-After, waited %s", waited)
+	}
+}
+
+func TestDoGivesUpOnLongRetryAfter(t *testing.T) {
+	policy := testPolicy
+	policy.MaxRetryAfter = 10 * time.Millisecond
+
+	calls := 0
+	err := Do(context.Background(), policy, "test", func() error {
+		calls++
+		return statusErr{code: http.StatusTooManyRequests, retryAfter: time.Hour}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("Expected to give up after the first attempt, got %d attempts and %v", calls, err)
+	}
+}
+
+func TestDoStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	err := Do(ctx, Policy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}, "test", func() error {
+		calls++
+		return statusErr{code: http.StatusServiceUnavailable}
+	})
+	if errors.Cause(err) != context.Canceled || calls != 1 {
+		t.Errorf("Expected to stop after the first attempt with context.Canceled, got %d attempts and %v", calls, err)
+	}
+}
+
+func TestPushWithoutImportIDOnlyRetriesRateLimits(t *testing.T) {
+	ctx := context.Background()
+
+	next := &MockYnab{Err: statusErr{code: http.StatusBadGateway}}
+	y := NewYnab(next, testPolicy)
+
+	_ = y.PushTransactions(ctx, "budget", "account", []*entity.Transaction{{}})
+	if next.Pushes != 1 {
+		t.Errorf("Expected a single push without import ID, got %d", next.Pushes)
+	}
+
+	next.Pushes = 0
+	_ = y.PushTransactions(ctx, "budget", "account", []*entity.Transaction{{BankID: 1}})
+	if next.Pushes != testPolicy.MaxAttempts {
+		t.Errorf("Expected %d pushes with import IDs, got %d", testPolicy.MaxAttempts, next.Pushes)
+	}
+}
+
+// MockYnab fails every push with Err.
+type MockYnab struct {
+	sync.Ynab
+	Err    error
+	Pushes int
+}
+
+func (m *MockYnab) PushTransactions(context.Context, string, string, []*entity.Transaction) error {
+	m.Pushes++
+	return m.Err
+}
@@ -0,0 +1,182 @@
+// Package statestrg provides a JSON file backed store for the sync state.
+package statestrg
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/bad33ndj3/bunq2ynab/internal/fileutil"
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+const fileName = "state.json"
+
+// pushedRetention is how long what was pushed for a transaction is kept after its date.
+// It outlasts any sync window in practice, a sync reaching further back only updates the
+// owned fields of older transactions.
+const pushedRetention = 400 * 24 * time.Hour
+
+// state is the content of the state file.
+type state struct {
+	Accounts []*entity.Account `json:"accounts"`
+	// Cursors holds the last synced bunq payment ID per configured account.
+	Cursors map[string]int `json:"cursors"`
+	// Pushed holds what was last pushed to YNAB per import ID.
+	Pushed map[string]entity.Pushed `json:"pushed,omitempty"`
+}
+
+// Storage keeps accounts and sync cursors in a JSON file so they survive between runs.
+type Storage struct {
+	mu   sync.Mutex
+	path string
+	data state
+}
+
+// New creates a Storage in the given directory, loading the existing state if present.
+func New(dir string) (*Storage, error) {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating state dir")
+	}
+
+	s := &Storage{
+		path: filepath.Join(dir, fileName),
+		data: state{Cursors: make(map[string]int), Pushed: make(map[string]entity.Pushed)},
+	}
+
+	dat, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading state file")
+	}
+
+	err = json.Unmarshal(dat, &s.data)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshalling state file")
+	}
+
+	if s.data.Cursors == nil {
+		s.data.Cursors = make(map[string]int)
+	}
+
+	if s.data.Pushed == nil {
+		s.data.Pushed = make(map[string]entity.Pushed)
+	}
+
+	return s, nil
+}
+
+func (s *Storage) GetAccountByName(_ context.Context, name string) (*entity.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := lo.Filter(s.data.Accounts, func(a *entity.Account, _ int) bool {
+		return a.Description == name
+	})
+
+	if len(res) == 0 {
+		return nil, errors.New("account not found")
+	}
+
+	if len(res) > 1 {
+		return nil, errors.New("multiple accounts found")
+	}
+
+	acc := *res[0]
+	return &acc, nil
+}
+
+// SaveAccount stores the account, replacing a previously saved account with the same bank ID.
+func (s *Storage) SaveAccount(_ context.Context, b entity.Account) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// transactions are fetched on every sync, there is no need to keep them around.
+	b.Transactions = nil
+
+	_, i, found := lo.FindIndexOf(s.data.Accounts, func(a *entity.Account) bool {
+		return a.BankID == b.BankID
+	})
+	if found {
+		s.data.Accounts[i] = &b
+	} else {
+		s.data.Accounts = append(s.data.Accounts, &b)
+	}
+
+	return s.write()
+}
+
+// GetCursor returns the last synced bunq payment ID for the account, or 0 if it was never synced.
+func (s *Storage) GetCursor(_ context.Context, account entity.ConfigAccount) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.data.Cursors[account.Key()], nil
+}
+
+// SaveCursor stores the last synced bunq payment ID for the account.
+func (s *Storage) SaveCursor(_ context.Context, account entity.ConfigAccount, bankID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Cursors[account.Key()] = bankID
+
+	return s.write()
+}
+
+// GetPushed returns what was last pushed to YNAB for the import ID, false if nothing was recorded.
+func (s *Storage) GetPushed(_ context.Context, importID string) (entity.Pushed, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.data.Pushed[importID]
+	return p, ok, nil
+}
+
+// SavePushed records what was pushed to YNAB per import ID and drops the records of
+// transactions older than the retention. Records without a date are kept for the
+// retention from when they were saved.
+func (s *Storage) SavePushed(_ context.Context, pushed map[string]entity.Pushed) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, p := range pushed {
+		s.data.Pushed[id] = p
+	}
+
+	now := time.Now()
+	for id, p := range s.data.Pushed {
+		if p.Date.IsZero() {
+			p.Date = now
+			s.data.Pushed[id] = p
+		}
+		if now.Sub(p.Date) > pushedRetention {
+			delete(s.data.Pushed, id)
+		}
+	}
+
+	return s.write()
+}
+
+// write persists the state, it must be called with the lock held.
+func (s *Storage) write() error {
+	dat, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshalling state")
+	}
+
+	err = fileutil.WriteAtomic(s.path, dat)
+	if err != nil {
+		return errors.Wrap(err, "writing state file")
+	}
+
+	return nil
+}
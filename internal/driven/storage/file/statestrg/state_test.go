@@ -0,0 +1,142 @@
+package statestrg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/shopspring/decimal"
+)
+
+func TestSaveAccountPersists(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	storage, err := New(dir)
+	if err != nil {
+		t.Fatalf("Error creating storage: %v", err)
+	}
+
+	err = storage.SaveAccount(ctx, entity.Account{BankID: 1, Description: "Test Account 1"})
+	if err != nil {
+		t.Fatalf("Error saving account: %v", err)
+	}
+
+	// Saving the same bank account again replaces it
+	err = storage.SaveAccount(ctx, entity.Account{BankID: 1, Description: "Test Account 1"})
+	if err != nil {
+		t.Fatalf("Error saving duplicate account: %v", err)
+	}
+
+	reopened, err := New(dir)
+	if err != nil {
+		t.Fatalf("Error reopening storage: %v", err)
+	}
+
+	account, err := reopened.GetAccountByName(ctx, "Test Account 1")
+	if err != nil {
+		t.Fatalf("Error retrieving account: %v", err)
+	}
+	if account.BankID != 1 {
+		t.Errorf("Expected bank ID 1, got %d", account.BankID)
+	}
+
+	_, err = reopened.GetAccountByName(ctx, "Nonexistent Account")
+	if err == nil {
+		t.Errorf("Expected error for nonexistent account, got none")
+	}
+}
+
+func TestCursorPersists(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	account := entity.ConfigAccount{BunqAccountName: "bunq", YnabBudgetName: "budget", YnabAccountName: "ynab"}
+
+	storage, err := New(dir)
+	if err != nil {
+		t.Fatalf("Error creating storage: %v", err)
+	}
+
+	cursor, err := storage.GetCursor(ctx, account)
+	if err != nil || cursor != 0 {
+		t.Fatalf("Expected empty cursor, got %d (%v)", cursor, err)
+	}
+
+	err = storage.SaveCursor(ctx, account, 42)
+	if err != nil {
+		t.Fatalf("Error saving cursor: %v", err)
+	}
+
+	reopened, err := New(dir)
+	if err != nil {
+		t.Fatalf("Error reopening storage: %v", err)
+	}
+
+	cursor, err = reopened.GetCursor(ctx, account)
+	if err != nil || cursor != 42 {
+		t.Errorf("Expected cursor 42, got %d (%v)", cursor, err)
+	}
+}
+
+func TestPushedPersists(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	storage, err := New(dir)
+	if err != nil {
+		t.Fatalf("Error creating storage: %v", err)
+	}
+
+	pushed := entity.Pushed{Amount: decimal.RequireFromString("-12.50"), Memo: "AH: groceries"}
+	err = storage.SavePushed(ctx, map[string]entity.Pushed{"BUNQ:1:1": pushed})
+	if err != nil {
+		t.Fatalf("Error saving pushed: %v", err)
+	}
+
+	reopened, err := New(dir)
+	if err != nil {
+		t.Fatalf("Error reopening storage: %v", err)
+	}
+
+	got, found, err := reopened.GetPushed(ctx, "BUNQ:1:1")
+	if err != nil || !found || !got.Amount.Equal(pushed.Amount) || got.Memo != pushed.Memo {
+		t.Errorf("Expected %+v, got %+v (found %t, %v)", pushed, got, found, err)
+	}
+
+	_, found, _ = reopened.GetPushed(ctx, "BUNQ:2:1")
+	if found {
+		t.Error("Expected nothing for an import ID that was never pushed")
+	}
+}
+
+func TestSavePushedDropsOldRecords(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	storage, err := New(dir)
+	if err != nil {
+		t.Fatalf("Error creating storage: %v", err)
+	}
+
+	err = storage.SavePushed(ctx, map[string]entity.Pushed{
+		"BUNQ:1:1": {Memo: "old", Date: time.Now().Add(-pushedRetention - 24*time.Hour)},
+		"BUNQ:2:1": {Memo: "recent", Date: time.Now().Add(-24 * time.Hour)},
+		"BUNQ:3:1": {Memo: "undated"},
+	})
+	if err != nil {
+		t.Fatalf("Error saving pushed: %v", err)
+	}
+
+	reopened, err := New(dir)
+	if err != nil {
+		t.Fatalf("Error reopening storage: %v", err)
+	}
+
+	for id, want := range map[string]bool{"BUNQ:1:1": false, "BUNQ:2:1": true, "BUNQ:3:1": true} {
+		_, found, err := reopened.GetPushed(ctx, id)
+		if err != nil || found != want {
+			t.Errorf("Expected %s found to be %t, got %t (%v)", id, want, found, err)
+		}
+	}
+}
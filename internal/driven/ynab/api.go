@@ -0,0 +1,179 @@
+package ynab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	gosync "sync"
+	"time"
+
+	"github.com/brunomvsouza/ynab.go/api"
+	"github.com/brunomvsouza/ynab.go/api/account"
+	"github.com/brunomvsouza/ynab.go/api/budget"
+	"github.com/brunomvsouza/ynab.go/api/category"
+	"github.com/brunomvsouza/ynab.go/api/payee"
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+	"github.com/pkg/errors"
+)
+
+// DefaultBaseURL is the YNAB API.
+const DefaultBaseURL = "https://api.youneedabudget.com/v1"
+
+// requestTimeout bounds a single YNAB request, so a hung connection can't stall a sync.
+const requestTimeout = 30 * time.Second
+
+// apiClient sends the requests of the ynab.go services. The ynab.go client itself always
+// talks to DefaultBaseURL, this one to any base URL, e.g. a local fake.
+type apiClient struct {
+	baseURL     string
+	accessToken string
+	http        *http.Client
+
+	mu        gosync.Mutex
+	rateLimit *api.RateLimit
+}
+
+func newAPIClient(baseURL, accessToken string) *apiClient {
+	return &apiClient{
+		baseURL:     baseURL,
+		accessToken: accessToken,
+		http:        &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// RateLimit returns the rate limit of the last successful request.
+func (c *apiClient) RateLimit() *api.RateLimit {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.rateLimit
+}
+
+// with returns the ynab.go services for a single call, their requests are sent with ctx.
+func (c *apiClient) with(ctx context.Context) *requester {
+	return &requester{c: c, ctx: ctx}
+}
+
+// requester sends the requests of the ynab.go services, which take no context, with the context of the call.
+type requester struct {
+	c   *apiClient
+	ctx context.Context
+}
+
+func (r *requester) Budget() *budget.Service           { return budget.NewService(r) }
+func (r *requester) Account() *account.Service         { return account.NewService(r) }
+func (r *requester) Category() *category.Service       { return category.NewService(r) }
+func (r *requester) Payee() *payee.Service             { return payee.NewService(r) }
+func (r *requester) Transaction() *transaction.Service { return transaction.NewService(r) }
+
+func (r *requester) GET(url string, responseModel interface{}) error {
+	return r.c.do(r.ctx, http.MethodGet, url, responseModel, nil)
+}
+
+func (r *requester) POST(url string, responseModel interface{}, requestBody []byte) error {
+	return r.c.do(r.ctx, http.MethodPost, url, responseModel, requestBody)
+}
+
+func (r *requester) PUT(url string, responseModel interface{}, requestBody []byte) error {
+	return r.c.do(r.ctx, http.MethodPut, url, responseModel, requestBody)
+}
+
+func (r *requester) PATCH(url string, responseModel interface{}, requestBody []byte) error {
+	return r.c.do(r.ctx, http.MethodPatch, url, responseModel, requestBody)
+}
+
+// do sends a request and decodes the response into responseModel.
+// Error responses are returned as an *Error.
+func (c *apiClient) do(
+	ctx context.Context,
+	method, path string,
+	responseModel interface{},
+	requestBody []byte,
+) error {
+	res, err := c.send(ctx, method, path, requestBody)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "reading response")
+	}
+
+	if res.StatusCode >= 400 {
+		return apiError(res, body)
+	}
+
+	rl, err := api.ParseRateLimit(res.Header.Get("X-Rate-Limit"))
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.rateLimit = rl
+	c.mu.Unlock()
+
+	return json.Unmarshal(body, &responseModel)
+}
+
+// send sends an authenticated request to path under the base URL.
+func (c *apiClient) send(ctx context.Context, method, path string, requestBody []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(requestBody))
+	if err != nil {
+		return nil, errors.Wrap(err, "creating request")
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.accessToken))
+	if requestBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return c.http.Do(req)
+}
+
+// Error is an error response of the YNAB API, with its status code and Retry-After header.
+type Error struct {
+	// API is the error YNAB sent, or one made up from the status code when the body has none.
+	API        *api.Error
+	Status     int
+	retryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return e.API.Error()
+}
+
+// StatusCode returns the HTTP status code of the response.
+func (e *Error) StatusCode() int {
+	return e.Status
+}
+
+// RetryAfter returns the wait asked for by the Retry-After header, or 0 without one.
+func (e *Error) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
+// apiError returns the *Error of an error response.
+func apiError(res *http.Response, body []byte) error {
+	e := &Error{Status: res.StatusCode}
+	if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil {
+		e.retryAfter = time.Duration(seconds) * time.Second
+	}
+
+	var b struct {
+		Error *api.Error `json:"error"`
+	}
+	if json.Unmarshal(body, &b) == nil && b.Error != nil {
+		e.API = b.Error
+	} else {
+		e.API = &api.Error{ID: strconv.Itoa(res.StatusCode), Name: "unknown_api_error", Detail: "Unknown API error"}
+	}
+
+	return e
+}
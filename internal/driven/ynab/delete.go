@@ -0,0 +1,47 @@
+package ynab
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+)
+
+// DeleteTransactions removes transactions from the budget, one request each.
+// A transaction that is gone already counts as deleted, so a failed call can be repeated.
+func (c *Client) DeleteTransactions(ctx context.Context, budgetID string, deletes []*entity.TransactionDelete) error {
+	for _, d := range deletes {
+		err := c.call(func() error {
+			return c.deleteTransaction(ctx, budgetID, d.ID)
+		})
+		if err != nil {
+			return errors.Wrapf(err, "deleting transaction %s", d.ID)
+		}
+	}
+
+	return nil
+}
+
+// deleteTransaction sends the DELETE itself, the ynab.go services have no method for it.
+// Errors are returned as an *Error like the other requests, so they are classified the same.
+func (c *Client) deleteTransaction(ctx context.Context, budgetID, transactionID string) error {
+	res, err := c.yn.send(ctx, http.MethodDelete, fmt.Sprintf("/budgets/%s/transactions/%s", budgetID, transactionID), nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound || res.StatusCode < 400 {
+		return nil
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return errors.Wrap(err, "reading response")
+	}
+
+	return apiError(res, body)
+}
@@ -0,0 +1,169 @@
+package ynab
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/fileutil"
+	"github.com/brunomvsouza/ynab.go/api/account"
+	"github.com/brunomvsouza/ynab.go/api/category"
+	"github.com/pkg/errors"
+)
+
+// DeltaFile is the file in the state directory the YNAB snapshots are kept in.
+const DeltaFile = "ynab-delta.json"
+
+// budgetSnapshot is the last known state of the accounts and categories of a budget,
+// with the server knowledge they were fetched at.
+type budgetSnapshot struct {
+	AccountsKnowledge   uint64                          `json:"accounts_knowledge"`
+	Accounts            []*account.Account              `json:"accounts"`
+	CategoriesKnowledge uint64                          `json:"categories_knowledge"`
+	Groups              []*category.GroupWithCategories `json:"groups"`
+}
+
+// Snapshots keeps the accounts and categories per budget between runs, so YNAB
+// only has to send what changed since, using delta requests.
+type Snapshots struct {
+	mu      sync.Mutex
+	path    string
+	budgets map[string]*budgetSnapshot
+}
+
+// NewSnapshots creates Snapshots that are kept in the given directory, loading the existing snapshots if present.
+func NewSnapshots(dir string) (*Snapshots, error) {
+	s := &Snapshots{
+		path:    filepath.Join(dir, DeltaFile),
+		budgets: make(map[string]*budgetSnapshot),
+	}
+
+	dat, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading delta file")
+	}
+
+	err = json.Unmarshal(dat, &s.budgets)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshalling delta file")
+	}
+
+	return s, nil
+}
+
+// accountsKnowledge returns the server knowledge of the stored accounts, 0 when there are none.
+func (s *Snapshots) accountsKnowledge(budgetID string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.budgets[budgetID]; ok {
+		return b.AccountsKnowledge
+	}
+
+	return 0
+}
+
+// mergeAccounts applies the changed accounts to the snapshot and returns all accounts that aren't deleted.
+func (s *Snapshots) mergeAccounts(budgetID string, sm *account.SearchResultSnapshot) ([]*account.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.budget(budgetID)
+	for _, changed := range sm.Accounts {
+		b.Accounts = replaceByID(b.Accounts, changed, func(a *account.Account) string { return a.ID })
+	}
+	b.AccountsKnowledge = sm.ServerKnowledge
+
+	var res []*account.Account
+	for _, a := range b.Accounts {
+		if !a.Deleted {
+			res = append(res, a)
+		}
+	}
+
+	return res, s.write()
+}
+
+// categoriesKnowledge returns the server knowledge of the stored categories, 0 when there are none.
+func (s *Snapshots) categoriesKnowledge(budgetID string) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.budgets[budgetID]; ok {
+		return b.CategoriesKnowledge
+	}
+
+	return 0
+}
+
+// mergeCategories applies the changed groups and categories to the snapshot and returns all groups.
+// A changed group only holds its changed categories, the others are kept from the snapshot.
+func (s *Snapshots) mergeCategories(
+	budgetID string,
+	sm *category.SearchResultSnapshot,
+) ([]*category.GroupWithCategories, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.budget(budgetID)
+	for _, changed := range sm.GroupWithCategories {
+		categories := changed.Categories
+		for _, g := range b.Groups {
+			if g.ID == changed.ID {
+				categories = g.Categories
+				for _, c := range changed.Categories {
+					categories = replaceByID(categories, c, func(c *category.Category) string { return c.ID })
+				}
+			}
+		}
+
+		g := *changed
+		g.Categories = categories
+		b.Groups = replaceByID(b.Groups, &g, func(g *category.GroupWithCategories) string { return g.ID })
+	}
+	b.CategoriesKnowledge = sm.ServerKnowledge
+
+	return b.Groups, s.write()
+}
+
+// budget returns the snapshot of the budget, creating it if needed. It must be called with the lock held.
+func (s *Snapshots) budget(budgetID string) *budgetSnapshot {
+	b, ok := s.budgets[budgetID]
+	if !ok {
+		b = &budgetSnapshot{}
+		s.budgets[budgetID] = b
+	}
+
+	return b
+}
+
+// write persists the snapshots, it must be called with the lock held.
+func (s *Snapshots) write() error {
+	dat, err := json.Marshal(s.budgets)
+	if err != nil {
+		return errors.Wrap(err, "marshalling snapshots")
+	}
+
+	err = fileutil.WriteAtomic(s.path, dat)
+	if err != nil {
+		return errors.Wrap(err, "writing delta file")
+	}
+
+	return nil
+}
+
+// replaceByID replaces the item with the same ID as v, or appends v when there is none.
+func replaceByID[T any](items []T, v T, id func(T) string) []T {
+	for i := range items {
+		if id(items[i]) == id(v) {
+			items[i] = v
+			return items
+		}
+	}
+
+	return append(items, v)
+}
@@ -0,0 +1,82 @@
+package ynab
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/fake/fakeynab"
+)
+
+// newFakeClient returns a Client talking to a fake YNAB API, with snapshots in dir.
+func newFakeClient(t *testing.T, fake *fakeynab.Server, dir string) *Client {
+	t.Helper()
+
+	snapshots, err := NewSnapshots(dir)
+	if err != nil {
+		t.Fatalf("NewSnapshots() error = %v", err)
+	}
+
+	return NewClient(fake.URL+"/v1", "token", nil, snapshots)
+}
+
+func TestAccountsAreMergedFromDeltas(t *testing.T) {
+	ctx := context.Background()
+
+	fake := fakeynab.New()
+	defer fake.Close()
+
+	budgetID := fake.AddBudget("Budget")
+	fake.AddAccount(budgetID, "Checking")
+	savingsID := fake.AddAccount(budgetID, "Savings")
+
+	dir := t.TempDir()
+	c := newFakeClient(t, fake, dir)
+
+	_, err := c.GetAccountByName(ctx, budgetID, "Checking")
+	if err != nil {
+		t.Fatalf("GetAccountByName() error = %v", err)
+	}
+
+	fake.AddAccount(budgetID, "Credit card")
+	fake.DeleteAccount(budgetID, savingsID)
+
+	// a new run only gets the changes, and still knows the accounts that didn't change
+	c = newFakeClient(t, fake, dir)
+
+	for name, found := range map[string]bool{"Checking": true, "Credit card": true, "Savings": false} {
+		_, err = c.GetAccountByName(ctx, budgetID, name)
+		if (err == nil) != found {
+			t.Errorf("GetAccountByName(%s) error = %v, expected found %t", name, err, found)
+		}
+	}
+
+	if k := c.snapshots.accountsKnowledge(budgetID); k == 0 {
+		t.Error("Expected the server knowledge to be stored")
+	}
+}
+
+func TestCategoriesAreMergedFromDeltas(t *testing.T) {
+	fake := fakeynab.New()
+	defer fake.Close()
+
+	budgetID := fake.AddBudget("Budget")
+	fake.AddCategory(budgetID, "Bills", "Rent")
+
+	c := newFakeClient(t, fake, t.TempDir())
+
+	_, err := c.GetAllCategories(context.Background(), budgetID)
+	if err != nil {
+		t.Fatalf("GetAllCategories() error = %v", err)
+	}
+
+	fake.AddCategory(budgetID, "Bills", "Energy")
+
+	groups, err := c.GetAllCategories(context.Background(), budgetID)
+	if err != nil {
+		t.Fatalf("GetAllCategories() error = %v", err)
+	}
+
+	if len(groups) != 1 || len(groups[0].Categories) != 2 {
+		t.Fatalf("Expected one group with the old and the new category, got %+v", groups)
+	}
+}
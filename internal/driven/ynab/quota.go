@@ -0,0 +1,240 @@
+package ynab
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/bad33ndj3/bunq2ynab/internal/fileutil"
+	"github.com/brunomvsouza/ynab.go/api"
+	"github.com/pkg/errors"
+)
+
+const (
+	// QuotaFile is the file in the state directory the YNAB request log is kept in.
+	QuotaFile = "ynab-quota.json"
+	// DefaultRateLimit is the number of requests YNAB allows per access token per hour.
+	DefaultRateLimit = 200
+	// rateLimitWindow is the rolling window of the YNAB rate limit.
+	rateLimitWindow = time.Hour
+)
+
+// QuotaError is returned instead of making a request that would exceed the rate limit.
+type QuotaError struct {
+	Quota entity.Quota
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("YNAB rate limit of %d requests per hour reached, resets at %s",
+		e.Quota.Limit, e.Quota.ResetAt.Format(time.TimeOnly))
+}
+
+// trackerState is the content of the quota file.
+type trackerState struct {
+	Limit    int         `json:"limit"`
+	Requests []time.Time `json:"requests"`
+	// BlockedUntil is the end of the wait YNAB asked for after rate limiting a request.
+	BlockedUntil time.Time `json:"blocked_until,omitempty"`
+}
+
+// Tracker counts YNAB requests within the rate limit window and keeps the count between runs.
+// The X-Rate-Limit header YNAB sends is leading, so requests made with the same token by
+// other apps are counted as well.
+type Tracker struct {
+	mu   sync.Mutex
+	path string
+	now  func() time.Time
+	data trackerState
+}
+
+// NewTracker creates a Tracker that keeps its state in the given directory, loading the existing state if present.
+func NewTracker(dir string) (*Tracker, error) {
+	t := &Tracker{
+		path: filepath.Join(dir, QuotaFile),
+		now:  time.Now,
+		data: trackerState{Limit: DefaultRateLimit},
+	}
+
+	dat, err := os.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "reading quota file")
+	}
+
+	err = json.Unmarshal(dat, &t.data)
+	if err != nil {
+		return nil, errors.Wrap(err, "unmarshalling quota file")
+	}
+
+	if t.data.Limit <= 0 {
+		t.data.Limit = DefaultRateLimit
+	}
+
+	return t, nil
+}
+
+// Quota returns the current use of the rate limit.
+func (t *Tracker) Quota() entity.Quota {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune()
+
+	return t.quota()
+}
+
+// Reserve returns a *QuotaError when no requests are left.
+func (t *Tracker) Reserve() error {
+	q := t.Quota()
+	if q.Remaining() == 0 {
+		return &QuotaError{Quota: q}
+	}
+
+	return nil
+}
+
+// Record counts a request that was just made. The rate limit YNAB reported is nil when the request failed.
+func (t *Tracker) Record(rl *api.RateLimit) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.prune()
+
+	now := t.now()
+	t.data.Requests = append(t.data.Requests, now)
+
+	if rl != nil {
+		t.data.Limit = int(rl.Total())
+
+		// requests we don't know about were made elsewhere, count them as made now
+		for i := len(t.data.Requests); i < int(rl.Used()); i++ {
+			t.data.Requests = append(t.data.Requests, now)
+		}
+	}
+
+	return t.write()
+}
+
+// Block counts the rate limit as used up until the given time, when YNAB asked to wait that long.
+func (t *Tracker) Block(until time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if until.After(t.data.BlockedUntil) {
+		t.data.BlockedUntil = until
+	}
+
+	return t.write()
+}
+
+// prune drops the requests that are outside the window, it must be called with the lock held.
+func (t *Tracker) prune() {
+	start := t.now().Add(-rateLimitWindow)
+
+	i := 0
+	for i < len(t.data.Requests) && !t.data.Requests[i].After(start) {
+		i++
+	}
+
+	t.data.Requests = t.data.Requests[i:]
+}
+
+// quota must be called with the lock held.
+func (t *Tracker) quota() entity.Quota {
+	q := entity.Quota{Used: len(t.data.Requests), Limit: t.data.Limit}
+	if len(t.data.Requests) > 0 {
+		q.ResetAt = t.data.Requests[0].Add(rateLimitWindow)
+	}
+
+	if t.now().Before(t.data.BlockedUntil) {
+		q.Used = q.Limit
+		if q.ResetAt.Before(t.data.BlockedUntil) {
+			q.ResetAt = t.data.BlockedUntil
+		}
+	}
+
+	return q
+}
+
+// write persists the state, it must be called with the lock held.
+// Other processes using the same state directory record their requests in the file as well,
+// so it is merged with the file under a file lock instead of replacing it.
+func (t *Tracker) write() error {
+	unlock, err := fileutil.Lock(t.path)
+	if err != nil {
+		return errors.Wrap(err, "locking quota file")
+	}
+	defer unlock()
+
+	err = t.merge()
+	if err != nil {
+		return err
+	}
+
+	dat, err := json.Marshal(t.data)
+	if err != nil {
+		return errors.Wrap(err, "marshalling quota")
+	}
+
+	err = fileutil.WriteAtomic(t.path, dat)
+	if err != nil {
+		return errors.Wrap(err, "writing quota file")
+	}
+
+	return nil
+}
+
+// merge adds the requests and block in the quota file to the state, it must be called with
+// both locks held.
+func (t *Tracker) merge() error {
+	dat, err := os.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "reading quota file")
+	}
+
+	var stored trackerState
+	err = json.Unmarshal(dat, &stored)
+	if err != nil {
+		return errors.Wrap(err, "unmarshalling quota file")
+	}
+
+	t.data.Requests = mergeRequests(t.data.Requests, stored.Requests)
+	if stored.BlockedUntil.After(t.data.BlockedUntil) {
+		t.data.BlockedUntil = stored.BlockedUntil
+	}
+	t.prune()
+
+	return nil
+}
+
+// mergeRequests returns the requests of both sorted logs, sorted. A request that is in both,
+// because it was written to the file before, is counted once.
+func mergeRequests(a, b []time.Time) []time.Time {
+	res := make([]time.Time, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case j == len(b) || i < len(a) && a[i].Before(b[j]):
+			res = append(res, a[i])
+			i++
+		case i == len(a) || b[j].Before(a[i]):
+			res = append(res, b[j])
+			j++
+		default:
+			res = append(res, a[i])
+			i++
+			j++
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,128 @@
+package ynab
+
+import (
+	"testing"
+	"time"
+
+	"github.com/brunomvsouza/ynab.go/api"
+)
+
+func rateLimit(t *testing.T, s string) *api.RateLimit {
+	t.Helper()
+
+	rl, err := api.ParseRateLimit(s)
+	if err != nil {
+		t.Fatalf("parsing rate limit: %v", err)
+	}
+
+	return rl
+}
+
+func TestTrackerCountsRequestsInWindow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tr, err := NewTracker(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewTracker() error = %v", err)
+	}
+	tr.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		err = tr.Record(nil)
+		if err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+		now = now.Add(20 * time.Minute)
+	}
+
+	// the first request is an hour old now
+	q := tr.Quota()
+	if q.Used != 2 || q.Remaining() != DefaultRateLimit-2 {
+		t.Errorf("Expected 2 requests in the window, got %+v", q)
+	}
+
+	if want := time.Date(2024, 1, 1, 13, 20, 0, 0, time.UTC); !q.ResetAt.Equal(want) {
+		t.Errorf("Expected the quota to reset at %s, got %s", want, q.ResetAt)
+	}
+}
+
+func TestTrackerFollowsRateLimitHeader(t *testing.T) {
+	tr, err := NewTracker(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewTracker() error = %v", err)
+	}
+
+	// another app used the same token
+	err = tr.Record(rateLimit(t, "150/200"))
+	if err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	if q := tr.Quota(); q.Used != 150 || q.Limit != 200 {
+		t.Errorf("Expected 150 of 200 used, got %+v", q)
+	}
+
+	err = tr.Record(rateLimit(t, "200/200"))
+	if err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	if _, ok := tr.Reserve().(*QuotaError); !ok {
+		t.Errorf("Expected a *QuotaError with the quota used up, got %v", tr.Reserve())
+	}
+}
+
+func TestTrackerPersistsBetweenRuns(t *testing.T) {
+	dir := t.TempDir()
+	tr, err := NewTracker(dir)
+	if err != nil {
+		t.Fatalf("NewTracker() error = %v", err)
+	}
+
+	err = tr.Record(rateLimit(t, "10/200"))
+	if err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	tr, err = NewTracker(dir)
+	if err != nil {
+		t.Fatalf("NewTracker() error = %v", err)
+	}
+
+	if q := tr.Quota(); q.Used != 10 {
+		t.Errorf("Expected the 10 requests of the earlier run, got %+v", q)
+	}
+}
+
+func TestTrackersShareTheQuotaFile(t *testing.T) {
+	dir := t.TempDir()
+	serve, err := NewTracker(dir)
+	if err != nil {
+		t.Fatalf("NewTracker() error = %v", err)
+	}
+
+	manual, err := NewTracker(dir)
+	if err != nil {
+		t.Fatalf("NewTracker() error = %v", err)
+	}
+
+	// both processes record requests after loading the same file
+	for _, tr := range []*Tracker{serve, manual, serve} {
+		err = tr.Record(nil)
+		if err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	if q := serve.Quota(); q.Used != 3 {
+		t.Errorf("Expected the requests of both trackers, got %+v", q)
+	}
+
+	tr, err := NewTracker(dir)
+	if err != nil {
+		t.Fatalf("NewTracker() error = %v", err)
+	}
+
+	if q := tr.Quota(); q.Used != 3 {
+		t.Errorf("Expected the 3 requests of both trackers in the file, got %+v", q)
+	}
+}
@@ -2,36 +2,98 @@ package ynab
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
 
 	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
-	"github.com/brunomvsouza/ynab.go"
 	"github.com/brunomvsouza/ynab.go/api"
 	"github.com/brunomvsouza/ynab.go/api/account"
 	"github.com/brunomvsouza/ynab.go/api/budget"
 	"github.com/brunomvsouza/ynab.go/api/category"
+	"github.com/brunomvsouza/ynab.go/api/payee"
 	"github.com/brunomvsouza/ynab.go/api/transaction"
 	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
 )
 
 type Client struct {
-	yn ynab.ClientServicer
+	yn        *apiClient
+	tracker   *Tracker
+	snapshots *Snapshots
 }
 
-func NewClient(yn ynab.ClientServicer) *Client {
-	return &Client{yn: yn}
+// NewClient creates a Client for the YNAB API at baseURL, usually DefaultBaseURL.
+// Requests are counted against the rate limit by tracker unless it is nil.
+// With snapshots, accounts and categories are fetched with delta requests.
+func NewClient(baseURL, accessToken string, tracker *Tracker, snapshots *Snapshots) *Client {
+	return &Client{
+		yn:        newAPIClient(baseURL, accessToken),
+		tracker:   tracker,
+		snapshots: snapshots,
+	}
+}
+
+// call makes a single YNAB request with fn, refusing it when the rate limit is reached.
+func (c *Client) call(fn func() error) error {
+	if c.tracker == nil {
+		return fn()
+	}
+
+	err := c.tracker.Reserve()
+	if err != nil {
+		return err
+	}
+
+	err = fn()
+
+	// the client only keeps the rate limit of successful requests
+	var rl *api.RateLimit
+	if err == nil {
+		rl = c.yn.RateLimit()
+	}
+
+	terr := c.tracker.Record(rl)
+
+	// a rate limited request blocks the others for as long as YNAB asked to wait
+	e, ok := errors.Cause(err).(*Error)
+	if ok && e.Status == http.StatusTooManyRequests && e.RetryAfter() > 0 && terr == nil {
+		terr = c.tracker.Block(c.tracker.now().Add(e.RetryAfter()))
+	}
+
+	if terr != nil {
+		slog.Warn("Tracking YNAB request failed", slog.String("error", terr.Error()))
+	}
+
+	return err
 }
 
+// PushTransactions creates the transactions in the account. A transaction with an FX fee is
+// created as a split, with the fee in a part of its own.
 func (c *Client) PushTransactions(
+	ctx context.Context,
 	budgetID, accountID string,
 	transactions []*entity.Transaction,
 ) error {
-	var ynabTransactions []transaction.PayloadTransaction
+	// the payloads of the ynab.go services can't hold split parts, so this one is sent directly
+	var payload struct {
+		Transactions []payloadTransaction `json:"transactions"`
+	}
 	for _, t := range transactions {
-		ynabTransactions = append(ynabTransactions, domainToYnabTransaction(t, accountID))
+		payload.Transactions = append(payload.Transactions, domainToYnabTransaction(t, accountID))
+	}
+
+	dat, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "marshalling transactions")
 	}
 
-	_, err := c.yn.Transaction().CreateTransactions(budgetID, ynabTransactions)
+	err = c.call(func() error {
+		var res struct{}
+		return c.yn.do(ctx, http.MethodPost, fmt.Sprintf("/budgets/%s/transactions", budgetID), &res, dat)
+	})
 	if err != nil {
 		return errors.Wrap(err, "creating transactions")
 	}
@@ -39,64 +101,275 @@ func (c *Client) PushTransactions(
 	return nil
 }
 
+// payloadTransaction is a transaction to create with its split parts,
+// the ynab.go payload can't hold the parts.
+type payloadTransaction struct {
+	transaction.PayloadTransaction
+	SubTransactions []payloadSubTransaction `json:"subtransactions,omitempty"`
+}
+
+// payloadSubTransaction is a part of a split transaction.
+type payloadSubTransaction struct {
+	Amount     int64   `json:"amount"`
+	CategoryID *string `json:"category_id"`
+	Memo       *string `json:"memo"`
+}
+
+// fxFeeMemo is the memo of the FX fee part of a split.
+const fxFeeMemo = "FX fees"
+
 // TransformBunqToYNABPayload transforms a bunq transaction to a YNAB transaction payload.
 func domainToYnabTransaction(
 	t *entity.Transaction,
 	accountID string,
-) transaction.PayloadTransaction {
-	importID := importID(t)
+) payloadTransaction {
+	memo := t.Memo
 
-	const maxPayeeLenght = 6
-
-	var shortPayee string
-	if len(t.Payee) > maxPayeeLenght {
-		shortPayee = t.Payee[:maxPayeeLenght]
-	} else {
-		shortPayee = t.Payee
-	}
-
-	description := shortPayee + ": " + t.Description
-
-	return transaction.PayloadTransaction{
+	pt := transaction.PayloadTransaction{
 		ID:         "",
 		AccountID:  accountID,
 		Date:       api.Date{Time: t.Date},
-		Amount:     t.Amount.Mul(decimal.NewFromInt(1000)).IntPart(),
-		Memo:       &description,
+		Amount:     toMilliunits(t.Amount),
+		Memo:       &memo,
 		Cleared:    transaction.ClearingStatusUncleared,
 		Approved:   false,
 		PayeeID:    nil,
 		PayeeName:  &t.Payee,
 		CategoryID: nil,
 		FlagColor:  nil,
-		ImportID:   &importID,
+		ImportID:   nil,
+	}
+
+	if importID := t.ImportID(); importID != "" {
+		pt.ImportID = &importID
+	}
+
+	if t.Cleared {
+		pt.Cleared = transaction.ClearingStatusCleared
+	}
+
+	if t.CategoryID != "" {
+		pt.CategoryID = &t.CategoryID
+	}
+
+	if t.PayeeID != "" {
+		pt.PayeeID = &t.PayeeID
+		pt.PayeeName = nil
+	}
+
+	// YNAB creates the other side of a transfer itself when the transfer payee is used.
+	if t.TransferPayeeID != "" {
+		pt.PayeeID = &t.TransferPayeeID
+		pt.PayeeName = nil
+		return payloadTransaction{PayloadTransaction: pt}
+	}
+
+	// a pending authorisation isn't split, so the amount can still be updated when it settles
+	if t.Fee.IsZero() || t.Pending {
+		return payloadTransaction{PayloadTransaction: pt}
+	}
+
+	fee := toMilliunits(t.Fee.Abs().Neg())
+	feeMemo := fxFeeMemo
+	res := payloadTransaction{
+		PayloadTransaction: pt,
+		SubTransactions: []payloadSubTransaction{
+			{Amount: pt.Amount - fee, CategoryID: pt.CategoryID},
+			{Amount: fee, Memo: &feeMemo},
+		},
+	}
+	if t.FeeCategoryID != "" {
+		res.SubTransactions[1].CategoryID = &t.FeeCategoryID
+	}
+
+	// the category is set on the parts
+	res.CategoryID = nil
+
+	return res
+}
+
+// toMilliunits converts an amount to YNAB milliunits.
+func toMilliunits(amount decimal.Decimal) int64 {
+	return amount.Mul(decimal.NewFromInt(1000)).IntPart()
+}
+
+// GetImportedTransactions returns the transactions with an import ID in the account on or after since.
+func (c *Client) GetImportedTransactions(
+	ctx context.Context,
+	budgetID, accountID string,
+	since time.Time,
+) ([]*entity.ImportedTransaction, error) {
+	var ts []*transaction.Transaction
+	err := c.call(func() (err error) {
+		ts, err = c.yn.with(ctx).Transaction().GetTransactionsByAccount(budgetID, accountID, &transaction.Filter{
+			Since: &api.Date{Time: since},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "getting transactions by account")
+	}
+
+	var imported []*entity.ImportedTransaction
+	for _, t := range ts {
+		if t.ImportID == nil || t.Deleted {
+			continue
+		}
+
+		it := &entity.ImportedTransaction{
+			ID:         t.ID,
+			ImportID:   *t.ImportID,
+			Amount:     milliunitsToDecimal(t.Amount),
+			Cleared:    t.Cleared != transaction.ClearingStatusUncleared,
+			Reconciled: t.Cleared == transaction.ClearingStatusReconciled,
+			Transfer:   t.TransferAccountID != nil,
+			Split:      len(t.SubTransactions) > 0,
+		}
+		if t.Memo != nil {
+			it.Memo = *t.Memo
+		}
+		if t.CategoryID != nil {
+			it.CategoryID = *t.CategoryID
+		}
+
+		imported = append(imported, it)
 	}
+
+	return imported, nil
+}
+
+// patchTransaction only holds the fields that change, YNAB leaves the others alone.
+type patchTransaction struct {
+	ID         string                      `json:"id"`
+	Amount     *int64                      `json:"amount,omitempty"`
+	Memo       *string                     `json:"memo,omitempty"`
+	Cleared    *transaction.ClearingStatus `json:"cleared,omitempty"`
+	CategoryID *string                     `json:"category_id,omitempty"`
 }
 
-// importID generates an importID for a transaction.
-// This is used by YNAB to prevent duplicate imports.
-// If you want to import the same transaction multiple times, you can change the importIteration.
-func importID(t *entity.Transaction) string {
-	const importIteration = "1"
+// UpdateTransactions changes the given fields of transactions in the budget.
+func (c *Client) UpdateTransactions(ctx context.Context, budgetID string, updates []*entity.TransactionUpdate) error {
+	// the ynab.go service always sends every field, which would clear the ones that aren't
+	// updated, so this one is sent directly
+	var payload struct {
+		Transactions []patchTransaction `json:"transactions"`
+	}
+	for _, u := range updates {
+		pt := patchTransaction{ID: u.ID, Memo: u.Memo, CategoryID: u.CategoryID}
+		if u.Amount != nil {
+			amount := toMilliunits(*u.Amount)
+			pt.Amount = &amount
+		}
+		if u.Cleared != nil {
+			cleared := transaction.ClearingStatusUncleared
+			if *u.Cleared {
+				cleared = transaction.ClearingStatusCleared
+			}
+			pt.Cleared = &cleared
+		}
+		payload.Transactions = append(payload.Transactions, pt)
+	}
+
+	dat, err := json.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "marshalling updates")
+	}
+
+	err = c.call(func() error {
+		var res struct{}
+		return c.yn.do(ctx, http.MethodPatch, fmt.Sprintf("/budgets/%s/transactions", budgetID), &res, dat)
+	})
+	if err != nil {
+		return errors.Wrap(err, "updating transactions")
+	}
 
-	return "YNAB:" + t.Amount.String() + ":" + t.Date.Format("2006-01-02") + ":" + importIteration
+	return nil
 }
 
-func (c *Client) GetAccountByName(budgetID, name string) (*entity.Account, error) {
-	sm, err := c.yn.Account().GetAccounts(budgetID, nil)
+func (c *Client) GetAccountByName(ctx context.Context, budgetID, name string) (*entity.Account, error) {
+	accounts, err := c.accounts(ctx, budgetID)
 	if err != nil {
 		return nil, err
 	}
 
-	for i := range sm.Accounts {
-		if sm.Accounts[i].Name == name {
-			return accountToDomain(sm.Accounts[i]), nil
+	for i := range accounts {
+		if accounts[i].Name == name {
+			return accountToDomain(accounts[i]), nil
 		}
 	}
 
 	return nil, errors.New("account not found")
 }
 
+// accounts returns the accounts of the budget, only fetching what changed since the last snapshot.
+func (c *Client) accounts(ctx context.Context, budgetID string) ([]*account.Account, error) {
+	var f *api.Filter
+	if c.snapshots != nil {
+		if k := c.snapshots.accountsKnowledge(budgetID); k > 0 {
+			f = &api.Filter{LastKnowledgeOfServer: k}
+		}
+	}
+
+	var sm *account.SearchResultSnapshot
+	err := c.call(func() (err error) {
+		sm, err = c.yn.with(ctx).Account().GetAccounts(budgetID, f)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "getting accounts")
+	}
+
+	if c.snapshots == nil {
+		return sm.Accounts, nil
+	}
+
+	accounts, err := c.snapshots.mergeAccounts(budgetID, sm)
+	if err != nil {
+		return nil, errors.Wrap(err, "merging accounts")
+	}
+
+	return accounts, nil
+}
+
+// GetTransferPayeeID returns the ID of the payee used to transfer money to the given account.
+func (c *Client) GetTransferPayeeID(ctx context.Context, budgetID, accountID string) (string, error) {
+	var sm *payee.SearchResultSnapshot
+	err := c.call(func() (err error) {
+		sm, err = c.yn.with(ctx).Payee().GetPayees(budgetID, nil)
+		return err
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "getting payees")
+	}
+
+	for _, p := range sm.Payees {
+		if p.TransferAccountID != nil && *p.TransferAccountID == accountID && !p.Deleted {
+			return p.ID, nil
+		}
+	}
+
+	return "", errors.New("transfer payee not found")
+}
+
+// GetAccountBalance returns the cleared plus uncleared balance of the account.
+func (c *Client) GetAccountBalance(ctx context.Context, budgetID, accountID string) (decimal.Decimal, error) {
+	var acc *account.Account
+	err := c.call(func() (err error) {
+		acc, err = c.yn.with(ctx).Account().GetAccount(budgetID, accountID)
+		return err
+	})
+	if err != nil {
+		return decimal.Zero, errors.Wrap(err, "getting account")
+	}
+
+	return milliunitsToDecimal(acc.ClearedBalance + acc.UnclearedBalance), nil
+}
+
+// milliunitsToDecimal converts a YNAB milliunits amount to a decimal.
+func milliunitsToDecimal(amount int64) decimal.Decimal {
+	return decimal.NewFromInt(amount).Div(decimal.NewFromInt(1000))
+}
+
 func accountToDomain(account *account.Account) *entity.Account {
 	return &entity.Account{
 		BudgetID:    account.ID,
@@ -104,8 +377,12 @@ func accountToDomain(account *account.Account) *entity.Account {
 	}
 }
 
-func (c *Client) GetBudgetByName(name string) (*entity.Budget, error) {
-	sm, err := c.yn.Budget().GetBudgets()
+func (c *Client) GetBudgetByName(ctx context.Context, name string) (*entity.Budget, error) {
+	var sm []*budget.Summary
+	err := c.call(func() (err error) {
+		sm, err = c.yn.with(ctx).Budget().GetBudgets()
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -120,25 +397,55 @@ func (c *Client) GetBudgetByName(name string) (*entity.Budget, error) {
 }
 
 func (c *Client) GetAllCategories(
-	_ context.Context,
+	ctx context.Context,
 	budgetID string,
 ) ([]*entity.GroupWithCategories, error) {
-	sm, err := c.yn.Category().GetCategories(budgetID, nil)
+	groups, err := c.groups(ctx, budgetID)
 	if err != nil {
 		return nil, err
 	}
 
 	var categories []*entity.GroupWithCategories
-	for i := range sm.GroupWithCategories {
-		if sm.GroupWithCategories[i].Hidden || sm.GroupWithCategories[i].Deleted {
+	for i := range groups {
+		if groups[i].Hidden || groups[i].Deleted {
 			continue
 		}
-		categories = append(categories, groupCategoryToDomain(sm.GroupWithCategories[i]))
+		categories = append(categories, groupCategoryToDomain(groups[i]))
 	}
 
 	return categories, nil
 }
 
+// groups returns the category groups of the budget, only fetching what changed since the last snapshot.
+func (c *Client) groups(ctx context.Context, budgetID string) ([]*category.GroupWithCategories, error) {
+	var f *api.Filter
+	if c.snapshots != nil {
+		if k := c.snapshots.categoriesKnowledge(budgetID); k > 0 {
+			f = &api.Filter{LastKnowledgeOfServer: k}
+		}
+	}
+
+	var sm *category.SearchResultSnapshot
+	err := c.call(func() (err error) {
+		sm, err = c.yn.with(ctx).Category().GetCategories(budgetID, f)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "getting categories")
+	}
+
+	if c.snapshots == nil {
+		return sm.GroupWithCategories, nil
+	}
+
+	groups, err := c.snapshots.mergeCategories(budgetID, sm)
+	if err != nil {
+		return nil, errors.Wrap(err, "merging categories")
+	}
+
+	return groups, nil
+}
+
 func groupCategoryToDomain(i *category.GroupWithCategories) *entity.GroupWithCategories {
 	return &entity.GroupWithCategories{
 		ID:         i.ID,
@@ -164,9 +471,9 @@ func categoryToDomain(c *category.Category) *entity.Category {
 	cc := &entity.Category{
 		ID:       c.ID,
 		Name:     c.Name,
-		Budgeted: decimal.NewFromInt(c.Budgeted).Div(decimal.NewFromInt(1000)),
-		Activity: decimal.NewFromInt(c.Activity).Div(decimal.NewFromInt(1000)),
-		Balance:  decimal.NewFromInt(c.Balance).Div(decimal.NewFromInt(1000)),
+		Budgeted: milliunitsToDecimal(c.Budgeted),
+		Activity: milliunitsToDecimal(c.Activity),
+		Balance:  milliunitsToDecimal(c.Balance),
 		GoalType: goalToDomain(c.GoalType),
 	}
 
@@ -175,7 +482,7 @@ func categoryToDomain(c *category.Category) *entity.Category {
 	}
 
 	if c.GoalTarget != nil {
-		goal := decimal.NewFromInt(*c.GoalTarget).Div(decimal.NewFromInt(1000))
+		goal := milliunitsToDecimal(*c.GoalTarget)
 		cc.GoalTarget = &goal
 	}
 
@@ -203,8 +510,15 @@ func goalToDomain(goalType *category.Goal) *entity.Goal {
 }
 
 func budgetToDomain(b *budget.Summary) *entity.Budget {
-	return &entity.Budget{
+	res := &entity.Budget{
 		ID:   b.ID,
 		Name: b.Name,
 	}
+
+	if b.CurrencyFormat != nil {
+		res.Currency = b.CurrencyFormat.ISOCode
+		res.Decimals = int32(b.CurrencyFormat.DecimalDigits)
+	}
+
+	return res
 }
@@ -0,0 +1,118 @@
+package ynab
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/bad33ndj3/bunq2ynab/internal/fake/fakeynab"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+func TestPushSplitsFXFee(t *testing.T) {
+	ctx := context.Background()
+
+	fake := fakeynab.New()
+	defer fake.Close()
+
+	budgetID := fake.AddBudget("Budget")
+	accountID := fake.AddAccount(budgetID, "Checking")
+	groceries := fake.AddCategory(budgetID, "Food", "Groceries")
+	fees := fake.AddCategory(budgetID, "Bank", "FX fees")
+
+	c := newFakeClient(t, fake, t.TempDir())
+	err := c.PushTransactions(ctx, budgetID, accountID, []*entity.Transaction{{
+		BankID:        1,
+		Payee:         "Whole Foods",
+		Amount:        decimal.RequireFromString("-11.04"),
+		Date:          time.Now(),
+		CategoryID:    groceries,
+		Fee:           decimal.RequireFromString("0.06"),
+		FeeCategoryID: fees,
+	}})
+	if err != nil {
+		t.Fatalf("PushTransactions() error = %v", err)
+	}
+
+	ts := fake.Transactions(budgetID, accountID)
+	if len(ts) != 1 || ts[0].Amount != -11040 || ts[0].CategoryID != nil || len(ts[0].SubTransactions) != 2 {
+		t.Fatalf("Expected a split of -11.04 without a category of its own, got %+v", ts)
+	}
+
+	purchase, fee := ts[0].SubTransactions[0], ts[0].SubTransactions[1]
+	if purchase.Amount != -10980 || *purchase.CategoryID != groceries {
+		t.Errorf("Expected the purchase of -10.98 in groceries, got %+v", purchase)
+	}
+
+	if fee.Amount != -60 || *fee.CategoryID != fees || *fee.Memo != fxFeeMemo {
+		t.Errorf("Expected the fee of -0.06 in FX fees, got %+v", fee)
+	}
+}
+
+func TestRateLimitedRequestBlocksTracker(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "600")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"error":{"id":"429","name":"too_many_requests","detail":"Too many requests"}}`))
+	}))
+	defer srv.Close()
+
+	tracker, err := NewTracker(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewTracker() error = %v", err)
+	}
+
+	c := NewClient(srv.URL, "token", tracker, nil)
+	_, err = c.GetBudgetByName(ctx, "Budget")
+
+	e, ok := errors.Cause(err).(*Error)
+	if !ok || e.StatusCode() != http.StatusTooManyRequests || e.RetryAfter() != 10*time.Minute {
+		t.Fatalf("Expected a 429 *Error asking to wait 10 minutes, got %v", err)
+	}
+
+	if q := tracker.Quota(); q.Remaining() != 0 || q.ResetAt.Before(time.Now().Add(9*time.Minute)) {
+		t.Errorf("Expected the quota to be used up for 10 minutes, got %+v", q)
+	}
+}
+
+func TestRequestsTimeOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := NewClient(srv.URL, "token", nil, nil)
+	c.yn.http.Timeout = 50 * time.Millisecond
+
+	_, err := c.GetBudgetByName(context.Background(), "Budget")
+	if err == nil {
+		t.Error("Expected a hung request to time out, got no error")
+	}
+}
+
+func TestRequestsAreCancelledWithTheirContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := NewClient(srv.URL, "token", nil, nil)
+	_, err := c.GetBudgetByName(ctx, "Budget")
+	if !stderrors.Is(errors.Cause(err), context.DeadlineExceeded) {
+		t.Errorf("Expected the request to end with its context, got %v", err)
+	}
+}
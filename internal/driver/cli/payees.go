@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// SuggestPayees prints proposed payee aliases as a config snippet.
+func (c *Client) SuggestPayees(ctx context.Context, from time.Time) error {
+	err := c.sv.LoadPayees()
+	if err != nil {
+		return errors.Wrap(err, "loading payees")
+	}
+
+	suggestions, err := c.sv.SuggestPayees(ctx, from)
+	if err != nil {
+		return errors.Wrap(err, "suggesting payees")
+	}
+
+	if len(suggestions) == 0 {
+		_, err = fmt.Fprintln(c.out, "# no payee aliases to suggest")
+		return err
+	}
+
+	dat, err := yaml.Marshal(struct {
+		Payees []entity.ConfigPayee `yaml:"payees"`
+	}{suggestions})
+	if err != nil {
+		return errors.Wrap(err, "marshalling suggestions")
+	}
+
+	_, err = c.out.Write(dat)
+	if err != nil {
+		return errors.Wrap(err, "printing suggestions")
+	}
+
+	return nil
+}
@@ -0,0 +1,275 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/bad33ndj3/bunq2ynab/internal/core/service/sync"
+	"github.com/pkg/errors"
+)
+
+// Format is the output format of a command.
+type Format string
+
+const (
+	// FormatTable prints a human readable table.
+	FormatTable Format = "table"
+	// FormatJSON prints JSON.
+	FormatJSON Format = "json"
+)
+
+// FormatFromString returns the Format for the given string.
+func FormatFromString(src string) (Format, error) {
+	switch src {
+	case string(FormatTable):
+		return FormatTable, nil
+	case string(FormatJSON):
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unknown output format '%s'", src)
+	}
+}
+
+// Plan actions, as printed per transaction.
+const (
+	actionCreate = "create"
+	actionUpdate = "update"
+	// actionDelete is a reversed card authorisation removed from YNAB.
+	actionDelete   = "delete"
+	actionExisting = "existing"
+	actionFiltered = "filtered"
+	// actionCounterpart is an incoming transfer YNAB creates from the outgoing side.
+	actionCounterpart = "counterpart"
+)
+
+type planJSON struct {
+	BunqAccountName string            `json:"bunq_account_name"`
+	YnabBudgetName  string            `json:"ynab_budget_name"`
+	YnabAccountName string            `json:"ynab_account_name"`
+	Create          []transactionJSON `json:"create"`
+	Update          []updateJSON      `json:"update"`
+	Delete          []transactionJSON `json:"delete"`
+	Existing        []transactionJSON `json:"existing"`
+	Filtered        []transactionJSON `json:"filtered"`
+	Counterparts    []transactionJSON `json:"counterparts"`
+	Interest        []interestJSON    `json:"interest,omitempty"`
+	Stage           string            `json:"failed_stage,omitempty"`
+	Error           string            `json:"error,omitempty"`
+}
+
+type updateJSON struct {
+	transactionJSON
+	// Fields lists the fields that change in YNAB.
+	Fields []string `json:"fields"`
+}
+
+// interestJSON is the interest received in a month.
+type interestJSON struct {
+	Month  string `json:"month"`
+	Amount string `json:"amount"`
+}
+
+type transactionJSON struct {
+	BankID      int    `json:"bank_id"`
+	ImportID    string `json:"import_id"`
+	Date        string `json:"date"`
+	Amount      string `json:"amount"`
+	Payee       string `json:"payee"`
+	Type        string `json:"type,omitempty"`
+	SubType     string `json:"sub_type,omitempty"`
+	Description string `json:"description"`
+	Category    string `json:"category,omitempty"`
+	Memo        string `json:"memo"`
+	// Pending marks a card authorisation that isn't settled yet.
+	Pending bool `json:"pending,omitempty"`
+}
+
+func printPlans(w io.Writer, plans []*sync.Plan, format Format) error {
+	switch format {
+	case FormatJSON:
+		return printPlansJSON(w, plans)
+	default:
+		return printPlansTable(w, plans)
+	}
+}
+
+func printPlansJSON(w io.Writer, plans []*sync.Plan) error {
+	res := make([]planJSON, 0, len(plans))
+	for _, p := range plans {
+		pj := planJSON{
+			BunqAccountName: p.Account.BunqAccountName,
+			YnabBudgetName:  p.Account.YnabBudgetName,
+			YnabAccountName: p.Account.YnabAccountName,
+			Create:          transactionsToJSON(p.Create),
+			Update:          updatesToJSON(p.Update),
+			Delete:          transactionsToJSON(deletedTransactions(p.Delete)),
+			Existing:        transactionsToJSON(p.Existing),
+			Filtered:        transactionsToJSON(p.Filtered),
+			Counterparts:    transactionsToJSON(p.Counterparts),
+		}
+		for _, mi := range p.Interest {
+			pj.Interest = append(pj.Interest, interestJSON{Month: mi.Month.Format("2006-01"), Amount: mi.Amount.StringFixed(2)})
+		}
+		if p.Err != nil {
+			pj.Stage = string(p.Err.Stage)
+			pj.Error = p.Err.Err.Error()
+		}
+		res = append(res, pj)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	err := enc.Encode(res)
+	if err != nil {
+		return errors.Wrap(err, "encoding plans")
+	}
+
+	return nil
+}
+
+func transactionsToJSON(transactions []*entity.Transaction) []transactionJSON {
+	res := make([]transactionJSON, 0, len(transactions))
+	for _, t := range transactions {
+		res = append(res, transactionJSON{
+			BankID:      t.BankID,
+			ImportID:    t.ImportID(),
+			Date:        t.Date.Format("2006-01-02"),
+			Amount:      t.Amount.StringFixed(2),
+			Payee:       t.Payee,
+			Type:        t.Type.String(),
+			SubType:     t.SubType.String(),
+			Description: t.Description,
+			Category:    t.Category,
+			Memo:        t.Memo,
+			Pending:     t.Pending,
+		})
+	}
+
+	return res
+}
+
+func updatesToJSON(updates []*entity.TransactionUpdate) []updateJSON {
+	res := make([]updateJSON, 0, len(updates))
+	for _, u := range updates {
+		res = append(res, updateJSON{
+			transactionJSON: transactionsToJSON([]*entity.Transaction{u.Transaction})[0],
+			Fields:          updatedFields(u),
+		})
+	}
+
+	return res
+}
+
+// deletedTransactions returns the bank transactions the deletes come from.
+func deletedTransactions(deletes []*entity.TransactionDelete) []*entity.Transaction {
+	res := make([]*entity.Transaction, 0, len(deletes))
+	for _, d := range deletes {
+		res = append(res, d.Transaction)
+	}
+
+	return res
+}
+
+// updatedFields returns the names of the fields the update changes.
+func updatedFields(u *entity.TransactionUpdate) []string {
+	var fields []string
+	if u.Amount != nil {
+		fields = append(fields, "amount")
+	}
+	if u.Memo != nil {
+		fields = append(fields, "memo")
+	}
+	if u.Cleared != nil {
+		fields = append(fields, "cleared")
+	}
+	if u.CategoryID != nil {
+		fields = append(fields, "category")
+	}
+
+	return fields
+}
+
+func printPlansTable(w io.Writer, plans []*sync.Plan) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, p := range plans {
+		fmt.Fprintf(tw, "%s -> %s / %s\n", p.Account.BunqAccountName, p.Account.YnabBudgetName, p.Account.YnabAccountName)
+		if p.Err != nil {
+			fmt.Fprintf(tw, "failed at %s: %v\n\n", p.Err.Stage, p.Err.Err)
+			continue
+		}
+		fmt.Fprintf(tw, "ACTION\tDATE\tAMOUNT\tPAYEE\tCATEGORY\tDESCRIPTION\n")
+		printTransactionRows(tw, actionCreate, p.Create)
+		for _, u := range p.Update {
+			printTransactionRows(tw, actionUpdate+" "+strings.Join(updatedFields(u), ","), []*entity.Transaction{u.Transaction})
+		}
+		printTransactionRows(tw, actionDelete, deletedTransactions(p.Delete))
+		printTransactionRows(tw, actionExisting, p.Existing)
+		printTransactionRows(tw, actionFiltered, p.Filtered)
+		printTransactionRows(tw, actionCounterpart, p.Counterparts)
+		fmt.Fprintf(tw, "%d to create, %d to update, %d to delete, %d existing, %d filtered, %d transfer counterparts\n",
+			len(p.Create), len(p.Update), len(p.Delete), len(p.Existing), len(p.Filtered), len(p.Counterparts))
+		for _, mi := range p.Interest {
+			fmt.Fprintf(tw, "interest in %s: %s\n", mi.Month.Format("2006-01"), mi.Amount.StringFixed(2))
+		}
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
+
+func printTransactionRows(w io.Writer, action string, transactions []*entity.Transaction) {
+	for _, t := range transactions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			action, t.Date.Format("2006-01-02"), t.Amount.StringFixed(2), t.Payee, t.Category, t.Description)
+	}
+}
+
+// printSummary prints the outcome of a sync per account.
+func printSummary(w io.Writer, plans []*sync.Plan) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "BUNQ ACCOUNT\tYNAB ACCOUNT\tSTATUS\tCREATED\tUPDATED\tDELETED\tSTAGE\tERROR\n")
+	for _, p := range plans {
+		status, created, updated, deleted, stage, msg := "ok", len(p.Create), len(p.Update), len(p.Delete), "", ""
+		if p.Err != nil {
+			status, created, updated, deleted, stage, msg = "failed", 0, 0, 0, string(p.Err.Stage), p.Err.Err.Error()
+		}
+
+		fmt.Fprintf(tw, "%s\t%s / %s\t%s\t%d\t%d\t%d\t%s\t%s\n",
+			p.Account.BunqAccountName, p.Account.YnabBudgetName, p.Account.YnabAccountName,
+			status, created, updated, deleted, stage, msg)
+	}
+
+	err := tw.Flush()
+	if err != nil {
+		return errors.Wrap(err, "printing summary")
+	}
+
+	return printInterest(w, plans)
+}
+
+// printInterest prints the interest per month of every account that synced any.
+func printInterest(w io.Writer, plans []*sync.Plan) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := false
+	for _, p := range plans {
+		if p.Err != nil {
+			continue
+		}
+
+		for _, mi := range p.Interest {
+			if !header {
+				fmt.Fprintf(tw, "\nBUNQ ACCOUNT\tMONTH\tINTEREST\n")
+				header = true
+			}
+
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", p.Account.BunqAccountName, mi.Month.Format("2006-01"), mi.Amount.StringFixed(2))
+		}
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+type reconciliationJSON struct {
+	BunqAccountName string `json:"bunq_account_name"`
+	YnabBudgetName  string `json:"ynab_budget_name"`
+	YnabAccountName string `json:"ynab_account_name"`
+	BankBalance     string `json:"bank_balance"`
+	// OriginalBankBalance is the bunq balance in the account currency, for accounts in another currency than the budget.
+	OriginalBankBalance string `json:"original_bank_balance,omitempty"`
+	BudgetBalance       string `json:"budget_balance"`
+	Difference          string `json:"difference"`
+	Adjusted            bool   `json:"adjusted"`
+}
+
+// Reconcile prints the balance differences between bunq and YNAB,
+// creating adjustment transactions when adjust is set.
+func (c *Client) Reconcile(ctx context.Context, adjust bool, format Format) error {
+	res, err := c.sv.Reconcile(ctx, adjust)
+	if err != nil {
+		return errors.Wrap(err, "reconciling")
+	}
+
+	if format == FormatJSON {
+		out := make([]reconciliationJSON, 0, len(res))
+		for _, r := range res {
+			rj := reconciliationJSON{
+				BunqAccountName: r.Account.BunqAccountName,
+				YnabBudgetName:  r.Account.YnabBudgetName,
+				YnabAccountName: r.Account.YnabAccountName,
+				BankBalance:     r.BankBalance.StringFixed(2),
+				BudgetBalance:   r.BudgetBalance.StringFixed(2),
+				Difference:      r.Difference.StringFixed(2),
+				Adjusted:        r.Adjusted,
+			}
+			if r.OriginalCurrency != "" {
+				rj.OriginalBankBalance = r.OriginalBankBalance.StringFixed(2) + " " + r.OriginalCurrency
+			}
+			out = append(out, rj)
+		}
+
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(out)
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "BUNQ ACCOUNT\tYNAB ACCOUNT\tBUNQ\tYNAB\tDIFFERENCE\tADJUSTED\n")
+	for _, r := range res {
+		fmt.Fprintf(tw, "%s\t%s / %s\t%s\t%s\t%s\t%t\n",
+			r.Account.BunqAccountName, r.Account.YnabBudgetName, r.Account.YnabAccountName,
+			r.BankBalance.StringFixed(2), r.BudgetBalance.StringFixed(2), r.Difference.StringFixed(2), r.Adjusted)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	gosync "sync"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/bad33ndj3/bunq2ynab/internal/core/service/sync"
+	"github.com/bad33ndj3/bunq2ynab/internal/driver/scheduler"
+	"github.com/bad33ndj3/bunq2ynab/internal/driver/webhook"
+	"github.com/pkg/errors"
+)
+
+// serialized runs scheduled syncs and callbacks one at a time, since they share the
+// cursors, stores and caches of the service and could otherwise push the same payment twice.
+type serialized struct {
+	mu gosync.Mutex
+	sv *sync.Client
+}
+
+func (s *serialized) Sync(ctx context.Context, opts sync.Options) ([]*sync.Plan, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sv.Sync(ctx, opts)
+}
+
+func (s *serialized) HandleNotification(ctx context.Context, body []byte, signature string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sv.HandleNotification(ctx, body, signature)
+}
+
+// Serve keeps syncing on the configured schedule until ctx is done.
+// When cb has a listen address, bunq callbacks are served alongside the schedule,
+// which then catches up on any callback that was missed. Syncs and callbacks never overlap.
+func (c *Client) Serve(ctx context.Context, cfg entity.ConfigServe, cb entity.ConfigCallback) error {
+	err := c.load(ctx)
+	if err != nil {
+		return errors.Wrap(err, "loading config")
+	}
+
+	sv := &serialized{sv: c.sv}
+	s, err := scheduler.New(sv, cfg)
+	if err != nil {
+		return errors.Wrap(err, "creating scheduler")
+	}
+
+	if cb.Listen == "" {
+		err = s.Run(ctx)
+		if err != nil {
+			return errors.Wrap(err, "running scheduler")
+		}
+
+		return nil
+	}
+
+	// a card callback syncs its account over the same window as the schedule
+	c.sv.SetCallbackDays(cfg.Days)
+
+	ws, err := webhook.New(sv, cb)
+	if err != nil {
+		return errors.Wrap(err, "creating callback server")
+	}
+
+	if cb.URL != "" {
+		err = c.sv.RegisterCallbacks(ctx, webhook.CallbackURL(cb.URL, cb.Secret))
+		if err != nil {
+			return errors.Wrap(err, "registering callbacks")
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- errors.Wrap(s.Run(ctx), "running scheduler")
+	}()
+	go func() {
+		errs <- errors.Wrap(ws.Run(ctx), "running callback server")
+	}()
+
+	// stop the other one as soon as either returns
+	err = <-errs
+	cancel()
+	if err2 := <-errs; err == nil {
+		err = err2
+	}
+
+	return err
+}
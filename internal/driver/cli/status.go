@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type statusJSON struct {
+	Quota    *quotaJSON          `json:"ynab_quota,omitempty"`
+	Accounts []accountStatusJSON `json:"accounts"`
+}
+
+type quotaJSON struct {
+	Used      int    `json:"used"`
+	Limit     int    `json:"limit"`
+	Remaining int    `json:"remaining"`
+	ResetAt   string `json:"reset_at,omitempty"`
+}
+
+type accountStatusJSON struct {
+	BunqAccountName string `json:"bunq_account_name"`
+	YnabBudgetName  string `json:"ynab_budget_name"`
+	YnabAccountName string `json:"ynab_account_name"`
+	Cursor          int    `json:"cursor"`
+}
+
+// Status prints the YNAB request quota and the cursor of every configured account.
+func (c *Client) Status(ctx context.Context, format Format) error {
+	st, err := c.sv.Status(ctx)
+	if err != nil {
+		return errors.Wrap(err, "getting status")
+	}
+
+	if format == FormatJSON {
+		out := statusJSON{Accounts: make([]accountStatusJSON, 0, len(st.Accounts))}
+		if q := st.Quota; q != nil {
+			out.Quota = &quotaJSON{Used: q.Used, Limit: q.Limit, Remaining: q.Remaining()}
+			if !q.ResetAt.IsZero() {
+				out.Quota.ResetAt = q.ResetAt.Format(time.RFC3339)
+			}
+		}
+
+		for _, a := range st.Accounts {
+			out.Accounts = append(out.Accounts, accountStatusJSON{
+				BunqAccountName: a.Account.BunqAccountName,
+				YnabBudgetName:  a.Account.YnabBudgetName,
+				YnabAccountName: a.Account.YnabAccountName,
+				Cursor:          a.Cursor,
+			})
+		}
+
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(out)
+	}
+
+	if q := st.Quota; q != nil {
+		fmt.Fprintf(c.out, "YNAB requests: %d of %d used, %d remaining", q.Used, q.Limit, q.Remaining())
+		if !q.ResetAt.IsZero() {
+			fmt.Fprintf(c.out, ", next one frees up at %s", q.ResetAt.Format(time.TimeOnly))
+		}
+		fmt.Fprintf(c.out, "\n\n")
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "BUNQ ACCOUNT\tYNAB ACCOUNT\tCURSOR\n")
+	for _, a := range st.Accounts {
+		fmt.Fprintf(tw, "%s\t%s / %s\t%d\n",
+			a.Account.BunqAccountName, a.Account.YnabBudgetName, a.Account.YnabAccountName, a.Cursor)
+	}
+
+	return tw.Flush()
+}
@@ -2,7 +2,8 @@ package cli
 
 import (
 	"context"
-	"time"
+	"io"
+	"os"
 
 	"github.com/bad33ndj3/bunq2ynab/internal/core/service/sync"
 	"github.com/pkg/errors"
@@ -10,18 +11,31 @@ import (
 )
 
 type Client struct {
-	sv *sync.Client
+	sv  *sync.Client
+	out io.Writer
 }
 
 func NewClient(sv *sync.Client) *Client {
 	return &Client{
-		sv: sv,
+		sv:  sv,
+		out: os.Stdout,
 	}
 }
 
 // Sync syncs all transactions from bunq to YNAB.
-func (c *Client) Sync(ctx context.Context, from time.Time) error {
-	err := c.sv.Sync(ctx, from)
+func (c *Client) Sync(ctx context.Context, opts sync.Options) error {
+	err := c.load(ctx)
+	if err != nil {
+		return errors.Wrap(err, "loading config")
+	}
+
+	plans, err := c.sv.Sync(ctx, opts)
+	if len(plans) > 0 {
+		perr := printSummary(c.out, plans)
+		if perr != nil && err == nil {
+			err = perr
+		}
+	}
 	if err != nil {
 		return errors.Wrap(err, "syncing")
 	}
@@ -29,6 +43,68 @@ func (c *Client) Sync(ctx context.Context, from time.Time) error {
 	return nil
 }
 
+// Plan prints what a sync would do without pushing anything to YNAB.
+func (c *Client) Plan(ctx context.Context, opts sync.Options, format Format) error {
+	err := c.load(ctx)
+	if err != nil {
+		return errors.Wrap(err, "loading config")
+	}
+
+	opts.DryRun = true
+	plans, err := c.sv.Sync(ctx, opts)
+	if _, ok := err.(*sync.SyncError); err != nil && !ok {
+		return errors.Wrap(err, "planning sync")
+	}
+
+	// failed accounts are part of the plans, print those before returning the failure
+	perr := printPlans(c.out, plans, format)
+	if perr != nil {
+		return errors.Wrap(perr, "printing plans")
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "planning sync")
+	}
+
+	return nil
+}
+
+// load validates the payee aliases, filters, categorisation rules, FX fee and income categories
+// and memo templates, so a sync fails before touching YNAB.
+func (c *Client) load(ctx context.Context) error {
+	err := c.sv.LoadPayees()
+	if err != nil {
+		return errors.Wrap(err, "loading payees")
+	}
+
+	err = c.sv.LoadFilters()
+	if err != nil {
+		return errors.Wrap(err, "loading filters")
+	}
+
+	err = c.sv.LoadRules(ctx)
+	if err != nil {
+		return errors.Wrap(err, "loading rules")
+	}
+
+	err = c.sv.LoadFX(ctx)
+	if err != nil {
+		return errors.Wrap(err, "loading FX fee category")
+	}
+
+	err = c.sv.LoadIncome(ctx)
+	if err != nil {
+		return errors.Wrap(err, "loading income category")
+	}
+
+	err = c.sv.LoadMemoTemplates()
+	if err != nil {
+		return errors.Wrap(err, "loading memo templates")
+	}
+
+	return nil
+}
+
 func (c *Client) GetAllCategories(
 	ctx context.Context,
 	budgetName string,
@@ -0,0 +1,114 @@
+// Package scheduler runs the sync on a schedule.
+package scheduler
+
+import (
+	"context"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/bad33ndj3/bunq2ynab/internal/core/service/sync"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	defaultInterval = time.Hour
+	defaultDays     = 30
+)
+
+// Schedule returns the next time to run after the given time.
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
+// interval schedules runs a fixed duration apart.
+type interval time.Duration
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// Scheduler runs the sync on a schedule, one run at a time.
+type Scheduler struct {
+	sv       sync.Service
+	schedule Schedule
+	jitter   time.Duration
+	days     int
+}
+
+// New creates a Scheduler from the serve config.
+func New(sv sync.Service, cfg entity.ConfigServe) (*Scheduler, error) {
+	var schedule Schedule = interval(defaultInterval)
+	switch {
+	case cfg.Cron != "":
+		cs, err := cron.ParseStandard(cfg.Cron)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing cron expression")
+		}
+		schedule = cs
+	case cfg.Interval < 0:
+		return nil, errors.New("interval must be positive")
+	case cfg.Interval > 0:
+		schedule = interval(cfg.Interval)
+	}
+
+	days := cfg.Days
+	if days <= 0 {
+		days = defaultDays
+	}
+
+	return &Scheduler{
+		sv:       sv,
+		schedule: schedule,
+		jitter:   cfg.Jitter,
+		days:     days,
+	}, nil
+}
+
+// Run syncs right away and then on every scheduled time until ctx is done.
+// The next run is planned once the previous one finished, so runs never overlap.
+// Failed runs are logged and retried on the next scheduled time.
+func (s *Scheduler) Run(ctx context.Context) error {
+	for {
+		s.runOnce(ctx)
+
+		next := s.next(time.Now())
+		slog.Info("Next sync scheduled", slog.Time("at", next))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			slog.Info("Scheduler stopped")
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	start := time.Now()
+	_, err := s.sv.Sync(ctx, sync.Options{From: start.AddDate(0, 0, -s.days)})
+	if err != nil {
+		slog.Error("Sync failed", slog.String("error", err.Error()), slog.Duration("took", time.Since(start)))
+		return
+	}
+
+	slog.Info("Sync finished", slog.Duration("took", time.Since(start)))
+}
+
+// next returns the next run time after t, including jitter.
+func (s *Scheduler) next(t time.Time) time.Time {
+	next := s.schedule.Next(t)
+	if s.jitter > 0 {
+		next = next.Add(time.Duration(rand.Int63n(int64(s.jitter))))
+	}
+
+	return next
+}
@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"context"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/bad33ndj3/bunq2ynab/internal/core/service/sync"
+)
+
+func TestRunDoesNotOverlapAndStops(t *testing.T) {
+	sv := &MockService{Delay: 20 * time.Millisecond}
+	s, err := New(sv, entity.ConfigServe{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err = s.Run(ctx)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if sv.Runs < 2 {
+		t.Errorf("Expected at least 2 runs, got %d", sv.Runs)
+	}
+
+	if sv.MaxRunning != 1 {
+		t.Errorf("Expected runs not to overlap, got %d concurrent runs", sv.MaxRunning)
+	}
+}
+
+func TestNewInvalidCron(t *testing.T) {
+	_, err := New(&MockService{}, entity.ConfigServe{Cron: "not a cron"})
+	if err == nil {
+		t.Error("Expected error for invalid cron expression, got none")
+	}
+}
+
+func TestNextAddsJitter(t *testing.T) {
+	s, err := New(&MockService{}, entity.ConfigServe{Interval: time.Minute, Jitter: time.Second})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		next := s.next(now)
+		if next.Before(now.Add(time.Minute)) || !next.Before(now.Add(time.Minute+time.Second)) {
+			t.Fatalf("Expected next run within the jitter window, got %v", next.Sub(now))
+		}
+	}
+}
+
+// MockService is a mock implementation of the sync.Service interface
+type MockService struct {
+	mu         gosync.Mutex
+	Delay      time.Duration
+	Runs       int
+	running    int
+	MaxRunning int
+}
+
+func (m *MockService) Sync(_ context.Context, _ sync.Options) ([]*sync.Plan, error) {
+	m.mu.Lock()
+	m.Runs++
+	m.running++
+	if m.running > m.MaxRunning {
+		m.MaxRunning = m.running
+	}
+	m.mu.Unlock()
+
+	time.Sleep(m.Delay)
+
+	m.mu.Lock()
+	m.running--
+	m.mu.Unlock()
+
+	return nil, nil
+}
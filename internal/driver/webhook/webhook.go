@@ -0,0 +1,166 @@
+// Package webhook receives bunq notification callbacks.
+package webhook
+
+import (
+	"context"
+	"crypto/subtle"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+)
+
+const (
+	// PathPrefix is the path bunq calls, followed by the configured secret.
+	PathPrefix = "/callback/"
+
+	maxBodySize     = 1 << 20
+	shutdownTimeout = 5 * time.Second
+)
+
+// SignatureHeader holds bunq's signature of the callback body.
+const SignatureHeader = "X-Bunq-Server-Signature"
+
+// Handler handles the body of a bunq callback, it verifies the signature.
+type Handler interface {
+	HandleNotification(ctx context.Context, body []byte, signature string) error
+}
+
+// Server accepts bunq callbacks and passes them to the Handler.
+// Callbacks are handled concurrently, the Handler serialises them with whatever else uses its state.
+type Server struct {
+	h       Handler
+	listen  string
+	secret  string
+	allowed []*net.IPNet
+}
+
+// New creates a Server from the callback config.
+func New(h Handler, cfg entity.ConfigCallback) (*Server, error) {
+	if cfg.Listen == "" {
+		return nil, errors.New("listen address is required")
+	}
+
+	if cfg.Secret == "" {
+		return nil, errors.New("secret is required")
+	}
+
+	var allowed []*net.IPNet
+	for _, cidr := range cfg.AllowedNetworks {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing allowed network '%s'", cidr)
+		}
+		allowed = append(allowed, network)
+	}
+
+	return &Server{
+		h:       h,
+		listen:  cfg.Listen,
+		secret:  cfg.Secret,
+		allowed: allowed,
+	}, nil
+}
+
+// CallbackURL returns the URL to register at bunq for the given public base URL.
+func CallbackURL(base string, secret string) string {
+	return strings.TrimSuffix(base, "/") + PathPrefix + secret
+}
+
+// Handler returns the http.Handler serving the callbacks.
+// Failed callbacks get a 500, so bunq retries them later.
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		secret := strings.TrimPrefix(r.URL.Path, PathPrefix)
+		if !strings.HasPrefix(r.URL.Path, PathPrefix) || subtle.ConstantTimeCompare([]byte(secret), []byte(s.secret)) != 1 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if !s.isAllowed(r.RemoteAddr) {
+			slog.Warn("Rejected callback", slog.String("remote", r.RemoteAddr))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		err = s.h.HandleNotification(r.Context(), body, r.Header.Get(SignatureHeader))
+		if err != nil {
+			slog.Error("Handling callback failed", slog.String("error", err.Error()))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func (s *Server) isAllowed(remoteAddr string) bool {
+	if len(s.allowed) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range s.allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Run serves callbacks until ctx is done, then shuts down gracefully.
+func (s *Server) Run(ctx context.Context) error {
+	srv := &http.Server{
+		Addr:              s.listen,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		slog.Info("Listening for callbacks", slog.String("address", s.listen))
+		errs <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return errors.Wrap(err, "serving callbacks")
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	err := srv.Shutdown(shutdownCtx)
+	if err != nil {
+		return errors.Wrap(err, "shutting down callback server")
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bad33ndj3/bunq2ynab/internal/core/entity"
+	"github.com/pkg/errors"
+)
+
+const paymentCallback = `{"NotificationUrl":{"category":"PAYMENT","event_type":"PAYMENT_CREATED",` +
+	`"object":{"Payment":{"id":3,"monetary_account_id":1,"amount":{"value":"-4.20","currency":"EUR"}}}}}`
+
+func TestHandlerPassesCallback(t *testing.T) {
+	h := &MockHandler{}
+	srv := newTestServer(t, h, entity.ConfigCallback{Listen: ":0", Secret: "s3cret"})
+
+	res := post(t, srv.URL+"/callback/s3cret", paymentCallback)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", res.StatusCode)
+	}
+
+	if len(h.Bodies) != 1 || h.Bodies[0] != paymentCallback {
+		t.Errorf("Expected the callback body to be handled, got %v", h.Bodies)
+	}
+
+	if len(h.Signatures) != 1 || h.Signatures[0] != "signature" {
+		t.Errorf("Expected the signature to be passed on, got %v", h.Signatures)
+	}
+}
+
+func TestNewRequiresSecret(t *testing.T) {
+	_, err := New(&MockHandler{}, entity.ConfigCallback{Listen: ":0"})
+	if err == nil {
+		t.Error("Expected an error without secret, got none")
+	}
+}
+
+func TestHandlerRejectsWrongSecret(t *testing.T) {
+	h := &MockHandler{}
+	srv := newTestServer(t, h, entity.ConfigCallback{Listen: ":0", Secret: "s3cret"})
+
+	res := post(t, srv.URL+"/callback/guess", paymentCallback)
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", res.StatusCode)
+	}
+
+	if len(h.Bodies) != 0 {
+		t.Errorf("Expected nothing to be handled, got %d", len(h.Bodies))
+	}
+}
+
+func TestHandlerRejectsOtherNetworks(t *testing.T) {
+	h := &MockHandler{}
+	srv := newTestServer(t, h, entity.ConfigCallback{
+		Listen:          ":0",
+		Secret:          "s3cret",
+		AllowedNetworks: []string{"185.40.108.0/22"},
+	})
+
+	res := post(t, srv.URL+"/callback/s3cret", paymentCallback)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403, got %d", res.StatusCode)
+	}
+}
+
+func TestHandlerFailureAsksForRetry(t *testing.T) {
+	h := &MockHandler{Err: errors.New("ynab down")}
+	srv := newTestServer(t, h, entity.ConfigCallback{Listen: ":0", Secret: "s3cret"})
+
+	res := post(t, srv.URL+"/callback/s3cret", paymentCallback)
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected 500, got %d", res.StatusCode)
+	}
+}
+
+func TestCallbackURL(t *testing.T) {
+	got := CallbackURL("https://example.com/", "s3cret")
+	if got != "https://example.com/callback/s3cret" {
+		t.Errorf("CallbackURL() = %s", got)
+	}
+}
+
+func newTestServer(t *testing.T, h Handler, cfg entity.ConfigCallback) *httptest.Server {
+	t.Helper()
+
+	s, err := New(h, cfg)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func post(t *testing.T, url string, body string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(SignatureHeader, "signature")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("posting callback: %v", err)
+	}
+	res.Body.Close()
+
+	return res
+}
+
+// MockHandler records the callbacks it handles.
+type MockHandler struct {
+	Bodies     []string
+	Signatures []string
+	Err        error
+}
+
+func (m *MockHandler) HandleNotification(_ context.Context, body []byte, signature string) error {
+	m.Bodies = append(m.Bodies, string(body))
+	m.Signatures = append(m.Signatures, signature)
+	return m.Err
+}
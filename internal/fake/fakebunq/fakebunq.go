@@ -0,0 +1,545 @@
+// Package fakebunq is an in-memory bunq API for tests.
+// It serves the endpoints bunq2ynab uses: installation, device server, session,
+// monetary accounts, payments and Mastercard actions with pagination and notification filters.
+// Like bunq it signs every response with its server key.
+package fakebunq
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	userID = 1
+	layout = "2006-01-02 15:04:05.000000"
+)
+
+// Kind is the kind of monetary account.
+type Kind string
+
+// These are the monetary account kinds, named after the object bunq wraps them in.
+const (
+	KindBank    Kind = "MonetaryAccountBank"
+	KindSavings Kind = "MonetaryAccountSavings"
+	KindJoint   Kind = "MonetaryAccountJoint"
+)
+
+var kindPaths = map[string]Kind{
+	"monetary-account-bank":    KindBank,
+	"monetary-account-savings": KindSavings,
+	"monetary-account-joint":   KindJoint,
+}
+
+// Payment is a payment on one of the fake accounts.
+type Payment struct {
+	ID               int
+	Created          time.Time
+	Amount           decimal.Decimal
+	Currency         string
+	Description      string
+	Type             string
+	SubType          string
+	CounterpartyIBAN string
+	CounterpartyName string
+}
+
+// CardAction is a Mastercard action, a card authorisation, on one of the fake accounts.
+type CardAction struct {
+	ID      int
+	Created time.Time
+	// Amount is the billed amount, bunq sends it unsigned.
+	Amount   decimal.Decimal
+	Currency string
+	// LocalAmount and LocalCurrency are what the merchant charged, they default to the billed amount.
+	LocalAmount   decimal.Decimal
+	LocalCurrency string
+	// Fee is the FX fee, part of the billed amount.
+	Fee              decimal.Decimal
+	Description      string
+	CounterpartyName string
+	// Decision defaults to ALLOWED.
+	Decision string
+	// AuthorisationStatus defaults to AUTHORISED.
+	AuthorisationStatus string
+	// ClearingStatus defaults to PENDING.
+	ClearingStatus string
+	// CardID and CardLabel identify the card, the label is the second line printed on it.
+	CardID    int
+	CardLabel string
+}
+
+type account struct {
+	id          int
+	kind        Kind
+	description string
+	iban        string
+	payments    []*Payment    // oldest first
+	cardActions []*CardAction // oldest first
+}
+
+// Server is a fake bunq API.
+type Server struct {
+	*httptest.Server
+	// PageSize caps the number of payments per page, so tests can exercise pagination.
+	PageSize int
+
+	key *rsa.PrivateKey
+
+	mu            gosync.Mutex
+	nextID        int
+	accounts      []*account
+	installations map[string]bool
+	sessions      map[string]bool
+	calls         map[string]int
+	filters       map[int][]string
+}
+
+// New starts a fake bunq API, close it when done.
+func New() *Server {
+	s := &Server{
+		PageSize:      200,
+		installations: map[string]bool{},
+		sessions:      map[string]bool{},
+		calls:         map[string]int{},
+		filters:       map[int][]string{},
+		key:           serverKey(),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+var (
+	keyOnce gosync.Once
+	key     *rsa.PrivateKey
+)
+
+// serverKey returns the key fake servers sign with, generated once since that is slow.
+func serverKey() *rsa.PrivateKey {
+	keyOnce.Do(func() {
+		var err error
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+	})
+
+	return key
+}
+
+// PublicKey returns the PEM encoded public key of the server.
+func (s *Server) PublicKey() string {
+	dat, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: dat}))
+}
+
+// Sign returns the X-Bunq-Server-Signature of the body, to sign callbacks with.
+func (s *Server) Sign(body []byte) string {
+	sum := sha256.Sum256(body)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, sum[:])
+	if err != nil {
+		panic(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// serve handles the request and signs the response.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	rec := httptest.NewRecorder()
+	s.handle(rec, r)
+
+	body := rec.Body.Bytes()
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	w.Header().Set("X-Bunq-Server-Signature", s.Sign(body))
+	w.WriteHeader(rec.Code)
+	_, _ = w.Write(body)
+}
+
+// AddAccount adds a monetary account and returns its ID.
+func (s *Server) AddAccount(kind Kind, description string, iban string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	s.accounts = append(s.accounts, &account{
+		id:          s.nextID,
+		kind:        kind,
+		description: description,
+		iban:        iban,
+	})
+
+	return s.nextID
+}
+
+// AddPayment adds a payment to the account and returns its ID.
+// Payment IDs increase over all accounts, like they do at bunq.
+func (s *Server) AddPayment(accountID int, p Payment) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	p.ID = s.nextID
+	if p.Created.IsZero() {
+		p.Created = time.Now()
+	}
+	if p.Currency == "" {
+		p.Currency = "EUR"
+	}
+	if p.Type == "" {
+		p.Type = "BUNQ"
+	}
+
+	acc := s.account(accountID)
+	acc.payments = append(acc.payments, &p)
+
+	return p.ID
+}
+
+// UpdatePayment changes the payment with the given ID through update.
+func (s *Server) UpdatePayment(paymentID int, update func(p *Payment)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, acc := range s.accounts {
+		for _, p := range acc.payments {
+			if p.ID == paymentID {
+				update(p)
+			}
+		}
+	}
+}
+
+// AddCardAction adds a Mastercard action to the account and returns its ID.
+func (s *Server) AddCardAction(accountID int, a CardAction) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	a.ID = s.nextID
+	if a.Created.IsZero() {
+		a.Created = time.Now()
+	}
+	if a.Currency == "" {
+		a.Currency = "EUR"
+	}
+	if a.LocalCurrency == "" {
+		a.LocalAmount, a.LocalCurrency = a.Amount, a.Currency
+	}
+	if a.Decision == "" {
+		a.Decision = "ALLOWED"
+	}
+	if a.AuthorisationStatus == "" {
+		a.AuthorisationStatus = "AUTHORISED"
+	}
+	if a.ClearingStatus == "" {
+		a.ClearingStatus = "PENDING"
+	}
+
+	acc := s.account(accountID)
+	acc.cardActions = append(acc.cardActions, &a)
+
+	return a.ID
+}
+
+// UpdateCardAction changes the Mastercard action with the given ID through update.
+func (s *Server) UpdateCardAction(actionID int, update func(a *CardAction)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, acc := range s.accounts {
+		for _, a := range acc.cardActions {
+			if a.ID == actionID {
+				update(a)
+			}
+		}
+	}
+}
+
+// ExpireSessions invalidates all sessions, as bunq does after a period of inactivity.
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = map[string]bool{}
+}
+
+// Calls returns how often the given path was requested, without the query string.
+func (s *Server) Calls(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[path]
+}
+
+// NotificationFilters returns the callback URLs registered for the account.
+func (s *Server) NotificationFilters(accountID int) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.filters[accountID]
+}
+
+func (s *Server) account(id int) *account {
+	for _, acc := range s.accounts {
+		if acc.id == id {
+			return acc
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls[r.URL.Path]++
+	auth := r.Header.Get("X-Bunq-Client-Authentication")
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/installation":
+		token := fmt.Sprintf("installation-%d", len(s.installations)+1)
+		s.installations[token] = true
+		writeResponse(w,
+			map[string]any{"Id": map[string]int{"id": len(s.installations)}},
+			map[string]any{"Token": map[string]string{"token": token}},
+			map[string]any{"ServerPublicKey": map[string]string{"server_public_key": s.PublicKey()}},
+		)
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/device-server":
+		if !s.installations[auth] {
+			writeError(w, http.StatusUnauthorized, "Insufficient authorisation.")
+			return
+		}
+		writeResponse(w, map[string]any{"Id": map[string]int{"id": 1}})
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/session-server":
+		if !s.installations[auth] {
+			writeError(w, http.StatusUnauthorized, "Insufficient authorisation.")
+			return
+		}
+		token := fmt.Sprintf("session-%d", s.calls[r.URL.Path])
+		s.sessions[token] = true
+		writeResponse(w,
+			map[string]any{"Id": map[string]int{"id": 1}},
+			map[string]any{"Token": map[string]string{"token": token}},
+			map[string]any{"UserPerson": map[string]int{"id": userID}},
+		)
+	case strings.HasPrefix(r.URL.Path, fmt.Sprintf("/v1/user/%d/", userID)):
+		if !s.sessions[auth] {
+			writeError(w, http.StatusUnauthorized, "Insufficient authorisation.")
+			return
+		}
+		s.handleUser(w, r, strings.Split(strings.TrimPrefix(r.URL.Path, fmt.Sprintf("/v1/user/%d/", userID)), "/"))
+	default:
+		writeError(w, http.StatusNotFound, "Route not found.")
+	}
+}
+
+func (s *Server) handleUser(w http.ResponseWriter, r *http.Request, parts []string) {
+	if kind, ok := kindPaths[parts[0]]; ok && len(parts) == 1 && r.Method == http.MethodGet {
+		s.listAccounts(w, kind)
+		return
+	}
+
+	if len(parts) < 2 || len(parts) > 4 || parts[0] != "monetary-account" {
+		writeError(w, http.StatusNotFound, "Route not found.")
+		return
+	}
+
+	id, err := strconv.Atoi(parts[1])
+	acc := s.account(id)
+	if err != nil || acc == nil {
+		writeError(w, http.StatusNotFound, "Monetary account not found.")
+		return
+	}
+
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		writeResponse(w, map[string]any{string(acc.kind): accountJSON(acc)})
+	case len(parts) == 2:
+		writeError(w, http.StatusNotFound, "Route not found.")
+	case len(parts) == 4 && parts[2] == "payment" && r.Method == http.MethodGet:
+		for _, p := range acc.payments {
+			if strconv.Itoa(p.ID) == parts[3] {
+				writeResponse(w, map[string]any{"Payment": paymentJSON(acc.id, p)})
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, "Payment not found.")
+	case len(parts) == 4:
+		writeError(w, http.StatusNotFound, "Route not found.")
+	case parts[2] == "payment" && r.Method == http.MethodGet:
+		objects := make([]map[string]any, 0, len(acc.payments))
+		for _, p := range acc.payments {
+			objects = append(objects, map[string]any{"Payment": paymentJSON(acc.id, p)})
+		}
+		s.listPage(w, r, acc, parts[2], objects)
+	case parts[2] == "mastercard-action" && r.Method == http.MethodGet:
+		objects := make([]map[string]any, 0, len(acc.cardActions))
+		for _, a := range acc.cardActions {
+			objects = append(objects, map[string]any{"MasterCardAction": cardActionJSON(acc.id, a)})
+		}
+		s.listPage(w, r, acc, parts[2], objects)
+	case parts[2] == "notification-filter-url" && r.Method == http.MethodPost:
+		var body struct {
+			NotificationFilters []struct {
+				NotificationTarget string `json:"notification_target"`
+			} `json:"notification_filters"`
+		}
+		if json.NewDecoder(r.Body).Decode(&body) != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON.")
+			return
+		}
+		s.filters[acc.id] = nil
+		for _, f := range body.NotificationFilters {
+			s.filters[acc.id] = append(s.filters[acc.id], f.NotificationTarget)
+		}
+		writeResponse(w)
+	default:
+		writeError(w, http.StatusNotFound, "Route not found.")
+	}
+}
+
+func (s *Server) listAccounts(w http.ResponseWriter, kind Kind) {
+	var res []any
+	for _, acc := range s.accounts {
+		if acc.kind != kind {
+			continue
+		}
+
+		res = append(res, map[string]any{string(kind): accountJSON(acc)})
+	}
+
+	writeResponse(w, res...)
+}
+
+// accountJSON returns the account with its balance, the sum of its payments.
+func accountJSON(acc *account) map[string]any {
+	balance := decimal.Zero
+	for _, p := range acc.payments {
+		balance = balance.Add(p.Amount)
+	}
+
+	return map[string]any{
+		"id":          acc.id,
+		"description": acc.description,
+		"status":      "ACTIVE",
+		"balance":     map[string]string{"value": balance.StringFixed(2), "currency": "EUR"},
+		"alias":       []map[string]string{{"type": "IBAN", "value": acc.iban, "name": "Fake"}},
+	}
+}
+
+// listPage returns a page of objects, newest first, with an ID lower than the older_id query parameter.
+// The objects are given oldest first, each wrapped in the name of its type as bunq does.
+func (s *Server) listPage(w http.ResponseWriter, r *http.Request, acc *account, kind string, objects []map[string]any) {
+	count := s.PageSize
+	if c, err := strconv.Atoi(r.URL.Query().Get("count")); err == nil && c < count {
+		count = c
+	}
+
+	olderID, _ := strconv.Atoi(r.URL.Query().Get("older_id"))
+
+	var page []any
+	var last int
+	older := false
+	for i := len(objects) - 1; i >= 0; i-- {
+		id := objectID(objects[i])
+		if olderID != 0 && id >= olderID {
+			continue
+		}
+
+		if len(page) == count {
+			older = true
+			break
+		}
+
+		page = append(page, objects[i])
+		last = id
+	}
+
+	pagination := map[string]any{"older_url": nil}
+	if older {
+		pagination["older_url"] = fmt.Sprintf("/v1/user/%d/monetary-account/%d/%s?count=%d&older_id=%d", userID, acc.id, kind, count, last)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"Response": page, "Pagination": pagination})
+}
+
+// objectID returns the ID of an object wrapped in the name of its type.
+func objectID(object map[string]any) int {
+	for _, o := range object {
+		return o.(map[string]any)["id"].(int)
+	}
+
+	return 0
+}
+
+func paymentJSON(accountID int, p *Payment) map[string]any {
+	return map[string]any{
+		"id":                  p.ID,
+		"created":             p.Created.UTC().Format(layout),
+		"monetary_account_id": accountID,
+		"amount":              map[string]string{"value": p.Amount.StringFixed(2), "currency": p.Currency},
+		"description":         p.Description,
+		"type":                p.Type,
+		"sub_type":            p.SubType,
+		"counterparty_alias":  map[string]string{"iban": p.CounterpartyIBAN, "display_name": p.CounterpartyName},
+	}
+}
+
+func cardActionJSON(accountID int, a *CardAction) map[string]any {
+	return map[string]any{
+		"id":                   a.ID,
+		"created":              a.Created.UTC().Format(layout),
+		"monetary_account_id":  accountID,
+		"amount_local":         map[string]string{"value": a.LocalAmount.StringFixed(2), "currency": a.LocalCurrency},
+		"amount_billing":       map[string]string{"value": a.Amount.StringFixed(2), "currency": a.Currency},
+		"amount_fee":           map[string]string{"value": a.Fee.StringFixed(2), "currency": a.Currency},
+		"description":          a.Description,
+		"decision":             a.Decision,
+		"authorisation_status": a.AuthorisationStatus,
+		"clearing_status":      a.ClearingStatus,
+		"counterparty_alias":   map[string]string{"display_name": a.CounterpartyName},
+		"card_id":              a.CardID,
+		"label_card":           map[string]string{"second_line": a.CardLabel},
+	}
+}
+
+func writeResponse(w http.ResponseWriter, objects ...any) {
+	if objects == nil {
+		objects = []any{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"Response": objects})
+}
+
+func writeError(w http.ResponseWriter, code int, description string) {
+	writeJSON(w, code, map[string]any{"Error": []map[string]string{{"error_description": description}}})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,540 @@
+// Package fakeynab is an in-memory YNAB API for tests.
+// It serves the endpoints bunq2ynab uses: budgets, accounts, categories, payees and
+// transactions, including the duplicate handling of bulk creates by import ID and
+// delta requests with last_knowledge_of_server.
+package fakeynab
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/brunomvsouza/ynab.go/api"
+	"github.com/brunomvsouza/ynab.go/api/account"
+	"github.com/brunomvsouza/ynab.go/api/category"
+	"github.com/brunomvsouza/ynab.go/api/payee"
+	"github.com/brunomvsouza/ynab.go/api/transaction"
+)
+
+const rateLimit = 200
+
+type budget struct {
+	id           string
+	name         string
+	currency     string
+	accounts     []*account.Account
+	groups       []*category.GroupWithCategories
+	payees       []*payee.Payee
+	transactions []*transaction.Transaction
+}
+
+// Server is a fake YNAB API.
+type Server struct {
+	*httptest.Server
+
+	mu      gosync.Mutex
+	nextID  int
+	budgets []*budget
+	calls   map[string]int
+	used    int
+	// knowledge is the server knowledge, it goes up on every change.
+	knowledge int
+	// changed holds the knowledge at which an account, category group or category last changed.
+	changed map[string]int
+}
+
+// New starts a fake YNAB API, close it when done.
+func New() *Server {
+	s := &Server{calls: map[string]int{}, changed: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+// AddBudget adds a budget and returns its ID.
+func (s *Server) AddBudget(name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := &budget{id: s.id("budget"), name: name, currency: "EUR"}
+	s.budgets = append(s.budgets, b)
+
+	return b.id
+}
+
+// SetCurrency changes the currency of the budget, budgets are in EUR by default.
+func (s *Server) SetCurrency(budgetID string, iso string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.budget(budgetID).currency = iso
+}
+
+// AddAccount adds an account and its transfer payee to the budget and returns its ID.
+func (s *Server) AddAccount(budgetID string, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.budget(budgetID)
+	acc := &account.Account{ID: s.id("account"), Name: name, Type: account.TypeChecking, OnBudget: true}
+	b.accounts = append(b.accounts, acc)
+	s.change(acc.ID)
+	b.payees = append(b.payees, &payee.Payee{
+		ID:                s.id("payee"),
+		Name:              "Transfer : " + name,
+		TransferAccountID: &acc.ID,
+	})
+
+	return acc.ID
+}
+
+// AddCategory adds a category to the group, creating the group if needed, and returns its ID.
+func (s *Server) AddCategory(budgetID string, group string, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.budget(budgetID)
+	var g *category.GroupWithCategories
+	for _, bg := range b.groups {
+		if bg.Name == group {
+			g = bg
+		}
+	}
+	if g == nil {
+		g = &category.GroupWithCategories{ID: s.id("group"), Name: group}
+		b.groups = append(b.groups, g)
+		s.change(g.ID)
+	}
+
+	c := &category.Category{ID: s.id("category"), CategoryGroupID: g.ID, Name: name}
+	g.Categories = append(g.Categories, c)
+	s.change(c.ID)
+
+	return c.ID
+}
+
+// DeleteAccount marks the account as deleted.
+func (s *Server) DeleteAccount(budgetID string, accountID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.budget(budgetID).account(accountID)
+	acc.Deleted = true
+	s.change(acc.ID)
+}
+
+// EditTransaction changes the memo of the transaction with the import ID, like a user would in the app.
+func (s *Server) EditTransaction(budgetID string, importID string, memo string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.budget(budgetID).transactions {
+		if t.ImportID != nil && *t.ImportID == importID {
+			t.Memo = &memo
+			s.change(t.ID)
+		}
+	}
+}
+
+// Transactions returns a copy of the transactions in the account, without the deleted ones.
+func (s *Server) Transactions(budgetID string, accountID string) []transaction.Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var res []transaction.Transaction
+	for _, t := range s.budget(budgetID).transactions {
+		if t.AccountID == accountID && !t.Deleted {
+			res = append(res, *t)
+		}
+	}
+
+	return res
+}
+
+// Calls returns how often the given method and path were requested, without the query string.
+func (s *Server) Calls(method string, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[method+" "+path]
+}
+
+// change records that the entity with the given ID changed.
+func (s *Server) change(id string) {
+	s.knowledge++
+	s.changed[id] = s.knowledge
+}
+
+// since returns the last_knowledge_of_server of the request, 0 for a full request.
+func since(r *http.Request) int {
+	var k int
+	_, _ = fmt.Sscan(r.URL.Query().Get("last_knowledge_of_server"), &k)
+
+	return k
+}
+
+func (s *Server) id(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%d", prefix, s.nextID)
+}
+
+func (s *Server) budget(id string) *budget {
+	for _, b := range s.budgets {
+		if b.id == id {
+			return b
+		}
+	}
+
+	return nil
+}
+
+func (b *budget) account(id string) *account.Account {
+	for _, acc := range b.accounts {
+		if acc.ID == id {
+			return acc
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls[r.Method+" "+r.URL.Path]++
+	s.used++
+	w.Header().Set("X-Rate-Limit", fmt.Sprintf("%d/%d", s.used, rateLimit))
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1"), "/"), "/")
+	if parts[0] != "budgets" {
+		writeError(w, http.StatusNotFound, "404.2", "resource_not_found")
+		return
+	}
+
+	if len(parts) == 1 && r.Method == http.MethodGet {
+		var budgets []map[string]any
+		for _, b := range s.budgets {
+			budgets = append(budgets, map[string]any{
+				"id":              b.id,
+				"name":            b.name,
+				"currency_format": map[string]any{"iso_code": b.currency, "decimal_digits": 2},
+			})
+		}
+		writeData(w, map[string]any{"budgets": budgets})
+		return
+	}
+
+	b := s.budget(parts[1])
+	if b == nil {
+		writeError(w, http.StatusNotFound, "404.2", "resource_not_found")
+		return
+	}
+
+	path := strings.Join(parts[2:], "/")
+	switch {
+	case r.Method == http.MethodGet && path == "accounts":
+		res := []*account.Account{}
+		for _, acc := range b.accounts {
+			s.balance(b, acc)
+			if s.changed[acc.ID] > since(r) {
+				res = append(res, acc)
+			}
+		}
+		writeData(w, map[string]any{"accounts": res, "server_knowledge": s.knowledge})
+	case r.Method == http.MethodGet && len(parts) == 4 && parts[2] == "accounts":
+		acc := b.account(parts[3])
+		if acc == nil {
+			writeError(w, http.StatusNotFound, "404.2", "resource_not_found")
+			return
+		}
+		s.balance(b, acc)
+		writeData(w, map[string]any{"account": acc})
+	case r.Method == http.MethodGet && len(parts) == 5 && parts[2] == "accounts" && parts[4] == "transactions":
+		s.listTransactions(w, r, b, parts[3])
+	case r.Method == http.MethodGet && path == "categories":
+		writeData(w, map[string]any{"category_groups": s.groups(b, since(r)), "server_knowledge": s.knowledge})
+	case r.Method == http.MethodGet && path == "payees":
+		writeData(w, map[string]any{"payees": b.payees, "server_knowledge": s.knowledge})
+	case r.Method == http.MethodPost && path == "transactions":
+		s.createTransactions(w, r, b)
+	case r.Method == http.MethodPatch && path == "transactions":
+		s.updateTransactions(w, r, b)
+	case r.Method == http.MethodDelete && len(parts) == 4 && parts[2] == "transactions":
+		t := b.transaction(parts[3])
+		if t == nil || t.Deleted {
+			writeError(w, http.StatusNotFound, "404.2", "resource_not_found")
+			return
+		}
+		t.Deleted = true
+		s.change(t.ID)
+		writeData(w, map[string]any{"transaction": t})
+	default:
+		writeError(w, http.StatusNotFound, "404.1", "not_found")
+	}
+}
+
+// groups returns the category groups that changed after the given knowledge, with only their changed categories.
+func (s *Server) groups(b *budget, knowledge int) []*category.GroupWithCategories {
+	res := []*category.GroupWithCategories{}
+	for _, g := range b.groups {
+		cp := *g
+		cp.Categories = nil
+		for _, c := range g.Categories {
+			if s.changed[c.ID] > knowledge {
+				cp.Categories = append(cp.Categories, c)
+			}
+		}
+
+		if s.changed[g.ID] > knowledge || len(cp.Categories) > 0 {
+			res = append(res, &cp)
+		}
+	}
+
+	return res
+}
+
+// balance sets the cleared and uncleared balance of the account from its transactions.
+func (s *Server) balance(b *budget, acc *account.Account) {
+	acc.ClearedBalance, acc.UnclearedBalance = 0, 0
+	for _, t := range b.transactions {
+		if t.AccountID != acc.ID || t.Deleted {
+			continue
+		}
+
+		if t.Cleared == transaction.ClearingStatusUncleared {
+			acc.UnclearedBalance += t.Amount
+		} else {
+			acc.ClearedBalance += t.Amount
+		}
+	}
+	acc.Balance = acc.ClearedBalance + acc.UnclearedBalance
+}
+
+func (s *Server) listTransactions(w http.ResponseWriter, r *http.Request, b *budget, accountID string) {
+	var since time.Time
+	if sinceDate := r.URL.Query().Get("since_date"); sinceDate != "" {
+		d, err := api.DateFromString(sinceDate)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "400", "bad_request")
+			return
+		}
+		since = d.Time
+	}
+
+	res := []*transaction.Transaction{}
+	for _, t := range b.transactions {
+		if t.AccountID == accountID && !t.Date.Before(since) && !t.Deleted {
+			res = append(res, t)
+		}
+	}
+
+	writeData(w, map[string]any{"transactions": res, "server_knowledge": s.knowledge})
+}
+
+// createTransactions creates the transactions, skipping those with an import ID that
+// already exists in the account, like YNAB does.
+func (s *Server) createTransactions(w http.ResponseWriter, r *http.Request, b *budget) {
+	var body struct {
+		Transactions []struct {
+			transaction.PayloadTransaction
+			SubTransactions []*transaction.SubTransaction `json:"subtransactions"`
+		} `json:"transactions"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "400", "bad_request")
+		return
+	}
+
+	summary := transaction.OperationSummary{
+		TransactionIDs:     []string{},
+		DuplicateImportIDs: []string{},
+		Transactions:       []*transaction.Transaction{},
+	}
+	for _, p := range body.Transactions {
+		if b.account(p.AccountID) == nil {
+			writeError(w, http.StatusBadRequest, "400", "bad_request")
+			return
+		}
+
+		if p.ImportID != nil && s.hasImportID(b, p.AccountID, *p.ImportID) {
+			summary.DuplicateImportIDs = append(summary.DuplicateImportIDs, *p.ImportID)
+			continue
+		}
+
+		t := s.create(b, p.PayloadTransaction)
+		if len(p.SubTransactions) > 0 {
+			t.CategoryID = nil
+			t.SubTransactions = p.SubTransactions
+			for _, st := range t.SubTransactions {
+				st.ID = s.id("subtransaction")
+				st.TransactionID = t.ID
+			}
+		}
+		summary.TransactionIDs = append(summary.TransactionIDs, t.ID)
+		summary.Transactions = append(summary.Transactions, t)
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{"data": summary})
+}
+
+// updateTransactions changes only the fields present in the request, like YNAB does.
+func (s *Server) updateTransactions(w http.ResponseWriter, r *http.Request, b *budget) {
+	var body struct {
+		Transactions []struct {
+			ID         string                      `json:"id"`
+			Amount     *int64                      `json:"amount"`
+			Memo       *string                     `json:"memo"`
+			Cleared    *transaction.ClearingStatus `json:"cleared"`
+			CategoryID *string                     `json:"category_id"`
+		} `json:"transactions"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "400", "bad_request")
+		return
+	}
+
+	summary := transaction.OperationSummary{TransactionIDs: []string{}, Transactions: []*transaction.Transaction{}}
+	for _, p := range body.Transactions {
+		t := b.transaction(p.ID)
+		if t == nil {
+			writeError(w, http.StatusNotFound, "404.2", "resource_not_found")
+			return
+		}
+
+		if p.Amount != nil {
+			t.Amount = *p.Amount
+		}
+		if p.Memo != nil {
+			t.Memo = p.Memo
+		}
+		if p.Cleared != nil {
+			t.Cleared = *p.Cleared
+		}
+		if p.CategoryID != nil {
+			t.CategoryID = p.CategoryID
+		}
+		s.change(t.ID)
+
+		summary.TransactionIDs = append(summary.TransactionIDs, t.ID)
+		summary.Transactions = append(summary.Transactions, t)
+	}
+
+	writeData(w, summary)
+}
+
+func (b *budget) transaction(id string) *transaction.Transaction {
+	for _, t := range b.transactions {
+		if t.ID == id {
+			return t
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) hasImportID(b *budget, accountID string, importID string) bool {
+	for _, t := range b.transactions {
+		if t.AccountID == accountID && t.ImportID != nil && *t.ImportID == importID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// create adds the transaction, resolving the payee and creating the other side of transfers.
+func (s *Server) create(b *budget, p transaction.PayloadTransaction) *transaction.Transaction {
+	t := &transaction.Transaction{
+		ID:         s.id("transaction"),
+		Date:       p.Date,
+		Amount:     p.Amount,
+		Cleared:    p.Cleared,
+		Approved:   p.Approved,
+		AccountID:  p.AccountID,
+		Memo:       p.Memo,
+		CategoryID: p.CategoryID,
+		ImportID:   p.ImportID,
+		PayeeName:  p.PayeeName,
+	}
+	if t.Cleared == "" {
+		t.Cleared = transaction.ClearingStatusUncleared
+	}
+	t.AccountName = b.account(p.AccountID).Name
+
+	pe := s.payee(b, p.PayeeID, p.PayeeName)
+	if pe != nil {
+		t.PayeeID = &pe.ID
+		t.PayeeName = &pe.Name
+		t.TransferAccountID = pe.TransferAccountID
+	}
+	b.transactions = append(b.transactions, t)
+	s.change(t.ID)
+
+	if t.TransferAccountID != nil {
+		back := s.transferPayee(b, t.AccountID)
+		other := &transaction.Transaction{
+			ID:                s.id("transaction"),
+			Date:              t.Date,
+			Amount:            -t.Amount,
+			Cleared:           transaction.ClearingStatusUncleared,
+			AccountID:         *t.TransferAccountID,
+			AccountName:       b.account(*t.TransferAccountID).Name,
+			Memo:              t.Memo,
+			PayeeID:           &back.ID,
+			PayeeName:         &back.Name,
+			TransferAccountID: &t.AccountID,
+		}
+		b.transactions = append(b.transactions, other)
+	}
+
+	return t
+}
+
+// payee returns the payee by ID, or by name, creating it if it doesn't exist yet.
+func (s *Server) payee(b *budget, id *string, name *string) *payee.Payee {
+	for _, pe := range b.payees {
+		if (id != nil && pe.ID == *id) || (id == nil && name != nil && pe.Name == *name) {
+			return pe
+		}
+	}
+
+	if id != nil || name == nil {
+		return nil
+	}
+
+	pe := &payee.Payee{ID: s.id("payee"), Name: *name}
+	b.payees = append(b.payees, pe)
+
+	return pe
+}
+
+func (s *Server) transferPayee(b *budget, accountID string) *payee.Payee {
+	for _, pe := range b.payees {
+		if pe.TransferAccountID != nil && *pe.TransferAccountID == accountID {
+			return pe
+		}
+	}
+
+	return nil
+}
+
+func writeData(w http.ResponseWriter, data any) {
+	writeJSON(w, http.StatusOK, map[string]any{"data": data})
+}
+
+func writeError(w http.ResponseWriter, code int, id string, name string) {
+	writeJSON(w, code, map[string]any{"error": map[string]string{"id": id, "name": name, "detail": name}})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,71 @@
+// Package fileutil holds the file helpers shared by the stores in the state directory.
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WriteAtomic writes dat to path, creating its directory when needed.
+// It is written to a temporary file first so a crash never leaves a partial file behind.
+func WriteAtomic(path string, dat []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return errors.Wrap(err, "creating directory")
+	}
+
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, dat, 0o600)
+	if err != nil {
+		return errors.Wrap(err, "writing temporary file")
+	}
+
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return errors.Wrap(err, "replacing file")
+	}
+
+	return nil
+}
+
+const (
+	// lockTimeout is how long Lock waits for another process to release the lock.
+	lockTimeout = 10 * time.Second
+	// staleLock is the age after which a lock is taken to be left behind by a crashed process.
+	staleLock = time.Minute
+)
+
+// Lock takes an exclusive lock on path that holds across processes, by creating a lock file
+// next to it. The returned func releases the lock.
+func Lock(path string) (func(), error) {
+	lock := path + ".lock"
+	err := os.MkdirAll(filepath.Dir(lock), 0o700)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating directory")
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, errors.Wrap(err, "creating lock file")
+		}
+
+		if info, err := os.Stat(lock); err == nil && time.Since(info.ModTime()) > staleLock {
+			os.Remove(lock)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf("%s is locked by another process", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
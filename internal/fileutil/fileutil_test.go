@@ -0,0 +1,86 @@
+package fileutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteAtomicReplacesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "file.json")
+
+	for _, content := range []string{"first", "second"} {
+		err := WriteAtomic(path, []byte(content))
+		if err != nil {
+			t.Fatalf("WriteAtomic() error = %v", err)
+		}
+
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("reading file: %v", err)
+		}
+
+		if string(got) != content {
+			t.Errorf("Expected %q, got %q", content, got)
+		}
+	}
+
+	_, err := os.Stat(path + ".tmp")
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected no temporary file to be left behind, got %v", err)
+	}
+}
+
+func TestLockWaitsForRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.json")
+
+	first, err := Lock(path)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(released)
+		first()
+	}()
+
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	defer unlock()
+
+	select {
+	case <-released:
+	default:
+		t.Error("Expected the lock to be taken only after it was released")
+	}
+}
+
+func TestLockTakesOverStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.json")
+
+	err := os.WriteFile(path+".lock", nil, 0o600)
+	if err != nil {
+		t.Fatalf("writing lock file: %v", err)
+	}
+	old := time.Now().Add(-2 * staleLock)
+	err = os.Chtimes(path+".lock", old, old)
+	if err != nil {
+		t.Fatalf("aging lock file: %v", err)
+	}
+
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	unlock()
+
+	_, err = os.Stat(path + ".lock")
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected the lock file to be removed on release, got %v", err)
+	}
+}